@@ -21,7 +21,25 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	if err := app.Run(ctx, cfg); err != nil {
+	switch cfg.Command {
+	case config.CommandHistory:
+		err = app.History(ctx, cfg)
+	case config.CommandVerify:
+		err = app.Verify(ctx, cfg)
+	case config.CommandExport:
+		err = app.Export(ctx, cfg)
+	case config.CommandGallery:
+		err = app.Gallery(ctx, cfg)
+	case config.CommandServe:
+		err = app.Serve(ctx, cfg)
+	case config.CommandDaemon:
+		err = app.Daemon(ctx, cfg)
+	case config.CommandWatch:
+		err = app.Watch(ctx, cfg)
+	default:
+		err = app.Run(ctx, cfg)
+	}
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
@@ -4,46 +4,148 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/baptistax/idl/internal/config"
 	"github.com/baptistax/idl/internal/downloader"
 	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/mp4"
+	"github.com/baptistax/idl/internal/notify"
+	"github.com/baptistax/idl/internal/storage"
 	"github.com/baptistax/idl/internal/utils"
 )
 
+// RunOptions customizes a download run for callers that drive runs programmatically.
+type RunOptions struct {
+	// Observer receives the progress of the run.
+	Observer Observer
+	// Client and Pacer are shared with other runs when set; otherwise the run creates its
+	// own from cfg.
+	Client *instagram.Client
+	Pacer  *Pacer
+	// Output receives the console output of the run: standard output by default, standard
+	// error when the archive is streamed to standard output.
+	Output io.Writer
+}
+
+// Run downloads the profile, posts, reels, tagged posts and highlights of cfg.Username,
+// and reports the result to the --notify sinks.
 func Run(ctx context.Context, cfg config.Config) error {
+	n, err := newNotifier(cfg)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return RunWith(ctx, cfg, RunOptions{})
+	}
+	rec := newRunRecorder(cfg.Username)
 	startedAt := time.Now()
-	cookiesPath := config.ResolveCookiesPath(cfg.CookiesPath)
-	if _, err := os.Stat(cookiesPath); err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("cookies.txt not found (%s)", cookiesPath)
+	err = RunWith(ctx, cfg, RunOptions{Observer: rec.observe})
+	sendReport(ctx, n, notify.Report{StartedAt: startedAt, FinishedAt: time.Now(), Targets: []notify.TargetResult{rec.result(err)}})
+	return err
+}
+
+// RunWith is Run with options.
+func RunWith(ctx context.Context, cfg config.Config, opts RunOptions) (retErr error) {
+	startedAt := time.Now()
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	if cfg.ToArchive == "-" && out == io.Writer(os.Stdout) {
+		// The archive owns standard output.
+		out = os.Stderr
+	}
+	// The observer and hooks exist before anything can fail, so that every run ends with
+	// run_finished, even one that stops before its first download.
+	observe := opts.Observer
+	if h := newHooks(cfg); h != nil {
+		// Deferred before run_finished is emitted, so the run waits for its last hooks.
+		defer h.close()
+		observe = func(e Event) {
+			if opts.Observer != nil {
+				opts.Observer(e)
+			}
+			h.observe(e)
 		}
-		return fmt.Errorf("unable to access cookies file: %v", err)
 	}
-
-	if err := utils.EnsureDir(cfg.OutputRoot); err != nil {
-		return fmt.Errorf("unable to create output directory (%s): %v", cfg.OutputRoot, err)
+	var events *observer
+	if observe != nil {
+		events = &observer{fn: observe, target: strings.TrimPrefix(cfg.Username, "@")}
 	}
+	events.emit(Event{Type: EventRunStarted})
+	defer func() {
+		e := Event{Type: EventRunFinished}
+		if retErr != nil {
+			e.Error = retErr.Error()
+		}
+		events.emit(e)
+	}()
 
-	ig, err := instagram.NewClient(instagram.Options{
-		CookiesPath: cookiesPath,
-		UserAgent:   cfg.UserAgent,
-	})
+	filter, err := newPostFilter(cfg)
 	if err != nil {
 		return err
 	}
+	quality, err := instagram.ParseVideoQuality(cfg.VideoQuality)
+	if err != nil {
+		return fmt.Errorf("invalid --video-quality: %v", err)
+	}
+	quality.MaxImageWidth = cfg.ImageMaxWidth
+
+	ig := opts.Client
+	if ig == nil {
+		if ig, err = newInstagramClient(cfg); err != nil {
+			return err
+		}
+	}
+
+	var store storage.Storage
+	local := false
+	if cfg.ToArchive != "" {
+		tarStore, closeTar, err := storage.CreateTar(cfg.ToArchive)
+		if err != nil {
+			return fmt.Errorf("unable to create archive (%s): %v", cfg.ToArchive, err)
+		}
+		defer func() {
+			if err := closeTar(); err != nil && retErr == nil {
+				retErr = fmt.Errorf("unable to finish archive (%s): %v", cfg.ToArchive, err)
+			}
+		}()
+		store = tarStore
+	} else {
+		store, err = storage.Open(cfg.OutputRoot)
+		if err != nil {
+			return err
+		}
+		local = !storage.IsRemote(cfg.OutputRoot)
+	}
+	if local {
+		if err := utils.EnsureDir(cfg.OutputRoot); err != nil {
+			return fmt.Errorf("unable to create output directory (%s): %v", cfg.OutputRoot, err)
+		}
+	}
 
 	dl := downloader.New(downloader.Options{
-		OutputDir: cfg.OutputRoot,
+		Storage:   store,
 		UserAgent: cfg.UserAgent,
 		Referer:   "https://www.instagram.com/",
+
+		VerifyMedia: true,
+		Checksums:   cfg.Checksums,
+		BLAKE3:      cfg.BLAKE3,
 	})
-	pacer := NewPacer(150*time.Millisecond, 350*time.Millisecond)
-	pacer.Start()
-	defer pacer.Stop()
+	pacer := opts.Pacer
+	if pacer == nil {
+		pacer = newDefaultPacer()
+		pacer.Start()
+		defer pacer.Stop()
+	}
 
 	profile, err := ig.FetchProfile(ctx, cfg.Username)
 	if err != nil {
@@ -55,44 +157,252 @@ func Run(ctx context.Context, cfg config.Config) error {
 		return errors.New("invalid username")
 	}
 
-	userRoot := filepath.Join(cfg.OutputRoot, safeUser)
-	if err := utils.EnsureDir(userRoot); err != nil {
-		return fmt.Errorf("unable to create user output directory (%s): %v", userRoot, err)
+	userRoot := store.Location(safeUser)
+	if local {
+		if err := utils.EnsureDir(userRoot); err != nil {
+			return fmt.Errorf("unable to create user output directory (%s): %v", userRoot, err)
+		}
 	}
 
-	printBanner()
-	printKV("Target", profile.Username)
-	printKV("Output", userRoot)
+	printBanner(out)
+	printKV(out, "Target", profile.Username)
+	printKV(out, "Output", userRoot)
 	if profile.UserID != "" {
-		printKV("Profile ID", profile.UserID)
+		printKV(out, "Profile ID", profile.UserID)
 	}
-	fmt.Println()
 
 	firstErr := error(nil)
-	userID := profile.UserID
-
-	timelineUserID, err := downloadTimeline(ctx, ig, dl, pacer, safeUser, profile.Username)
-	if err != nil && firstErr == nil {
-		firstErr = err
+	if profile.HasInfo {
+		snapPath, err := saveProfileSnapshot(ctx, store, safeUser, newProfileSnapshot(profile, startedAt))
+		if err != nil {
+			firstErr = err
+		} else {
+			printKV(out, "Snapshot", snapPath)
+		}
+	} else {
+		printKV(out, "Snapshot", "profile metadata unavailable")
+	}
+	if profile.ProfilePicURLHD != "" || profile.ProfilePicURL != "" {
+		picPath, isNew, err := saveProfilePicture(ctx, dl, pacer, safeUser, profile, startedAt)
+		switch {
+		case err != nil:
+			if firstErr == nil {
+				firstErr = err
+			}
+			printKV(out, "Avatar", "download failed")
+		case isNew:
+			printKV(out, "Avatar", picPath+" (new)")
+		default:
+			printKV(out, "Avatar", picPath+" (unchanged)")
+		}
 	}
-	if userID == "" {
-		userID = timelineUserID
+	fmt.Fprintln(out)
+
+	sess := &session{
+		ig:       ig,
+		dl:       dl,
+		store:    store,
+		pacer:    pacer,
+		filter:   filter,
+		username: profile.Username,
+		userID:   profile.UserID,
+		safeUser: safeUser,
+		userRoot: userRoot,
+		comments: cfg.Comments,
+		quality:  quality,
+
+		carouselFolders: cfg.Layout == config.LayoutFolders,
+		videoCovers:     cfg.VideoCovers,
+		audioOnly:       cfg.AudioOnly,
+		skipExisting:    cfg.SkipExisting,
+		out:             out,
+		events:          events,
+	}
+	stages := cfg.Stages
+	if len(stages) == 0 {
+		stages = config.Stages
+	}
+	step := 0
+	// begin starts the next stage when it was selected.
+	begin := func(stage, title string) bool {
+		if !slices.Contains(stages, stage) {
+			return false
+		}
+		step++
+		sess.startStage(step, len(stages), stage, title)
+		return true
 	}
 
-	if userID != "" {
-		if err := downloadHighlights(ctx, ig, dl, pacer, safeUser, profile.Username, userID); err != nil && firstErr == nil {
+	timelineIDs := map[string]struct{}{}
+	if begin(StagePosts, "Posts / Reels") {
+		timelineUserID, err := sess.downloadTimeline(ctx, timelineIDs)
+		sess.finishStage(err)
+		if err != nil && firstErr == nil {
 			firstErr = err
 		}
+		if sess.userID == "" {
+			sess.userID = timelineUserID
+		}
+	}
+
+	if sess.userID != "" {
+		if begin(StageReels, "Reels") {
+			err := sess.downloadReels(ctx, timelineIDs)
+			sess.finishStage(err)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		if begin(StageTagged, "Tagged") {
+			err := sess.downloadTagged(ctx)
+			sess.finishStage(err)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		if begin(StageHighlights, "Highlights") {
+			err := sess.downloadHighlights(ctx, highlightSelection{
+				titles: cfg.HighlightTitles,
+				ids:    cfg.HighlightIDs,
+				pick:   cfg.PickHighlights,
+			})
+			sess.finishStage(err)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
 	} else if firstErr == nil {
 		firstErr = errors.New("failed to resolve profile id")
 	}
 
-	printFooter(time.Since(startedAt), firstErr == nil)
+	if err := dl.FlushChecksums(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	printFooter(out, time.Since(startedAt), firstErr == nil)
 	return firstErr
 }
 
-func downloadTimeline(ctx context.Context, ig *instagram.Client, dl *downloader.Downloader, pacer *Pacer, safeUser, username string) (string, error) {
-	printSectionHeader(1, 2, "Posts / Reels")
+// newInstagramClient opens the Instagram session of cfg's cookies file.
+func newInstagramClient(cfg config.Config) (*instagram.Client, error) {
+	cookiesPath := config.ResolveCookiesPath(cfg.CookiesPath)
+	if _, err := os.Stat(cookiesPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("cookies.txt not found (%s)", cookiesPath)
+		}
+		return nil, fmt.Errorf("unable to access cookies file: %v", err)
+	}
+	return instagram.NewClient(instagram.Options{
+		CookiesPath: cookiesPath,
+		UserAgent:   cfg.UserAgent,
+	})
+}
+
+// newDefaultPacer returns the Pacer used by download runs; the caller starts it.
+func newDefaultPacer() *Pacer {
+	return NewPacer(150*time.Millisecond, 350*time.Millisecond)
+}
+
+// session bundles the state shared by the download stages of a single target.
+type session struct {
+	ig       *instagram.Client
+	dl       *downloader.Downloader
+	store    storage.Storage
+	pacer    *Pacer
+	filter   postFilter
+	username string
+	userID   string
+	safeUser string
+	// userRoot is the location of the user directory, for display.
+	userRoot string
+	comments bool
+	// quality selects the video representation and caps the image size.
+	quality instagram.Quality
+	// carouselFolders places each carousel in its own folder with a manifest.json
+	// instead of flattening the children into the stage directory.
+	carouselFolders bool
+	// audioOnly saves the audio track of videos as .m4a instead of the video.
+	audioOnly bool
+	// videoCovers saves the poster frame of every video as <basename>_cover.jpg.
+	videoCovers bool
+	// skipExisting skips media whose file is already in storage.
+	skipExisting bool
+	// out receives the console output.
+	out io.Writer
+	// events reports progress to the Observer of the run; nil when there is none.
+	events *observer
+}
+
+// key returns the storage key of a file below the user directory.
+func (s *session) key(elem ...string) string {
+	return userKey(s.safeUser, elem...)
+}
+
+// userKey returns the storage key of a file below a user directory.
+func userKey(safeUser string, elem ...string) string {
+	parts := []string{safeUser}
+	for _, e := range elem {
+		parts = append(parts, filepath.ToSlash(e))
+	}
+	return path.Join(parts...)
+}
+
+// saved reports whether rel is already stored and --skip-existing is set. Lookup errors
+// count as missing, so that the file is downloaded again.
+func (s *session) saved(ctx context.Context, rel string) bool {
+	if !s.skipExisting {
+		return false
+	}
+	ok, err := s.store.Exists(ctx, filepath.ToSlash(rel))
+	return err == nil && ok
+}
+
+// imageExts are the extensions an image downloaded as JPEG can be stored with: images that
+// cannot be converted keep their own format.
+var imageExts = []string{".jpg", ".png", ".webp", ".bin"}
+
+// savedImage is like saved for an image downloaded to rel, which may have been stored with
+// any of imageExts. It returns the name of the stored file.
+func (s *session) savedImage(ctx context.Context, rel string) (string, bool) {
+	if !s.skipExisting {
+		return "", false
+	}
+	base := strings.TrimSuffix(rel, filepath.Ext(rel))
+	for _, ext := range imageExts {
+		if ok, err := s.store.Exists(ctx, filepath.ToSlash(base+ext)); err == nil && ok {
+			return filepath.Base(base + ext), true
+		}
+	}
+	return "", false
+}
+
+// tagMedia attaches the identity of a post to a saved file, on backends that support object
+// tags (S3). Sidecar files carry the full metadata.
+func (s *session) tagMedia(ctx context.Context, key string, m instagram.Media) error {
+	tags := map[string]string{
+		"idl-user":     s.safeUser,
+		"idl-media-id": mediaID(m),
+	}
+	if m.Code != "" {
+		tags["idl-code"] = m.Code
+	}
+	if m.ProductType != "" {
+		tags["idl-product-type"] = m.ProductType
+	}
+	if m.TakenAt > 0 {
+		tags["idl-taken-at"] = time.Unix(m.TakenAt, 0).UTC().Format(time.RFC3339)
+	}
+	if err := storage.SetTags(ctx, s.store, key, tags); err != nil {
+		return fmt.Errorf("unable to tag %s: %v", path.Base(key), err)
+	}
+	return nil
+}
+
+// downloadTimeline saves the profile grid into posts/. The ids of posts saved without errors are
+// added to saved so later stages can skip media that is already on disk.
+func (s *session) downloadTimeline(ctx context.Context, saved map[string]struct{}) (string, error) {
 	var progress *Progress
 	defer func() {
 		if progress != nil {
@@ -104,6 +414,9 @@ func downloadTimeline(ctx context.Context, ig *instagram.Client, dl *downloader.
 	userID := ""
 	firstErr := error(nil)
 	downloaded := 0
+	posts := 0
+	filtered := 0
+	done := false
 
 	for {
 		select {
@@ -112,7 +425,7 @@ func downloadTimeline(ctx context.Context, ig *instagram.Client, dl *downloader.
 		default:
 		}
 
-		items, pageInfo, uid, err := ig.FetchPostsPage(ctx, username, after)
+		items, pageInfo, uid, err := s.ig.FetchPostsPage(ctx, s.username, after)
 		if err != nil {
 			return userID, err
 		}
@@ -121,32 +434,34 @@ func downloadTimeline(ctx context.Context, ig *instagram.Client, dl *downloader.
 		}
 
 		for _, m := range items {
-			jobs := timelineMediaJobs(m)
+			if s.filter.reachedMax(posts) || s.filter.pastSince(m) {
+				done = true
+				break
+			}
+			if !s.filter.matchPost(m) {
+				filtered++
+				continue
+			}
+			posts++
+			jobs := s.filter.filterJobs(timelineMediaJobs(m))
 			if len(jobs) > 0 && progress == nil {
-				progress = NewProgress("POSTS / REELS")
+				progress = NewProgress(s.out, "POSTS / REELS")
 				progress.Start()
 			}
 			if progress != nil {
 				progress.AddTotal(len(jobs))
 			}
-			for _, job := range jobs {
-				if err := downloadMedia(ctx, dl, pacer, safeUser, "posts", job.media, job.idx); err != nil {
-					if firstErr == nil {
-						firstErr = err
-					}
-					if progress != nil {
-						progress.IncFail()
-					}
-				} else {
-					downloaded++
-					if progress != nil {
-						progress.IncOK()
-					}
-				}
+			n, ok, err := s.downloadPost(ctx, "posts", "", m, jobs, progress)
+			downloaded += n
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if ok && saved != nil {
+				saved[mediaID(m)] = struct{}{}
 			}
 		}
 
-		if !pageInfo.HasNextPage || pageInfo.EndCursor == "" {
+		if done || !pageInfo.HasNextPage || pageInfo.EndCursor == "" {
 			break
 		}
 		after = pageInfo.EndCursor
@@ -159,10 +474,135 @@ func downloadTimeline(ctx context.Context, ig *instagram.Client, dl *downloader.
 		progress.Finish()
 		progress = nil
 	}
-	printSectionSummary(downloaded, failed)
+	printSectionSummary(s.out, downloaded, failed)
+	printSectionSkipped(s.out, filtered, "filtered out")
 	return userID, firstErr
 }
 
+func (s *session) downloadTagged(ctx context.Context) error {
+	var progress *Progress
+	defer func() {
+		if progress != nil {
+			progress.Finish()
+		}
+	}()
+
+	after := ""
+	firstErr := error(nil)
+	downloaded := 0
+	posts := 0
+	filtered := 0
+	done := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		items, pageInfo, err := s.ig.FetchTaggedPage(ctx, s.username, s.userID, after)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range items {
+			if s.filter.reachedMax(posts) {
+				done = true
+				break
+			}
+			if !s.filter.matchPost(m) {
+				filtered++
+				continue
+			}
+			posts++
+			owner := m.User.Username
+			if owner == "" {
+				owner = "unknown"
+			}
+			jobs := s.filter.filterJobs(timelineMediaJobs(m))
+			if len(jobs) > 0 && progress == nil {
+				progress = NewProgress(s.out, "TAGGED")
+				progress.Start()
+			}
+			if progress != nil {
+				progress.AddTotal(len(jobs))
+			}
+			n, _, err := s.downloadPost(ctx, "tagged", owner, m, jobs, progress)
+			downloaded += n
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		if done || !pageInfo.HasNextPage || pageInfo.EndCursor == "" {
+			break
+		}
+		after = pageInfo.EndCursor
+		time.Sleep(250 * time.Millisecond)
+	}
+
+	failed := 0
+	if progress != nil {
+		failed = progress.Failed()
+		progress.Finish()
+		progress = nil
+	}
+	printSectionSummary(s.out, downloaded, failed)
+	printSectionSkipped(s.out, filtered, "filtered out")
+	return firstErr
+}
+
+// downloadPost saves the media jobs of one post into subdir together with its caption (and
+// comments). With the folder layout, carousels get their own folder and a manifest.json.
+// It returns the number of files saved, whether every job succeeded and the first error.
+func (s *session) downloadPost(ctx context.Context, subdir, label string, m instagram.Media, jobs []timelineMediaJob, progress *Progress) (int, bool, error) {
+	dir := subdir
+	textBase := mediaBaseName(m, label, 0)
+	folder := s.carouselFolders && len(m.CarouselMedia) > 0
+	if folder {
+		dir = filepath.Join(subdir, carouselFolderName(m, label))
+		textBase = "post"
+	}
+
+	downloaded := 0
+	firstErr := error(nil)
+	ok := true
+	files := make(map[int]string, len(jobs))
+	for _, job := range jobs {
+		base := mediaBaseName(job.media, label, job.idx)
+		if folder {
+			base = carouselChildName(job.idx)
+		}
+		name, err := s.downloadMediaAs(ctx, dir, base, job.media)
+		if err != nil {
+			ok = false
+			if firstErr == nil {
+				firstErr = err
+			}
+			if progress != nil {
+				progress.IncFail()
+			}
+			continue
+		}
+		files[job.idx] = name
+		downloaded++
+		if progress != nil {
+			progress.IncOK()
+		}
+	}
+
+	if err := s.savePostText(ctx, dir, textBase, m); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if folder {
+		if err := writeCarouselManifest(ctx, s.store, s.key(dir), newCarouselManifest(m, files)); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return downloaded, ok, firstErr
+}
+
 type timelineMediaJob struct {
 	media instagram.Media
 	idx   int
@@ -183,8 +623,7 @@ func timelineMediaJobs(m instagram.Media) []timelineMediaJob {
 	return jobs
 }
 
-func downloadHighlights(ctx context.Context, ig *instagram.Client, dl *downloader.Downloader, pacer *Pacer, safeUser, username, userID string) error {
-	printSectionHeader(2, 2, "Highlights")
+func (s *session) downloadHighlights(ctx context.Context, sel highlightSelection) error {
 	var progress *Progress
 	defer func() {
 		if progress != nil {
@@ -192,24 +631,33 @@ func downloadHighlights(ctx context.Context, ig *instagram.Client, dl *downloade
 		}
 	}()
 
-	hs, err := ig.FetchHighlightsTray(ctx, username, userID)
+	hs, err := s.ig.FetchHighlightsTray(ctx, s.username, s.userID)
+	if err != nil {
+		return err
+	}
+	// Directory names are derived from the full tray so a highlight keeps the same
+	// folder whether or not it was selected on its own.
+	idToTitle := highlightDirNames(hs)
+	hs, err = sel.apply(hs, s.out)
 	if err != nil {
 		return err
 	}
 	if len(hs) == 0 {
-		printSectionSummary(0, 0)
+		printSectionSummary(s.out, 0, 0)
 		return nil
 	}
 
 	reelIDs := make([]string, 0, len(hs))
+	byID := make(map[string]instagram.Highlight, len(hs))
 	for _, h := range hs {
 		reelIDs = append(reelIDs, h.ID)
+		byID[h.ID] = h
 	}
-	idToTitle := highlightDirNames(hs)
 
 	after := ""
 	firstErr := error(nil)
 	downloaded := 0
+	filtered := 0
 
 	for {
 		select {
@@ -218,7 +666,7 @@ func downloadHighlights(ctx context.Context, ig *instagram.Client, dl *downloade
 		default:
 		}
 
-		reels, pageInfo, err := ig.FetchHighlightsPage(ctx, username, reelIDs, after, 10)
+		reels, pageInfo, err := s.ig.FetchHighlightsPage(ctx, s.username, reelIDs, after, 10)
 		if err != nil {
 			return err
 		}
@@ -229,15 +677,30 @@ func downloadHighlights(ctx context.Context, ig *instagram.Client, dl *downloade
 				title = "highlight"
 			}
 			subdir := filepath.Join("highlights", title)
-			if len(r.Items) > 0 && progress == nil {
-				progress = NewProgress("HIGHLIGHTS")
+			h, ok := byID[r.ID]
+			if !ok {
+				h = instagram.Highlight{ID: r.ID}
+			}
+			if err := s.saveHighlightExtras(ctx, subdir, h, r.Items); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			jobs := make([]timelineMediaJob, 0, len(r.Items))
+			for i, item := range r.Items {
+				if !s.filter.matchItem(item) {
+					filtered++
+					continue
+				}
+				jobs = append(jobs, timelineMediaJob{media: item, idx: i + 1})
+			}
+			if len(jobs) > 0 && progress == nil {
+				progress = NewProgress(s.out, "HIGHLIGHTS")
 				progress.Start()
 			}
 			if progress != nil {
-				progress.AddTotal(len(r.Items))
+				progress.AddTotal(len(jobs))
 			}
-			for i, item := range r.Items {
-				if err := downloadMedia(ctx, dl, pacer, safeUser, subdir, item, i+1); err != nil {
+			for _, job := range jobs {
+				if err := s.downloadMedia(ctx, subdir, job.media, job.idx); err != nil {
 					if firstErr == nil {
 						firstErr = err
 					}
@@ -266,7 +729,8 @@ func downloadHighlights(ctx context.Context, ig *instagram.Client, dl *downloade
 		progress.Finish()
 		progress = nil
 	}
-	printSectionSummary(downloaded, failed)
+	printSectionSummary(s.out, downloaded, failed)
+	printSectionSkipped(s.out, filtered, "filtered out")
 	return firstErr
 }
 
@@ -304,37 +768,44 @@ func highlightDirBaseName(title string) string {
 	return name
 }
 
-func downloadMedia(ctx context.Context, dl *downloader.Downloader, pacer *Pacer, safeUser, subdir string, m instagram.Media, idx int) error {
-	id := m.PK
-	if id == "" {
-		id = m.ID
-	}
-	if id == "" {
-		id = "media"
+func (s *session) downloadMedia(ctx context.Context, subdir string, m instagram.Media, idx int) error {
+	_, err := s.downloadMediaAs(ctx, subdir, mediaBaseName(m, "", idx), m)
+	return err
+}
+
+// downloadMediaAs saves a single photo or video as <subdir>/<base><ext> and returns the
+// name of the file that was written. With --video-covers, videos also get <base>_cover.jpg;
+// with --audio-only, only the audio track of videos is saved.
+func (s *session) downloadMediaAs(ctx context.Context, subdir, base string, m instagram.Media) (string, error) {
+	name, fresh, err := s.saveMedia(ctx, subdir, base, m)
+	s.mediaEvent(subdir, name, fresh, m, err)
+	return name, err
+}
+
+// saveMedia implements downloadMediaAs. fresh is false when the file was already stored.
+func (s *session) saveMedia(ctx context.Context, subdir, base string, m instagram.Media) (string, bool, error) {
+	if s.audioOnly && isVideoMedia(m) {
+		return s.downloadAudio(ctx, subdir, base, m)
 	}
 
-	url := ""
-	isVideo := false
+	video := instagram.VideoSource{}
 	imageURLs := []string(nil)
 
-	if m.MediaType == 2 || m.ProductType == "clips" || m.ProductType == "reels" {
-		url = instagram.BestVideoURL(m)
-		isVideo = true
+	if isVideoMedia(m) {
+		video = instagram.SelectVideo(m, s.quality)
 	}
-	if url == "" {
-		imageURLs = instagram.BestImageURLs(m)
-		if len(imageURLs) > 0 {
-			url = imageURLs[0]
+	isVideo := !video.IsZero()
+	if !isVideo {
+		imageURLs = instagram.SelectImageURLs(m, s.quality)
+		if len(imageURLs) == 0 {
+			return "", false, fmt.Errorf("media %s has no downloadable URL", mediaID(m))
 		}
-		isVideo = false
-	}
-	if url == "" {
-		return fmt.Errorf("media %s has no downloadable URL", id)
 	}
 
 	ext := ""
 	if isVideo {
-		ext = utils.ExtFromURL(url)
+		// Segmented DASH streams are fragmented MP4.
+		ext = utils.ExtFromURL(video.URL)
 		if ext == "" {
 			ext = ".mp4"
 		}
@@ -343,6 +814,147 @@ func downloadMedia(ctx context.Context, dl *downloader.Downloader, pacer *Pacer,
 		ext = ".jpg"
 	}
 
+	name := base + ext
+	rel := filepath.Join(s.safeUser, subdir, name)
+	if isVideo && s.saved(ctx, rel) {
+		return name, false, nil
+	}
+	if !isVideo {
+		if stored, ok := s.savedImage(ctx, rel); ok {
+			return stored, false, nil
+		}
+	}
+
+	if isVideo {
+		if err := waitForDownloadTurn(ctx, s.pacer); err != nil {
+			return "", false, err
+		}
+		if _, err := s.downloadStream(ctx, video.URL, video.Segments, rel); err != nil {
+			return "", false, fmt.Errorf("failed to download %s: %v", name, err)
+		}
+		if err := s.tagMedia(ctx, s.key(subdir, name), m); err != nil {
+			return name, true, err
+		}
+		if s.videoCovers {
+			if err := s.saveVideoCover(ctx, subdir, base, m); err != nil {
+				return name, true, err
+			}
+		}
+		return name, true, nil
+	}
+
+	saved, err := downloadImageCandidates(ctx, s.dl, s.pacer, imageURLs, rel)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to download %s: %v", name, err)
+	}
+	// The image keeps its original extension when it could not be converted.
+	name = path.Base(filepath.ToSlash(saved))
+	if err := s.tagMedia(ctx, s.key(subdir, name), m); err != nil {
+		return name, true, err
+	}
+	return name, true, nil
+}
+
+// downloadStream saves a progressive stream with a single request, or assembles a segmented
+// DASH stream from its segments. It returns the path of the written file.
+func (s *session) downloadStream(ctx context.Context, url string, segments []instagram.DASHSegment, rel string) (string, error) {
+	if len(segments) == 0 {
+		return s.dl.DownloadToFile(ctx, url, rel)
+	}
+	segs := make([]downloader.Segment, 0, len(segments))
+	for _, seg := range segments {
+		segs = append(segs, downloader.Segment{URL: seg.URL, Range: seg.Range})
+	}
+	return s.dl.DownloadSegmentsToFile(ctx, segs, rel)
+}
+
+// downloadAudio saves the audio track of a video as <subdir>/<base>.m4a, tagged with the
+// title and artist of its music or original sound.
+func (s *session) downloadAudio(ctx context.Context, subdir, base string, m instagram.Media) (string, bool, error) {
+	audio := instagram.SelectAudio(m)
+	if audio.IsZero() {
+		return "", false, fmt.Errorf("media %s has no separate audio track", mediaID(m))
+	}
+
+	name := base + ".m4a"
+	rel := filepath.Join(s.safeUser, subdir, name)
+	if s.saved(ctx, rel) {
+		return name, false, nil
+	}
+	if err := waitForDownloadTurn(ctx, s.pacer); err != nil {
+		return "", false, err
+	}
+	key := s.key(subdir, name)
+	title, artist, _ := m.Audio()
+	if title == "" && artist == "" {
+		if _, err := s.downloadStream(ctx, audio.URL, audio.Segments, rel); err != nil {
+			return "", false, fmt.Errorf("failed to download %s: %v", name, err)
+		}
+	} else if err := s.downloadTaggedAudio(ctx, audio, rel, key, mp4.Tags{Title: title, Artist: artist}); err != nil {
+		return "", false, err
+	}
+	if err := s.tagMedia(ctx, key, m); err != nil {
+		return name, true, err
+	}
+	return name, true, nil
+}
+
+// downloadTaggedAudio downloads an audio track to a scratch file and stores it under key
+// once tagged, so that a track that cannot be tagged is not saved at all.
+func (s *session) downloadTaggedAudio(ctx context.Context, audio instagram.AudioSource, rel, key string, tags mp4.Tags) error {
+	name := path.Base(key)
+	scratchRel := filepath.Join(filepath.Dir(rel), "."+name)
+	scratch := path.Join(path.Dir(key), "."+name)
+	defer func() { _ = s.store.Remove(ctx, scratch) }()
+	if _, err := s.downloadStream(ctx, audio.URL, audio.Segments, scratchRel); err != nil {
+		return fmt.Errorf("failed to download %s: %v", name, err)
+	}
+	// Audio tracks are small, so the file is tagged in memory.
+	data, err := storage.ReadFile(ctx, s.store, scratch)
+	if err != nil {
+		return err
+	}
+	tagged, err := mp4.WithTags(data, tags)
+	if err != nil {
+		return fmt.Errorf("unable to tag %s: %v", name, err)
+	}
+	if err := storage.WriteFile(ctx, s.store, key, tagged); err != nil {
+		return err
+	}
+	return s.dl.RecordChecksum(rel, tagged)
+}
+
+// saveVideoCover saves the poster frame of a video as <subdir>/<base>_cover.jpg.
+func (s *session) saveVideoCover(ctx context.Context, subdir, base string, m instagram.Media) error {
+	urls := instagram.SelectImageURLs(m, s.quality)
+	if len(urls) == 0 {
+		return nil
+	}
+	name := base + "_cover.jpg"
+	if _, err := downloadImageCandidates(ctx, s.dl, s.pacer, urls, filepath.Join(s.safeUser, subdir, name)); err != nil {
+		return fmt.Errorf("failed to download %s: %v", name, err)
+	}
+	return nil
+}
+
+func isVideoMedia(m instagram.Media) bool {
+	return m.MediaType == 2 || m.ProductType == "clips" || m.ProductType == "reels"
+}
+
+func mediaID(m instagram.Media) string {
+	id := m.PK
+	if id == "" {
+		id = m.ID
+	}
+	if id == "" {
+		id = "media"
+	}
+	return id
+}
+
+// mediaBaseName returns the filename of a media item without its extension:
+// YYYYMMDD_HHMMSS[_<label>]_<media_id>[_NN].
+func mediaBaseName(m instagram.Media, label string, idx int) string {
 	ts := "unknown"
 	if m.TakenAt > 0 {
 		ts = time.Unix(m.TakenAt, 0).UTC().Format("20060102_150405")
@@ -353,38 +965,31 @@ func downloadMedia(ctx context.Context, dl *downloader.Downloader, pacer *Pacer,
 		part = fmt.Sprintf("_%02d", idx)
 	}
 
-	name := fmt.Sprintf("%s_%s%s%s", ts, id, part, ext)
-	rel := filepath.Join(safeUser, subdir, name)
-
-	if isVideo {
-		if err := waitForDownloadTurn(ctx, pacer); err != nil {
-			return err
-		}
-		if _, err := dl.DownloadToFile(ctx, url, rel); err != nil {
-			return fmt.Errorf("failed to download %s: %v", name, err)
-		}
-		return nil
+	if label != "" {
+		ts += "_" + utils.SanitizePathSegment(label)
 	}
 
+	return fmt.Sprintf("%s_%s%s", ts, mediaID(m), part)
+}
+
+// downloadImageCandidates tries each URL in order until one is saved as a JPEG at rel.
+// It returns the path of the saved file, which keeps the original extension when the
+// image could not be converted.
+func downloadImageCandidates(ctx context.Context, dl *downloader.Downloader, pacer *Pacer, urls []string, rel string) (string, error) {
 	lastErr := error(nil)
-	if len(imageURLs) == 0 {
-		imageURLs = []string{url}
-	}
-	for _, u := range imageURLs {
+	for _, u := range urls {
 		if err := waitForDownloadTurn(ctx, pacer); err != nil {
 			lastErr = err
 			break
 		}
-		if _, err := dl.DownloadImageAsJPEG(ctx, u, rel); err != nil {
+		saved, err := dl.DownloadImageAsJPEG(ctx, u, rel)
+		if err != nil {
 			lastErr = err
 			continue
 		}
-		return nil
+		return saved, nil
 	}
-	if lastErr != nil {
-		return fmt.Errorf("failed to download %s: %v", name, lastErr)
-	}
-	return nil
+	return "", lastErr
 }
 
 func waitForDownloadTurn(ctx context.Context, pacer *Pacer) error {
@@ -2,9 +2,18 @@ package app
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/baptistax/idl/internal/downloader"
 	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/mp4"
 )
 
 func TestTimelineMediaJobsUsesCarouselItemsOnly(t *testing.T) {
@@ -67,7 +76,8 @@ func TestHighlightDirNamesDisambiguatesDuplicateTitles(t *testing.T) {
 func TestDownloadMediaErrorsWhenMediaHasNoURL(t *testing.T) {
 	t.Parallel()
 
-	err := downloadMedia(context.Background(), nil, nil, "user", "posts", instagram.Media{PK: "missing"}, 0)
+	s := &session{safeUser: "user"}
+	err := s.downloadMedia(context.Background(), "posts", instagram.Media{PK: "missing"}, 0)
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -75,3 +85,200 @@ func TestDownloadMediaErrorsWhenMediaHasNoURL(t *testing.T) {
 		t.Fatalf("unexpected error: %q", got)
 	}
 }
+
+func TestDownloadMediaAsSavesVideoCover(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".jpg") {
+			w.Header().Set("Content-Type", "image/jpeg")
+		}
+		_, _ = io.WriteString(w, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	dl := downloader.New(downloader.Options{OutputDir: root, Timeout: 5 * time.Second})
+	s := &session{
+		dl:          dl,
+		store:       dl.Storage(),
+		safeUser:    "user",
+		videoCovers: true,
+	}
+	m := instagram.Media{
+		PK:             "42",
+		TakenAt:        time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC).Unix(),
+		MediaType:      2,
+		VideoVersions:  []instagram.Candidate{{URL: srv.URL + "/clip.mp4", Width: 720, Height: 1280}},
+		ImageVersions2: instagram.ImageVersions2{Candidates: []instagram.Candidate{{URL: srv.URL + "/poster.jpg", Width: 720, Height: 1280}}},
+	}
+
+	name, err := s.downloadMediaAs(context.Background(), "tagged", mediaBaseName(m, "other.user", 0), m)
+	if err != nil {
+		t.Fatalf("downloadMediaAs: %v", err)
+	}
+	if name != "20240304_050607_other.user_42.mp4" {
+		t.Fatalf("unexpected name: %q", name)
+	}
+
+	cover, err := os.ReadFile(filepath.Join(root, "user", "tagged", "20240304_050607_other.user_42_cover.jpg"))
+	if err != nil {
+		t.Fatalf("expected cover: %v", err)
+	}
+	if string(cover) != "/poster.jpg" {
+		t.Fatalf("unexpected cover content: %q", cover)
+	}
+}
+
+func TestDownloadMediaAsAudioOnlySavesTaggedM4A(t *testing.T) {
+	t.Parallel()
+
+	// ftyp + empty moov + mdat
+	m4a := []byte("\x00\x00\x00\x10ftypM4A \x00\x00\x00\x00\x00\x00\x00\x08moov\x00\x00\x00\x0dmdatAUDIO")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(m4a)
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	dl := downloader.New(downloader.Options{OutputDir: root, Timeout: 5 * time.Second})
+	s := &session{
+		dl:        dl,
+		store:     dl.Storage(),
+		safeUser:  "user",
+		audioOnly: true,
+	}
+	m := instagram.Media{
+		PK:          "42",
+		TakenAt:     time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC).Unix(),
+		ProductType: "clips",
+		VideoDashManifest: `<MPD><Period><AdaptationSet contentType="audio" mimeType="audio/mp4">` +
+			`<Representation id="a" bandwidth="64000"><BaseURL>` + srv.URL + `/audio.mp4</BaseURL></Representation>` +
+			`</AdaptationSet></Period></MPD>`,
+		ClipsMetadata: &instagram.ClipsMetadata{OriginalSoundInfo: &instagram.OriginalSoundInfo{
+			OriginalAudioTitle: "Original audio",
+			IGArtist:           instagram.IGUser{Username: "artist"},
+		}},
+	}
+
+	name, err := s.downloadMediaAs(context.Background(), "reels", mediaBaseName(m, "", 0), m)
+	if err != nil {
+		t.Fatalf("downloadMediaAs: %v", err)
+	}
+	if name != "20240304_050607_42.m4a" {
+		t.Fatalf("unexpected name: %q", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "user", "reels", name))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	tags, err := mp4.ReadTags(data)
+	if err != nil {
+		t.Fatalf("ReadTags: %v", err)
+	}
+	if tags.Title != "Original audio" || tags.Artist != "artist" {
+		t.Fatalf("unexpected tags: %+v", tags)
+	}
+}
+
+func TestDownloadMediaAsAudioOnlyFailsWhenTaggingFails(t *testing.T) {
+	t.Parallel()
+
+	// An mdat without moov cannot be tagged.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("\x00\x00\x00\x0dmdatAUDIO"))
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	dl := downloader.New(downloader.Options{OutputDir: root, Timeout: 5 * time.Second})
+	s := &session{dl: dl, store: dl.Storage(), safeUser: "user", audioOnly: true}
+	m := instagram.Media{
+		PK:          "42",
+		ProductType: "clips",
+		VideoDashManifest: `<MPD><Period><AdaptationSet contentType="audio" mimeType="audio/mp4">` +
+			`<Representation id="a" bandwidth="64000"><BaseURL>` + srv.URL + `/audio.mp4</BaseURL></Representation>` +
+			`</AdaptationSet></Period></MPD>`,
+		ClipsMetadata: &instagram.ClipsMetadata{OriginalSoundInfo: &instagram.OriginalSoundInfo{
+			OriginalAudioTitle: "Original audio",
+		}},
+	}
+
+	if _, err := s.downloadMediaAs(context.Background(), "reels", mediaBaseName(m, "", 0), m); err == nil {
+		t.Fatal("expected a tagging error")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "user", "reels")); len(entries) != 0 {
+		t.Fatalf("untagged audio left behind: %v", entries)
+	}
+}
+
+func TestDownloadMediaAsSkipsExistingFiles(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = io.WriteString(w, "fresh")
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	dl := downloader.New(downloader.Options{OutputDir: root, Timeout: 5 * time.Second})
+	s := &session{dl: dl, store: dl.Storage(), safeUser: "user", skipExisting: true}
+	m := instagram.Media{
+		PK:            "42",
+		TakenAt:       time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC).Unix(),
+		MediaType:     2,
+		VideoVersions: []instagram.Candidate{{URL: srv.URL + "/clip.mp4", Width: 720, Height: 1280}},
+	}
+
+	path := filepath.Join(root, "user", "posts", "20240304_050607_42.mp4")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("kept"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	name, err := s.downloadMediaAs(context.Background(), "posts", mediaBaseName(m, "", 0), m)
+	if err != nil || name != "20240304_050607_42.mp4" {
+		t.Fatalf("downloadMediaAs: name=%q err=%v", name, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "kept" || requests != 0 {
+		t.Fatalf("existing file was downloaded again: content=%q requests=%d", data, requests)
+	}
+}
+
+func TestDownloadMediaAsSkipsImagesStoredInTheirOwnFormat(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	dl := downloader.New(downloader.Options{OutputDir: root, Timeout: 5 * time.Second})
+	s := &session{dl: dl, store: dl.Storage(), safeUser: "user", skipExisting: true}
+	m := instagram.Media{
+		PK:             "42",
+		TakenAt:        time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC).Unix(),
+		MediaType:      1,
+		ImageVersions2: instagram.ImageVersions2{Candidates: []instagram.Candidate{{URL: srv.URL + "/photo.webp", Width: 1080, Height: 1080}}},
+	}
+	// A WebP image that could not be converted to JPEG keeps its extension.
+	path := filepath.Join(root, "user", "posts", "20240304_050607_42.webp")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("kept"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	name, err := s.downloadMediaAs(context.Background(), "posts", mediaBaseName(m, "", 0), m)
+	if err != nil || name != "20240304_050607_42.webp" || requests != 0 {
+		t.Fatalf("downloadMediaAs: name=%q err=%v requests=%d", name, err, requests)
+	}
+}
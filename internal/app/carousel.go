@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/storage"
+	"github.com/baptistax/idl/internal/utils"
+)
+
+// carouselManifest is written as manifest.json inside each carousel folder.
+type carouselManifest struct {
+	ID           string          `json:"id"`
+	Code         string          `json:"code,omitempty"`
+	TakenAt      int64           `json:"taken_at,omitempty"`
+	Owner        string          `json:"owner,omitempty"`
+	ProductType  string          `json:"product_type,omitempty"`
+	Caption      string          `json:"caption,omitempty"`
+	LikeCount    int64           `json:"like_count"`
+	CommentCount int64           `json:"comment_count"`
+	Children     []carouselChild `json:"children"`
+}
+
+type carouselChild struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	// File is empty when the child was filtered out or failed to download.
+	File string `json:"file,omitempty"`
+}
+
+// carouselFolderName names the folder of a carousel after its date and shortcode:
+// YYYYMMDD_HHMMSS[_<label>]_<shortcode>.
+func carouselFolderName(m instagram.Media, label string) string {
+	ts := "unknown"
+	if m.TakenAt > 0 {
+		ts = time.Unix(m.TakenAt, 0).UTC().Format("20060102_150405")
+	}
+	if label != "" {
+		ts += "_" + utils.SanitizePathSegment(label)
+	}
+	code := m.Code
+	if code == "" {
+		code = mediaID(m)
+	}
+	return ts + "_" + utils.SanitizePathSegment(code)
+}
+
+// carouselChildName is the filename (without extension) of a child inside its carousel folder.
+func carouselChildName(idx int) string {
+	return fmt.Sprintf("%02d", idx)
+}
+
+// newCarouselManifest records every child in carousel order. files maps a 1-based child
+// index to the name of the file that was saved for it.
+func newCarouselManifest(m instagram.Media, files map[int]string) carouselManifest {
+	man := carouselManifest{
+		ID:           mediaID(m),
+		Code:         m.Code,
+		TakenAt:      m.TakenAt,
+		Owner:        m.User.Username,
+		ProductType:  m.ProductType,
+		Caption:      m.CaptionText(),
+		LikeCount:    m.LikeCount,
+		CommentCount: m.CommentCount,
+		Children:     make([]carouselChild, 0, len(m.CarouselMedia)),
+	}
+	for i, cm := range m.CarouselMedia {
+		typ := "photo"
+		if isVideoMedia(cm) {
+			typ = "video"
+		}
+		man.Children = append(man.Children, carouselChild{
+			Index: i + 1,
+			ID:    mediaID(cm),
+			Type:  typ,
+			File:  files[i+1],
+		})
+	}
+	return man
+}
+
+func writeCarouselManifest(ctx context.Context, store storage.Storage, dirKey string, man carouselManifest) error {
+	data, err := json.MarshalIndent(man, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := storage.WriteFile(ctx, store, path.Join(dirKey, "manifest.json"), data); err != nil {
+		return fmt.Errorf("unable to save carousel manifest for %s: %v", man.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/baptistax/idl/internal/instagram"
+)
+
+func TestCarouselFolderName(t *testing.T) {
+	t.Parallel()
+
+	m := instagram.Media{PK: "123", Code: "Cabc", TakenAt: 1700000000}
+	if got := carouselFolderName(m, ""); got != "20231114_221320_Cabc" {
+		t.Fatalf("unexpected folder name: %q", got)
+	}
+	if got := carouselFolderName(m, "owner"); got != "20231114_221320_owner_Cabc" {
+		t.Fatalf("unexpected labeled folder name: %q", got)
+	}
+	m.Code = ""
+	if got := carouselFolderName(m, ""); got != "20231114_221320_123" {
+		t.Fatalf("expected id fallback, got %q", got)
+	}
+}
+
+func TestNewCarouselManifestListsEveryChild(t *testing.T) {
+	t.Parallel()
+
+	m := instagram.Media{
+		PK:        "p1",
+		Code:      "Cabc",
+		TakenAt:   1700000000,
+		LikeCount: 7,
+		CarouselMedia: []instagram.Media{
+			{PK: "c1"},
+			{PK: "c2", MediaType: 2},
+			{PK: "c3"},
+		},
+	}
+
+	man := newCarouselManifest(m, map[int]string{1: "01.jpg", 2: "02.mp4"})
+	if man.ID != "p1" || man.Code != "Cabc" || man.LikeCount != 7 {
+		t.Fatalf("unexpected parent: %+v", man)
+	}
+	if len(man.Children) != 3 {
+		t.Fatalf("expected 3 children, got %d", len(man.Children))
+	}
+	if c := man.Children[1]; c.Index != 2 || c.ID != "c2" || c.Type != "video" || c.File != "02.mp4" {
+		t.Fatalf("unexpected second child: %+v", c)
+	}
+	if c := man.Children[2]; c.Index != 3 || c.Type != "photo" || c.File != "" {
+		t.Fatalf("expected missing third file, got %+v", c)
+	}
+}
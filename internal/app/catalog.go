@@ -0,0 +1,353 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baptistax/idl/internal/storage"
+)
+
+// Sections of a user archive, in the order they are shown.
+const (
+	sectionPosts  = "posts"
+	sectionReels  = "reels"
+	sectionTagged = "tagged"
+)
+
+// catalog describes what has been downloaded for a user. It is rebuilt from the files in
+// storage, so it works for archives written by any earlier version of idl.
+type catalog struct {
+	User       string
+	Profile    *profileSnapshot
+	ProfilePic string
+	Posts      []archivePost
+	Highlights []archiveHighlight
+}
+
+// archivePost is one post, reel or tagged post. Keys are relative to the user directory.
+type archivePost struct {
+	ID      string    `json:"id"`
+	Code    string    `json:"code,omitempty"`
+	Section string    `json:"section"`
+	Owner   string    `json:"owner,omitempty"`
+	TakenAt time.Time `json:"taken_at"`
+	Caption string    `json:"caption,omitempty"`
+	// PlayCount comes from the metadata of reels (0 when unknown).
+	PlayCount int64         `json:"play_count,omitempty"`
+	Items     []archiveItem `json:"items"`
+}
+
+type archiveItem struct {
+	Key  string `json:"file"`
+	Type string `json:"type"`
+	// Poster is the cover image of a video, if one was saved.
+	Poster string `json:"poster,omitempty"`
+}
+
+type archiveHighlight struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+	// Position is the 1-based order of the highlight in the profile tray, 0 when unknown.
+	Position int           `json:"position,omitempty"`
+	Cover    string        `json:"cover,omitempty"`
+	Items    []archiveItem `json:"items"`
+}
+
+// Types of archived media files.
+const (
+	itemImage = "image"
+	itemVideo = "video"
+	itemAudio = "audio"
+)
+
+func archiveItemType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".webp":
+		return itemImage
+	case ".mp4":
+		return itemVideo
+	case ".m4a":
+		return itemAudio
+	}
+	return ""
+}
+
+// archivedName matches YYYYMMDD_HHMMSS[_label]_<id>[_NN], the basename of saved media.
+var archivedName = regexp.MustCompile(`^(\d{8}_\d{6}|unknown)_(?:(.+)_)?(\d{3,})(?:_(\d{2}))?$`)
+
+type savedName struct {
+	ts, label, id string
+	idx           int
+}
+
+func parseArchivedName(base string) (savedName, bool) {
+	m := archivedName.FindStringSubmatch(base)
+	if m == nil {
+		return savedName{}, false
+	}
+	idx, _ := strconv.Atoi(m[4])
+	return savedName{ts: m[1], label: m[2], id: m[3], idx: idx}, true
+}
+
+func (n savedName) takenAt() time.Time {
+	t, err := time.Parse("20060102_150405", n.ts)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// loadCatalog scans the archive of safeUser. Posts are sorted newest first.
+func loadCatalog(ctx context.Context, store storage.Storage, safeUser string) (*catalog, error) {
+	files, err := store.List(ctx, safeUser+"/")
+	if err != nil {
+		return nil, err
+	}
+	c := &catalog{User: safeUser}
+	dirs := map[string][]string{}
+	var dirOrder []string
+	for _, f := range files {
+		rel := strings.TrimPrefix(f.Key, safeUser+"/")
+		if strings.HasPrefix(path.Base(rel), ".") {
+			continue
+		}
+		dir := path.Dir(rel)
+		if _, ok := dirs[dir]; !ok {
+			dirOrder = append(dirOrder, dir)
+		}
+		dirs[dir] = append(dirs[dir], path.Base(rel))
+	}
+
+	if data, err := storage.ReadFile(ctx, store, userKey(safeUser, profileLatestFile)); err == nil {
+		var snap profileSnapshot
+		if json.Unmarshal(data, &snap) == nil {
+			c.Profile = &snap
+		}
+	}
+	if pics := dirs[profilePicDir]; len(pics) > 0 {
+		// Names start with the capture time, so the last one is the current avatar.
+		c.ProfilePic = path.Join(profilePicDir, pics[len(pics)-1])
+	}
+
+	for _, dir := range dirOrder {
+		section, rest, _ := strings.Cut(dir, "/")
+		switch {
+		case section == "highlights" && rest != "" && !strings.Contains(rest, "/"):
+			c.Highlights = append(c.Highlights, loadArchiveHighlight(ctx, store, safeUser, dir, dirs[dir]))
+		case section != sectionPosts && section != sectionReels && section != sectionTagged:
+		case rest == "":
+			c.Posts = append(c.Posts, loadArchivePosts(ctx, store, safeUser, section, dirs[dir])...)
+		case !strings.Contains(rest, "/"):
+			if p, ok := loadCarouselFolder(ctx, store, safeUser, section, dir, dirs[dir]); ok {
+				c.Posts = append(c.Posts, p)
+			}
+		}
+	}
+	sort.SliceStable(c.Posts, func(i, j int) bool { return c.Posts[i].TakenAt.After(c.Posts[j].TakenAt) })
+	sort.SliceStable(c.Highlights, func(i, j int) bool { return c.Highlights[i].before(c.Highlights[j]) })
+	return c, nil
+}
+
+// loadArchivePosts groups the flat files of a section directory into posts. Carousel
+// children are named after their own media id with a _NN suffix, so they are grouped by
+// timestamp and label; the caption is named after the parent post.
+func loadArchivePosts(ctx context.Context, store storage.Storage, safeUser, section string, names []string) []archivePost {
+	present := map[string]bool{}
+	for _, name := range names {
+		present[name] = true
+	}
+
+	type group struct {
+		carousel *archivePost
+		seen     map[int]bool
+		singles  map[string]*archivePost
+	}
+	groups := map[string]*group{}
+	var order []*archivePost
+	byID := map[string]*archivePost{}
+	for _, name := range names {
+		typ := archiveItemType(name)
+		base := strings.TrimSuffix(name, path.Ext(name))
+		if typ == "" || strings.HasSuffix(base, "_cover") {
+			continue
+		}
+		n, ok := parseArchivedName(base)
+		if !ok {
+			continue
+		}
+		gk := n.ts + "/" + n.label
+		g := groups[gk]
+		if g == nil {
+			g = &group{singles: map[string]*archivePost{}}
+			groups[gk] = g
+		}
+		item := archiveItem{Key: path.Join(section, name), Type: typ}
+		if cover := base + "_cover.jpg"; typ == itemVideo && present[cover] {
+			item.Poster = path.Join(section, cover)
+		}
+
+		p := g.singles[n.id]
+		if n.idx > 0 {
+			p = g.carousel
+			if p != nil && g.seen[n.idx] {
+				// Two carousels share the timestamp (or have none): start another one.
+				p, g.seen = nil, nil
+			}
+			if g.seen == nil {
+				g.seen = map[int]bool{}
+			}
+			g.seen[n.idx] = true
+		}
+		if p == nil {
+			p = &archivePost{ID: n.id, Section: section, Owner: n.label, TakenAt: n.takenAt()}
+			if n.idx > 0 {
+				g.carousel = p
+			} else {
+				g.singles[n.id] = p
+				byID[n.id] = p
+			}
+			order = append(order, p)
+		}
+		p.Items = append(p.Items, item)
+	}
+
+	for _, name := range names {
+		if path.Ext(name) != ".txt" && path.Ext(name) != ".json" {
+			continue
+		}
+		base := strings.TrimSuffix(name, path.Ext(name))
+		n, ok := parseArchivedName(base)
+		if !ok {
+			continue
+		}
+		p := byID[n.id]
+		if p == nil {
+			if g := groups[n.ts+"/"+n.label]; g != nil && g.carousel != nil {
+				p = g.carousel
+				p.ID = n.id
+			}
+		}
+		if p == nil {
+			continue
+		}
+		data, err := storage.ReadFile(ctx, store, userKey(safeUser, section, name))
+		if err != nil {
+			continue
+		}
+		if path.Ext(name) == ".txt" {
+			p.Caption = strings.TrimSpace(string(data))
+			continue
+		}
+		var meta reelMetadata
+		if json.Unmarshal(data, &meta) == nil && meta.ID != "" {
+			p.Code = meta.Code
+			p.PlayCount = meta.PlayCount
+		}
+	}
+
+	out := make([]archivePost, 0, len(order))
+	for _, p := range order {
+		out = append(out, *p)
+	}
+	return out
+}
+
+// loadCarouselFolder reads a carousel saved with --layout folders.
+func loadCarouselFolder(ctx context.Context, store storage.Storage, safeUser, section, dir string, names []string) (archivePost, bool) {
+	man := readCarouselManifest(ctx, store, userKey(safeUser, dir))
+	if man == nil {
+		return archivePost{}, false
+	}
+	p := archivePost{
+		ID:      man.ID,
+		Code:    man.Code,
+		Section: section,
+		Owner:   man.Owner,
+		Caption: man.Caption,
+	}
+	if man.TakenAt > 0 {
+		p.TakenAt = time.Unix(man.TakenAt, 0).UTC()
+	}
+	present := map[string]bool{}
+	for _, name := range names {
+		present[name] = true
+	}
+	for _, child := range man.Children {
+		if child.File == "" || !present[child.File] {
+			continue
+		}
+		item := archiveItem{Key: path.Join(dir, child.File), Type: archiveItemType(child.File)}
+		if cover := strings.TrimSuffix(child.File, path.Ext(child.File)) + "_cover.jpg"; present[cover] {
+			item.Poster = path.Join(dir, cover)
+		}
+		p.Items = append(p.Items, item)
+	}
+	return p, len(p.Items) > 0
+}
+
+// before orders highlights as in the profile tray; highlights without a position follow,
+// newest first.
+func (h archiveHighlight) before(o archiveHighlight) bool {
+	if (h.Position > 0) != (o.Position > 0) {
+		return h.Position > 0
+	}
+	if h.Position != o.Position {
+		return h.Position < o.Position
+	}
+	return h.CreatedAt.After(o.CreatedAt)
+}
+
+// loadArchiveHighlight reads a highlights/<title>/ folder. Items keep their saved order.
+func loadArchiveHighlight(ctx context.Context, store storage.Storage, safeUser, dir string, names []string) archiveHighlight {
+	h := archiveHighlight{Title: path.Base(dir)}
+	cover := ""
+	if data, err := storage.ReadFile(ctx, store, userKey(safeUser, dir, "highlight.json")); err == nil {
+		var meta highlightMetadata
+		if json.Unmarshal(data, &meta) == nil {
+			h.ID = meta.ID
+			if meta.Title != "" {
+				h.Title = meta.Title
+			}
+			if meta.CreatedAt > 0 {
+				h.CreatedAt = time.Unix(meta.CreatedAt, 0).UTC()
+			}
+			h.Position = meta.Position
+			cover = meta.Cover
+		}
+	}
+	present := map[string]bool{}
+	for _, name := range names {
+		present[name] = true
+		// The cover is saved as cover.jpg, or with its own extension when it could not
+		// be converted; highlight.json names it when it is there.
+		if cover == "" && strings.TrimSuffix(name, path.Ext(name)) == "cover" {
+			cover = name
+		}
+	}
+	if present[cover] {
+		h.Cover = path.Join(dir, cover)
+	}
+	for _, name := range names {
+		typ := archiveItemType(name)
+		base := strings.TrimSuffix(name, path.Ext(name))
+		if typ == "" || base == "cover" || strings.HasSuffix(base, "_cover") {
+			continue
+		}
+		item := archiveItem{Key: path.Join(dir, name), Type: typ}
+		if cover := base + "_cover.jpg"; typ == itemVideo && present[cover] {
+			item.Poster = path.Join(dir, cover)
+		}
+		h.Items = append(h.Items, item)
+	}
+	if h.Cover == "" && len(h.Items) > 0 && h.Items[0].Type == itemImage {
+		h.Cover = h.Items[0].Key
+	}
+	return h
+}
@@ -0,0 +1,157 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/storage"
+)
+
+// savePostText writes the caption of a post and, with --comments, its comment thread
+// next to the post's media.
+func (s *session) savePostText(ctx context.Context, subdir, base string, m instagram.Media) error {
+	if err := s.saveCaption(ctx, subdir, base, m); err != nil {
+		return err
+	}
+	if s.comments {
+		return s.saveComments(ctx, subdir, base, m)
+	}
+	return nil
+}
+
+// saveCaption writes the post caption to <subdir>/<base>.txt. Posts without a caption are skipped.
+func (s *session) saveCaption(ctx context.Context, subdir, base string, m instagram.Media) error {
+	text := strings.TrimSpace(m.CaptionText())
+	if text == "" {
+		return nil
+	}
+	if err := storage.WriteFile(ctx, s.store, s.key(subdir, base+".txt"), []byte(text+"\n")); err != nil {
+		return fmt.Errorf("unable to save %s: %v", base+".txt", err)
+	}
+	return nil
+}
+
+// commentsFile is written as <base>_comments.json when --comments is set.
+type commentsFile struct {
+	MediaID   string          `json:"media_id"`
+	Code      string          `json:"code,omitempty"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	Count     int             `json:"count"`
+	Comments  []commentRecord `json:"comments"`
+}
+
+type commentRecord struct {
+	ID        string          `json:"id"`
+	Author    string          `json:"author"`
+	AuthorID  string          `json:"author_id,omitempty"`
+	CreatedAt int64           `json:"created_at"`
+	LikeCount int64           `json:"like_count"`
+	Text      string          `json:"text"`
+	Replies   []commentRecord `json:"replies,omitempty"`
+}
+
+func newCommentRecord(c instagram.Comment) commentRecord {
+	return commentRecord{
+		ID:        c.PK,
+		Author:    c.User.Username,
+		AuthorID:  c.User.PK,
+		CreatedAt: c.CreatedAt,
+		LikeCount: c.LikeCount,
+		Text:      c.Text,
+	}
+}
+
+// saveComments pages through every comment and threaded reply on a post and writes them
+// to <subdir>/<base>_comments.json. With --skip-existing, posts whose comments were already
+// saved are not fetched again.
+func (s *session) saveComments(ctx context.Context, subdir, base string, m instagram.Media) error {
+	if m.PK == "" {
+		return nil
+	}
+	if s.saved(ctx, filepath.Join(s.safeUser, subdir, base+"_comments.json")) {
+		return nil
+	}
+
+	records := []commentRecord(nil)
+	total := 0
+	after := ""
+	for {
+		comments, pageInfo, err := s.ig.FetchCommentsPage(ctx, m.PK, m.Code, after)
+		if err != nil {
+			return fmt.Errorf("failed to fetch comments for %s: %v", mediaID(m), err)
+		}
+		for _, c := range comments {
+			rec := newCommentRecord(c)
+			if c.ChildCommentCount > 0 {
+				replies, err := s.fetchReplies(ctx, m, c.PK)
+				if err != nil {
+					return err
+				}
+				rec.Replies = replies
+				total += len(replies)
+			}
+			records = append(records, rec)
+			total++
+		}
+		if !pageInfo.HasNextPage || pageInfo.EndCursor == "" {
+			break
+		}
+		after = pageInfo.EndCursor
+		if err := sleepContext(ctx, 250*time.Millisecond); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(commentsFile{
+		MediaID:   m.PK,
+		Code:      m.Code,
+		FetchedAt: time.Now().UTC(),
+		Count:     total,
+		Comments:  records,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := storage.WriteFile(ctx, s.store, s.key(subdir, base+"_comments.json"), data); err != nil {
+		return fmt.Errorf("unable to save %s: %v", base+"_comments.json", err)
+	}
+	return nil
+}
+
+func (s *session) fetchReplies(ctx context.Context, m instagram.Media, parentID string) ([]commentRecord, error) {
+	var out []commentRecord
+	after := ""
+	for {
+		replies, pageInfo, err := s.ig.FetchCommentRepliesPage(ctx, m.PK, m.Code, parentID, after)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch replies for comment %s: %v", parentID, err)
+		}
+		for _, r := range replies {
+			out = append(out, newCommentRecord(r))
+		}
+		if !pageInfo.HasNextPage || pageInfo.EndCursor == "" {
+			return out, nil
+		}
+		after = pageInfo.EndCursor
+		if err := sleepContext(ctx, 250*time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baptistax/idl/internal/downloader"
+	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/storage"
+)
+
+func TestSaveCaptionWritesTextFileNextToMedia(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	s := &session{store: storage.NewFS(root), safeUser: "user"}
+	m := instagram.Media{PK: "1", Caption: &instagram.Caption{Text: "  Hello #launch  "}}
+
+	if err := s.saveCaption(context.Background(), "posts", "20240101_000000_1", m); err != nil {
+		t.Fatalf("saveCaption: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "user", "posts", "20240101_000000_1.txt"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(data) != "Hello #launch\n" {
+		t.Fatalf("unexpected caption file: %q", data)
+	}
+
+	if err := s.saveCaption(context.Background(), "posts", "no_caption", instagram.Media{PK: "2"}); err != nil {
+		t.Fatalf("saveCaption without caption: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "user", "posts", "no_caption.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected no file for empty caption, got err=%v", err)
+	}
+}
+
+// redirectTransport sends every request to a test server instead of Instagram.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = rt.target.Scheme
+	r.URL.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// fakeInstagram returns a client whose requests are answered by graphql, keyed by the
+// friendly name of the query, and a function counting the GraphQL requests.
+func fakeInstagram(t *testing.T, graphql func(name string, vars map[string]string) string) (*instagram.Client, func() int) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/" {
+			fmt.Fprint(w, `<script>{"lsd":"token","fb_dtsg":"dtsg"}</script>`)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		vars := map[string]string{}
+		var raw map[string]any
+		_ = json.Unmarshal([]byte(r.PostForm.Get("variables")), &raw)
+		for k, v := range raw {
+			if s, ok := v.(string); ok {
+				vars[k] = s
+			}
+		}
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		fmt.Fprint(w, graphql(r.PostForm.Get("fb_api_req_friendly_name"), vars))
+	}))
+	t.Cleanup(ts.Close)
+
+	cookies := filepath.Join(t.TempDir(), "cookies.txt")
+	if err := os.WriteFile(cookies, []byte(".instagram.com\tTRUE\t/\tTRUE\t0\tsessionid\tabc\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	target, _ := url.Parse(ts.URL)
+	ig, err := instagram.NewClient(instagram.Options{CookiesPath: cookies, Transport: redirectTransport{target: target}})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return ig, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+// commentsPage renders a GraphQL comments page; connection is the name of the connection.
+func commentsPage(connection string, cursor string, comments ...string) string {
+	edges := make([]string, 0, len(comments))
+	for _, c := range comments {
+		id, replies, _ := strings.Cut(c, ":")
+		if replies == "" {
+			replies = "0"
+		}
+		edges = append(edges, fmt.Sprintf(`{"node":{"pk":%q,"text":"text %s","child_comment_count":%s,"user":{"username":"fan"}}}`, id, id, replies))
+	}
+	return fmt.Sprintf(`{"status":"ok","data":{%q:{"edges":[%s],"page_info":{"end_cursor":%q,"has_next_page":%t}}}}`,
+		connection, strings.Join(edges, ","), cursor, cursor != "")
+}
+
+func TestSaveCommentsPagesThroughCommentsAndReplies(t *testing.T) {
+	t.Parallel()
+
+	const top = "xdt_api__v1__media__media_id__comments__connection"
+	const child = "xdt_api__v1__media__media_id__comments__parent_comment_id__child_comments__connection"
+	ig, requests := fakeInstagram(t, func(name string, vars map[string]string) string {
+		switch name + " " + vars["parent_comment_id"] + " " + vars["after"] {
+		case "PolarisPostCommentsPaginationQuery  ":
+			return commentsPage(top, "page2", "c1:3", "c2")
+		case "PolarisPostCommentsPaginationQuery  page2":
+			return commentsPage(top, "", "c3")
+		case "PolarisPostChildCommentsPaginationQuery c1 ":
+			return commentsPage(child, "replies2", "r1", "r2")
+		case "PolarisPostChildCommentsPaginationQuery c1 replies2":
+			return commentsPage(child, "", "r3")
+		}
+		t.Errorf("unexpected query %s %v", name, vars)
+		return `{"status":"fail","message":"unexpected"}`
+	})
+
+	root := t.TempDir()
+	dl := downloader.New(downloader.Options{OutputDir: root, Timeout: 5 * time.Second})
+	s := &session{ig: ig, dl: dl, store: dl.Storage(), safeUser: "user", comments: true, skipExisting: true}
+	m := instagram.Media{PK: "42", Code: "abc"}
+	if err := s.saveComments(context.Background(), "posts", "base", m); err != nil {
+		t.Fatalf("saveComments: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "user", "posts", "base_comments.json"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var f commentsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var ids []string
+	for _, c := range f.Comments {
+		ids = append(ids, c.ID)
+		for _, r := range c.Replies {
+			ids = append(ids, c.ID+"/"+r.ID)
+		}
+	}
+	if got, want := strings.Join(ids, " "), "c1 c1/r1 c1/r2 c1/r3 c2 c3"; got != want || f.Count != 6 {
+		t.Fatalf("comments = %s (count %d), want %s", got, f.Count, want)
+	}
+	if n := requests(); n != 4 {
+		t.Fatalf("%d GraphQL requests, want 4", n)
+	}
+
+	// With --skip-existing, saved comments are not fetched again.
+	if err := s.saveComments(context.Background(), "posts", "base", m); err != nil {
+		t.Fatalf("saveComments again: %v", err)
+	}
+	if n := requests(); n != 4 {
+		t.Fatalf("comments fetched again: %d requests", n)
+	}
+}
@@ -0,0 +1,504 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/notify"
+	"github.com/baptistax/idl/internal/utils"
+)
+
+// Job states.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// finishedJobLimit caps the finished jobs kept in the state file.
+const finishedJobLimit = 500
+
+// JobRequest is the body of POST /jobs. Every field but Target is optional; the filters
+// mean the same as the download flags of the same name.
+type JobRequest struct {
+	Target string `json:"target"`
+	// Content selects the stages to run: posts, reels, tagged, highlights (default all).
+	Content      []string `json:"content,omitempty"`
+	Since        string   `json:"since,omitempty"`
+	Until        string   `json:"until,omitempty"`
+	MaxPosts     int      `json:"max_posts,omitempty"`
+	OnlyVideos   bool     `json:"only_videos,omitempty"`
+	OnlyPhotos   bool     `json:"only_photos,omitempty"`
+	ProductTypes []string `json:"product_types,omitempty"`
+	Filter       string   `json:"filter,omitempty"`
+	Highlights   []string `json:"highlights,omitempty"`
+	HighlightIDs []string `json:"highlight_ids,omitempty"`
+	Comments     bool     `json:"comments,omitempty"`
+	SkipExisting bool     `json:"skip_existing,omitempty"`
+}
+
+// Job is a queued or finished download, as returned by the API and kept in the state file.
+type Job struct {
+	ID         string     `json:"id"`
+	Request    JobRequest `json:"request"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Stage      string     `json:"stage,omitempty"`
+	Saved      int        `json:"saved"`
+	Failed     int        `json:"failed"`
+	Skipped    int        `json:"skipped"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func (j *Job) finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// Daemon runs queued jobs over a REST API. All jobs share one Instagram session and one
+// Pacer, and at most cfg.Workers jobs run at once. Jobs of the same target run one after the
+// other, since concurrent runs would rewrite the same checksum manifests. Finished jobs are
+// reported to the --notify sinks.
+func Daemon(ctx context.Context, cfg config.Config) error {
+	// Cancelling the jobs' context stops running jobs before waiting for them, whatever ends
+	// the server.
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	ig, err := newInstagramClient(cfg)
+	if err != nil {
+		return err
+	}
+	pacer := newDefaultPacer()
+	pacer.Start()
+	defer pacer.Stop()
+
+	d, err := newDaemon(ctx, cfg, func(ctx context.Context, cfg config.Config, opts RunOptions) error {
+		opts.Client = ig
+		opts.Pacer = pacer
+		return RunWith(ctx, cfg, opts)
+	})
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+	printBanner(os.Stdout)
+	printKV(os.Stdout, "Output", cfg.OutputRoot)
+	printKV(os.Stdout, "State", cfg.StatePath)
+	printKV(os.Stdout, "Workers", strconv.Itoa(cfg.Workers))
+	printKV(os.Stdout, "Listening", "http://"+displayAddr(ln.Addr()))
+
+	d.mu.Lock()
+	d.scheduleLocked()
+	d.mu.Unlock()
+
+	hs := &http.Server{Handler: d, ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 1)
+	go func() { errc <- hs.Serve(ln) }()
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = hs.Shutdown(shutdownCtx)
+	// Running jobs stop with ctx; they are queued again on the next start.
+	stop()
+	d.wait()
+	return err
+}
+
+// daemon implements Daemon.
+type daemon struct {
+	ctx       context.Context
+	cfg       config.Config
+	run       func(ctx context.Context, cfg config.Config, opts RunOptions) error
+	mux       *http.ServeMux
+	statePath string
+	notify    *notify.Notifier
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	order   []string
+	cancels map[string]context.CancelFunc
+	active  int
+	// running holds the targets with a running job.
+	running map[string]bool
+	wg      sync.WaitGroup
+}
+
+func newDaemon(ctx context.Context, cfg config.Config, run func(context.Context, config.Config, RunOptions) error) (*daemon, error) {
+	d := &daemon{
+		ctx:       ctx,
+		cfg:       cfg,
+		run:       run,
+		mux:       http.NewServeMux(),
+		statePath: cfg.StatePath,
+		jobs:      map[string]*Job{},
+		cancels:   map[string]context.CancelFunc{},
+		running:   map[string]bool{},
+	}
+	if d.cfg.Workers <= 0 {
+		d.cfg.Workers = 1
+	}
+	var err error
+	if d.notify, err = newNotifier(cfg); err != nil {
+		return nil, err
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	d.mux.HandleFunc("POST /jobs", d.handleCreate)
+	d.mux.HandleFunc("GET /jobs", d.handleList)
+	d.mux.HandleFunc("GET /jobs/{id}", d.handleGet)
+	d.mux.HandleFunc("DELETE /jobs/{id}", d.handleCancel)
+	return d, nil
+}
+
+// ServeHTTP requires the bearer token on every request and rejects requests from pages of
+// other sites, so that a browser on the network cannot queue downloads with the daemon's
+// Instagram session.
+func (d *daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if crossSite(r) {
+		http.Error(w, "cross-site requests are not allowed", http.StatusForbidden)
+		return
+	}
+	if !tokenMatches(bearerToken(r), d.cfg.Token) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="idl"`)
+		http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+		return
+	}
+	d.mux.ServeHTTP(w, r)
+}
+
+func (d *daemon) wait() {
+	d.wg.Wait()
+}
+
+// load reads the state file. Jobs that were running when the daemon stopped are queued
+// again.
+func (d *daemon) load() error {
+	data, err := os.ReadFile(d.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read job state: %v", err)
+	}
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return fmt.Errorf("invalid job state %s: %v", d.statePath, err)
+	}
+	for _, j := range jobs {
+		if j.Status == JobRunning {
+			j.Status = JobQueued
+			j.StartedAt = nil
+		}
+		d.jobs[j.ID] = j
+		d.order = append(d.order, j.ID)
+	}
+	return nil
+}
+
+// saveLocked writes the state file, dropping the oldest finished jobs beyond
+// finishedJobLimit.
+func (d *daemon) saveLocked() {
+	finished := 0
+	for i := len(d.order) - 1; i >= 0; i-- {
+		id := d.order[i]
+		if !d.jobs[id].finished() {
+			continue
+		}
+		if finished++; finished > finishedJobLimit {
+			delete(d.jobs, id)
+			d.order = append(d.order[:i], d.order[i+1:]...)
+		}
+	}
+
+	jobs := make([]*Job, 0, len(d.order))
+	for _, id := range d.order {
+		jobs = append(jobs, d.jobs[id])
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err == nil {
+		data = append(data, '\n')
+		err = utils.WriteFileAtomic(d.statePath, data)
+	}
+	if err != nil {
+		log.Printf("unable to save job state: %v", err)
+	}
+}
+
+// scheduleLocked starts queued jobs, oldest first, while the limits allow.
+func (d *daemon) scheduleLocked() {
+	if d.ctx.Err() != nil {
+		return
+	}
+	for _, id := range d.order {
+		if d.active >= d.cfg.Workers {
+			break
+		}
+		j := d.jobs[id]
+		target := strings.ToLower(j.Request.Target)
+		if j.Status != JobQueued || d.running[target] {
+			continue
+		}
+		cfg, err := d.jobConfig(j.Request)
+		if err != nil {
+			// The request was valid when queued; the daemon flags may have changed since.
+			d.finishLocked(j, err)
+			continue
+		}
+		now := time.Now()
+		j.Status = JobRunning
+		j.StartedAt = &now
+		j.Stage, j.Saved, j.Failed, j.Skipped = "", 0, 0, 0
+		ctx, cancel := context.WithCancel(d.ctx)
+		d.cancels[j.ID] = cancel
+		d.active++
+		d.running[target] = true
+		d.wg.Add(1)
+		go d.runJob(ctx, j.ID, target, cfg)
+	}
+	d.saveLocked()
+}
+
+func (d *daemon) runJob(ctx context.Context, id, target string, cfg config.Config) {
+	defer d.wg.Done()
+	rec := newRunRecorder(cfg.Username)
+	// Jobs run side by side, so their console output would interleave; the job status and
+	// its events are the record of the run.
+	err := d.run(ctx, cfg, RunOptions{Output: io.Discard, Observer: func(e Event) {
+		d.observe(id, e)
+		rec.observe(e)
+	}})
+
+	d.mu.Lock()
+	startedAt, reported := d.finishJob(id, target, err)
+	d.mu.Unlock()
+	if reported {
+		sendReport(ctx, d.notify, notify.Report{StartedAt: startedAt, FinishedAt: time.Now(), Targets: []notify.TargetResult{rec.result(err)}})
+	}
+}
+
+// finishJob records the end of a job run and starts the next jobs. It reports whether the
+// job finished (it was not cancelled or stopped with the daemon) and when it started.
+func (d *daemon) finishJob(id, target string, err error) (time.Time, bool) {
+	d.cancels[id]()
+	delete(d.cancels, id)
+	d.active--
+	delete(d.running, target)
+	j := d.jobs[id]
+	switch {
+	case j == nil || j.Status == JobCancelled:
+		d.scheduleLocked()
+		return time.Time{}, false
+	case d.ctx.Err() != nil:
+		// The daemon is stopping: run the job again on the next start.
+		j.Status = JobQueued
+		j.StartedAt = nil
+		d.saveLocked()
+		return time.Time{}, false
+	}
+	d.finishLocked(j, err)
+	startedAt := *j.StartedAt
+	d.scheduleLocked()
+	return startedAt, true
+}
+
+func (d *daemon) finishLocked(j *Job, err error) {
+	now := time.Now()
+	j.FinishedAt = &now
+	j.Status = JobSucceeded
+	if err != nil {
+		j.Status = JobFailed
+		j.Error = err.Error()
+	}
+}
+
+func (d *daemon) observe(id string, e Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	j := d.jobs[id]
+	if j == nil {
+		return
+	}
+	switch e.Type {
+	case EventStageStarted:
+		j.Stage = e.Stage
+	case EventFileSaved:
+		j.Saved++
+	case EventFileFailed:
+		j.Failed++
+	case EventFileSkipped:
+		j.Skipped++
+	}
+}
+
+// jobConfig applies a request to the daemon's download flags.
+func (d *daemon) jobConfig(req JobRequest) (config.Config, error) {
+	cfg := d.cfg
+	cfg.Command = config.CommandDownload
+	cfg.Username = strings.TrimPrefix(strings.TrimSpace(req.Target), "@")
+	if cfg.Username == "" || utils.SanitizePathSegment(cfg.Username) != cfg.Username {
+		return config.Config{}, fmt.Errorf("invalid target %q", req.Target)
+	}
+	cfg.PickHighlights = false
+	cfg.ToArchive = ""
+	cfg.MediaIDs = nil
+
+	var err error
+	if cfg.Stages, err = config.ParseStages(req.Content); err != nil {
+		return config.Config{}, err
+	}
+	now := time.Now()
+	if req.Since != "" {
+		if cfg.Since, err = config.ParseTimeBound(req.Since, now, false); err != nil {
+			return config.Config{}, fmt.Errorf("invalid since: %v", err)
+		}
+	}
+	if req.Until != "" {
+		if cfg.Until, err = config.ParseTimeBound(req.Until, now, true); err != nil {
+			return config.Config{}, fmt.Errorf("invalid until: %v", err)
+		}
+	}
+	if req.MaxPosts < 0 {
+		return config.Config{}, errors.New("max_posts must not be negative")
+	}
+	if req.MaxPosts > 0 {
+		cfg.MaxPosts = req.MaxPosts
+	}
+	if req.OnlyVideos && req.OnlyPhotos {
+		return config.Config{}, errors.New("only_videos and only_photos are mutually exclusive")
+	}
+	cfg.OnlyVideos = cfg.OnlyVideos || req.OnlyVideos
+	cfg.OnlyPhotos = cfg.OnlyPhotos || req.OnlyPhotos
+	if len(req.ProductTypes) > 0 {
+		cfg.ProductTypes = nil
+		for _, pt := range req.ProductTypes {
+			cfg.ProductTypes = append(cfg.ProductTypes, strings.ToLower(strings.TrimSpace(pt)))
+		}
+	}
+	if req.Filter != "" {
+		cfg.FilterExpr = req.Filter
+	}
+	if len(req.Highlights) > 0 || len(req.HighlightIDs) > 0 {
+		cfg.HighlightTitles = req.Highlights
+		cfg.HighlightIDs = req.HighlightIDs
+	}
+	cfg.Comments = cfg.Comments || req.Comments
+	cfg.SkipExisting = cfg.SkipExisting || req.SkipExisting
+	if _, err := newPostFilter(cfg); err != nil {
+		return config.Config{}, err
+	}
+	return cfg, nil
+}
+
+func (d *daemon) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if !jsonRequest(r) {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	var req JobRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := d.jobConfig(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Target = strings.TrimPrefix(strings.TrimSpace(req.Target), "@")
+
+	j := &Job{ID: newJobID(), Request: req, Status: JobQueued, CreatedAt: time.Now()}
+	d.mu.Lock()
+	d.jobs[j.ID] = j
+	d.order = append(d.order, j.ID)
+	d.scheduleLocked()
+	out := *j
+	d.mu.Unlock()
+	writeJSON(w, http.StatusCreated, out)
+}
+
+// handleList returns the jobs, newest first. ?status= filters by state.
+func (d *daemon) handleList(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	d.mu.Lock()
+	out := []Job{}
+	for _, id := range d.order {
+		if j := d.jobs[id]; status == "" || j.Status == status {
+			out = append(out, *j)
+		}
+	}
+	d.mu.Unlock()
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (d *daemon) handleGet(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	j, ok := d.jobs[r.PathValue("id")]
+	var out Job
+	if ok {
+		out = *j
+	}
+	d.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleCancel cancels a queued or running job. A running job stops at its next
+// cancellation point and keeps the files saved so far. Finished jobs answer 409.
+func (d *daemon) handleCancel(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	j, ok := d.jobs[r.PathValue("id")]
+	if !ok {
+		d.mu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	if j.finished() {
+		out := *j
+		d.mu.Unlock()
+		writeJSON(w, http.StatusConflict, out)
+		return
+	}
+	if cancel := d.cancels[j.ID]; cancel != nil {
+		cancel()
+	}
+	now := time.Now()
+	j.Status = JobCancelled
+	j.FinishedAt = &now
+	d.saveLocked()
+	out := *j
+	d.mu.Unlock()
+	writeJSON(w, http.StatusOK, out)
+}
+
+func newJobID() string {
+	return randomHex(8)
+}
@@ -0,0 +1,247 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+)
+
+// blockingRun is a fake download run that reports one file and waits until released or
+// cancelled.
+type blockingRun struct {
+	started chan string
+	release chan struct{}
+}
+
+func newBlockingRun() *blockingRun {
+	return &blockingRun{started: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (b *blockingRun) run(ctx context.Context, cfg config.Config, opts RunOptions) error {
+	opts.Observer(Event{Type: EventStageStarted, Stage: StagePosts})
+	opts.Observer(Event{Type: EventFileSaved})
+	b.started <- cfg.Username
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+const testToken = "secret"
+
+// daemonRequest sends an authenticated request to the daemon and decodes a 2xx answer into v.
+func daemonRequest(t *testing.T, method, url string, body any, v any) int {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 && v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("decode %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func postJob(t *testing.T, url string, req JobRequest) (Job, int) {
+	t.Helper()
+	var j Job
+	code := daemonRequest(t, http.MethodPost, url+"/jobs", req, &j)
+	return j, code
+}
+
+func waitJob(t *testing.T, url, id, status string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var j Job
+		daemonRequest(t, http.MethodGet, url+"/jobs/"+id, nil, &j)
+		if j.Status == status {
+			return j
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s: status %q, want %q", id, j.Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDaemonJobs(t *testing.T) {
+	t.Parallel()
+	fake := newBlockingRun()
+	cfg := config.Config{StatePath: filepath.Join(t.TempDir(), "jobs.json"), Workers: 2, Token: testToken}
+	d, err := newDaemon(context.Background(), cfg, fake.run)
+	if err != nil {
+		t.Fatalf("newDaemon: %v", err)
+	}
+	ts := httptest.NewServer(d)
+	t.Cleanup(ts.Close)
+
+	if _, code := postJob(t, ts.URL, JobRequest{Target: "nasa", Content: []string{"stories"}}); code != http.StatusBadRequest {
+		t.Fatalf("invalid stage: status %d", code)
+	}
+	if _, code := postJob(t, ts.URL, JobRequest{Target: "../etc"}); code != http.StatusBadRequest {
+		t.Fatalf("invalid target: status %d", code)
+	}
+
+	first, _ := postJob(t, ts.URL, JobRequest{Target: "nasa", Content: []string{"posts"}})
+	second, _ := postJob(t, ts.URL, JobRequest{Target: "@nasa"})
+	third, _ := postJob(t, ts.URL, JobRequest{Target: "esa"})
+	if got := <-fake.started; got != "nasa" {
+		t.Fatalf("first run for %q", got)
+	}
+	if got := <-fake.started; got != "esa" {
+		t.Fatalf("second run for %q, want esa while nasa is busy", got)
+	}
+	if j := waitJob(t, ts.URL, second.ID, JobQueued); j.Request.Target != "nasa" {
+		t.Fatalf("unexpected queued job: %+v", j)
+	}
+	running := waitJob(t, ts.URL, first.ID, JobRunning)
+	if running.Stage != StagePosts || running.Saved != 1 {
+		t.Fatalf("unexpected progress: %+v", running)
+	}
+
+	if code := daemonRequest(t, http.MethodDelete, ts.URL+"/jobs/"+first.ID, nil, nil); code != http.StatusOK {
+		t.Fatalf("DELETE: status %d", code)
+	}
+	// The cancelled job frees the slot of its target.
+	if got := <-fake.started; got != "nasa" {
+		t.Fatalf("third run for %q", got)
+	}
+	close(fake.release)
+	waitJob(t, ts.URL, second.ID, JobSucceeded)
+	waitJob(t, ts.URL, third.ID, JobSucceeded)
+	waitJob(t, ts.URL, first.ID, JobCancelled)
+
+	var jobs []Job
+	daemonRequest(t, http.MethodGet, ts.URL+"/jobs?status=succeeded", nil, &jobs)
+	if len(jobs) != 2 {
+		t.Fatalf("unexpected succeeded jobs: %+v", jobs)
+	}
+	if code := daemonRequest(t, http.MethodGet, ts.URL+"/jobs/missing", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("missing job: status %d", code)
+	}
+}
+
+func TestDaemonRejectsUnauthenticatedAndCrossSiteRequests(t *testing.T) {
+	t.Parallel()
+	fake := newBlockingRun()
+	close(fake.release)
+	cfg := config.Config{StatePath: filepath.Join(t.TempDir(), "jobs.json"), Workers: 1, Token: testToken}
+	d, err := newDaemon(context.Background(), cfg, fake.run)
+	if err != nil {
+		t.Fatalf("newDaemon: %v", err)
+	}
+	ts := httptest.NewServer(d)
+	t.Cleanup(ts.Close)
+
+	send := func(token, contentType string, header map[string]string) int {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/jobs", strings.NewReader(`{"target":"nasa"}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("Content-Type", contentType)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /jobs: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, tc := range []struct {
+		name        string
+		token       string
+		contentType string
+		header      map[string]string
+		want        int
+	}{
+		{"no token", "", "application/json", nil, http.StatusUnauthorized},
+		{"wrong token", "guess", "application/json", nil, http.StatusUnauthorized},
+		{"text body", testToken, "text/plain", nil, http.StatusUnsupportedMediaType},
+		{"cross-site fetch", testToken, "application/json", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"foreign origin", testToken, "application/json", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+	} {
+		if got := send(tc.token, tc.contentType, tc.header); got != tc.want {
+			t.Fatalf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+	d.mu.Lock()
+	queued := len(d.jobs)
+	d.mu.Unlock()
+	if queued != 0 {
+		t.Fatalf("rejected requests queued %d jobs", queued)
+	}
+	if got := send(testToken, "application/json; charset=utf-8", map[string]string{"Sec-Fetch-Site": "same-origin"}); got != http.StatusCreated {
+		t.Fatalf("valid request: status %d", got)
+	}
+	d.wait()
+}
+
+func TestDaemonRequeuesAfterRestart(t *testing.T) {
+	t.Parallel()
+	state := filepath.Join(t.TempDir(), "jobs.json")
+	cfg := config.Config{StatePath: state, Workers: 1, Token: testToken}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fake := newBlockingRun()
+	d, err := newDaemon(ctx, cfg, fake.run)
+	if err != nil {
+		t.Fatalf("newDaemon: %v", err)
+	}
+	ts := httptest.NewServer(d)
+	job, _ := postJob(t, ts.URL, JobRequest{Target: "nasa"})
+	postJob(t, ts.URL, JobRequest{Target: "esa"})
+	<-fake.started
+	ts.Close()
+	cancel()
+	d.wait()
+
+	fake = newBlockingRun()
+	close(fake.release)
+	d, err = newDaemon(context.Background(), cfg, fake.run)
+	if err != nil {
+		t.Fatalf("newDaemon: %v", err)
+	}
+	if got := d.jobs[job.ID]; got == nil || got.Status != JobQueued {
+		t.Fatalf("interrupted job not queued again: %+v", got)
+	}
+	d.mu.Lock()
+	d.scheduleLocked()
+	d.mu.Unlock()
+	if got := <-fake.started; got != "nasa" {
+		t.Fatalf("first run after restart for %q", got)
+	}
+	if got := <-fake.started; got != "esa" {
+		t.Fatalf("second run after restart for %q", got)
+	}
+	d.wait()
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/baptistax/idl/internal/instagram"
+)
+
+// EventType identifies what an Event reports.
+type EventType string
+
+const (
+	EventRunStarted    EventType = "run_started"
+	EventStageStarted  EventType = "stage_started"
+	EventFileSaved     EventType = "file_saved"
+	EventFileSkipped   EventType = "file_skipped"
+	EventFileFailed    EventType = "file_failed"
+	EventStageFinished EventType = "stage_finished"
+	EventRunFinished   EventType = "run_finished"
+)
+
+// Stages of a download run, as reported in Event.Stage.
+const (
+	StagePosts      = "posts"
+	StageReels      = "reels"
+	StageTagged     = "tagged"
+	StageHighlights = "highlights"
+)
+
+// Event reports the progress of a download run to an Observer.
+type Event struct {
+	Type   EventType `json:"type"`
+	Time   time.Time `json:"time"`
+	Target string    `json:"target"`
+	Stage  string    `json:"stage,omitempty"`
+
+	// File events describe one media file. Key is its storage key and Location where it is
+	// stored (a local path or a URL).
+	Key      string `json:"key,omitempty"`
+	Location string `json:"location,omitempty"`
+	MediaID  string `json:"media_id,omitempty"`
+	Code     string `json:"code,omitempty"`
+	TakenAt  int64  `json:"taken_at,omitempty"`
+	Video    bool   `json:"video,omitempty"`
+
+	// Stage and run events carry the counts of their files. Stage events count the current
+	// stage, run events the whole run.
+	Saved   int `json:"saved"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Observer receives the events of a run. It is called synchronously from the download
+// goroutine, so it must not block for long.
+type Observer func(Event)
+
+// eventCounts tracks the file events of a session.
+type eventCounts struct {
+	saved, failed, skipped int
+}
+
+func (c *eventCounts) add(t EventType) {
+	switch t {
+	case EventFileSaved:
+		c.saved++
+	case EventFileFailed:
+		c.failed++
+	case EventFileSkipped:
+		c.skipped++
+	}
+}
+
+// observer sends the events of a session to an Observer and keeps their counts.
+type observer struct {
+	fn     Observer
+	target string
+
+	mu    sync.Mutex
+	stage string
+	inRun eventCounts
+	inStg eventCounts
+}
+
+func (o *observer) emit(e Event) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	e.Time = time.Now()
+	e.Target = o.target
+	switch e.Type {
+	case EventStageStarted:
+		o.stage = e.Stage
+		o.inStg = eventCounts{}
+	case EventFileSaved, EventFileFailed, EventFileSkipped:
+		o.inRun.add(e.Type)
+		o.inStg.add(e.Type)
+	case EventStageFinished:
+		e.Saved, e.Failed, e.Skipped = o.inStg.saved, o.inStg.failed, o.inStg.skipped
+	case EventRunFinished:
+		e.Saved, e.Failed, e.Skipped = o.inRun.saved, o.inRun.failed, o.inRun.skipped
+	}
+	if e.Stage == "" && e.Type != EventRunStarted && e.Type != EventRunFinished {
+		e.Stage = o.stage
+	}
+	fn := o.fn
+	o.mu.Unlock()
+	if fn != nil {
+		fn(e)
+	}
+}
+
+// startStage prints the header of a stage and reports its start.
+func (s *session) startStage(step, total int, stage, title string) {
+	printSectionHeader(s.out, step, total, title)
+	s.events.emit(Event{Type: EventStageStarted, Stage: stage})
+}
+
+// finishStage reports the end of the current stage.
+func (s *session) finishStage(err error) {
+	e := Event{Type: EventStageFinished}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.events.emit(e)
+}
+
+// mediaEvent reports the outcome of saving a media file: saved when fresh is set, skipped
+// when the file already existed, failed when err is set.
+func (s *session) mediaEvent(subdir, name string, fresh bool, m instagram.Media, err error) {
+	if s.events == nil {
+		return
+	}
+	e := Event{
+		Type:    EventFileSaved,
+		MediaID: mediaID(m),
+		Code:    m.Code,
+		TakenAt: m.TakenAt,
+		Video:   isVideoMedia(m),
+	}
+	if name != "" {
+		e.Key = s.key(subdir, name)
+		e.Location = s.store.Location(e.Key)
+	}
+	switch {
+	case err != nil:
+		e.Type = EventFileFailed
+		e.Error = err.Error()
+	case !fresh:
+		e.Type = EventFileSkipped
+	}
+	s.events.emit(e)
+}
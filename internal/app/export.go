@@ -0,0 +1,244 @@
+package app
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/downloader"
+	"github.com/baptistax/idl/internal/storage"
+	"github.com/baptistax/idl/internal/utils"
+)
+
+// Export packages everything stored for a user (media, metadata and manifests) into a zip
+// or tar.gz archive. The checksum manifests are exported unchanged, and every file they list
+// is checked against them on the way, so an export never carries a file altered since it
+// was downloaded.
+func Export(ctx context.Context, cfg config.Config) error {
+	safeUser := utils.SanitizePathSegment(strings.TrimPrefix(strings.TrimSpace(cfg.Username), "@"))
+	store, err := storage.Open(cfg.OutputRoot)
+	if err != nil {
+		return err
+	}
+	userRoot := store.Location(safeUser)
+
+	files, err := store.List(ctx, safeUser+"/")
+	if err != nil {
+		return fmt.Errorf("unable to list %s: %v", userRoot, err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no archive found at %s (run idl <username> first)", userRoot)
+	}
+
+	var out io.Writer = os.Stdout
+	// console receives the status lines; it is standard error when the archive owns standard
+	// output.
+	var console io.Writer = os.Stdout
+	var f *os.File
+	tmp := ""
+	if cfg.ArchiveFile == "-" {
+		console = os.Stderr
+	} else {
+		tmp = cfg.ArchiveFile + ".tmp"
+		if f, err = os.Create(tmp); err != nil {
+			return fmt.Errorf("unable to create %s: %v", cfg.ArchiveFile, err)
+		}
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+		}()
+		out = f
+	}
+
+	printBanner(console)
+	printKV(console, "Target", safeUser)
+	printKV(console, "Source", userRoot)
+	printKV(console, "Archive", cfg.ArchiveFile)
+
+	var aw archiveWriter
+	if cfg.ArchiveFormat == config.FormatTarGz {
+		aw = newTarGzArchive(out)
+	} else {
+		aw = newZipArchive(out)
+	}
+	res, err := exportFiles(ctx, store, safeUser, files, aw)
+	if err != nil {
+		return fmt.Errorf("unable to export %s: %v", userRoot, err)
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("unable to write %s: %v", cfg.ArchiveFile, err)
+		}
+		if err := os.Rename(tmp, cfg.ArchiveFile); err != nil {
+			return fmt.Errorf("unable to write %s: %v", cfg.ArchiveFile, err)
+		}
+	}
+	printKV(console, "Exported", fmt.Sprintf("%d files (%s)", res.files, formatBytes(res.size)))
+	if res.verified > 0 {
+		printKV(console, "Verified", fmt.Sprintf("%d files match %s", res.verified, downloader.SHA256SumsFile))
+	} else {
+		printKV(console, "Verified", fmt.Sprintf("no %s (download with --checksums to create one)", downloader.SHA256SumsFile))
+	}
+	return nil
+}
+
+// exportResult counts what exportFiles wrote.
+type exportResult struct {
+	files int
+	size  int64
+	// verified counts the files checked against the stored SHA256SUMS.
+	verified int
+}
+
+// exportFiles writes files into aw under their keys and closes aw. The stored manifests are
+// written unchanged; each file listed in SHA256SUMS is hashed while it is written and the
+// export fails when it no longer matches.
+func exportFiles(ctx context.Context, store storage.Storage, safeUser string, files []storage.FileInfo, aw archiveWriter) (exportResult, error) {
+	var res exportResult
+	sums, err := readChecksums(ctx, store, safeUser+"/"+downloader.SHA256SumsFile)
+	if err != nil && !storage.IsNotExist(err) {
+		return res, err
+	}
+	for _, fi := range files {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		name := strings.TrimPrefix(fi.Key, safeUser+"/")
+		if strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+		r, err := store.Open(ctx, fi.Key)
+		if err != nil {
+			return res, err
+		}
+		h := sha256.New()
+		err = aw.add(fi.Key, fi.Size, fi.ModTime, io.TeeReader(r, h))
+		_ = r.Close()
+		if err != nil {
+			return res, fmt.Errorf("%s: %v", fi.Key, err)
+		}
+		if want, ok := sums[name]; ok {
+			if got := hex.EncodeToString(h.Sum(nil)); got != want {
+				return res, fmt.Errorf("%s does not match %s (modified since it was downloaded?)", fi.Key, downloader.SHA256SumsFile)
+			}
+			res.verified++
+		}
+		res.files++
+		res.size += fi.Size
+	}
+	if err := aw.Close(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// archiveWriter is the part of zip.Writer and tar.Writer that Export needs.
+type archiveWriter interface {
+	// add writes a file of the given size read from r.
+	add(name string, size int64, modTime time.Time, r io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func newZipArchive(w io.Writer) *zipArchive {
+	return &zipArchive{zw: zip.NewWriter(w)}
+}
+
+func (a *zipArchive) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	hdr := &zip.FileHeader{Name: name, Modified: modTime, Method: zip.Deflate}
+	if isCompressedMedia(name) {
+		// Deflating JPEG, MP4 and the like costs time and saves nothing.
+		hdr.Method = zip.Store
+	}
+	hdr.SetMode(0o644)
+	w, err := a.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("read %d bytes, expected %d", n, size)
+	}
+	return nil
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+type tarGzArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarGzArchive(w io.Writer) *tarGzArchive {
+	gz := gzip.NewWriter(w)
+	return &tarGzArchive{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (a *tarGzArchive) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     size,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	n, err := io.Copy(a.tw, r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("read %d bytes, expected %d", n, size)
+	}
+	return nil
+}
+
+func (a *tarGzArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+func isCompressedMedia(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".webp", ".mp4", ".m4a", ".gz", ".zip":
+		return true
+	}
+	return false
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
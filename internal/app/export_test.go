@@ -0,0 +1,86 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/baptistax/idl/internal/downloader"
+	"github.com/baptistax/idl/internal/storage"
+)
+
+func writeExportFixture(t *testing.T, jpeg string) (storage.Storage, []storage.FileInfo, string) {
+	t.Helper()
+	ctx := context.Background()
+	store := storage.NewFS(t.TempDir())
+	sum := sha256.Sum256([]byte("jpeg"))
+	manifest := downloader.FormatChecksums(map[string]string{"posts/20240101_000000_1.jpg": hex.EncodeToString(sum[:])})
+	files := map[string]string{
+		"nasa/posts/20240101_000000_1.jpg": jpeg,
+		"nasa/posts/20240101_000000_1.txt": "caption",
+		"nasa/profile.json":                "{}",
+		"nasa/SHA256SUMS":                  manifest,
+		"nasa/profile_pic/.incoming.jpg":   "scratch",
+		"other/posts/x.jpg":                "other user",
+	}
+	for key, data := range files {
+		if err := storage.WriteFile(ctx, store, key, []byte(data)); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	list, err := store.List(ctx, "nasa/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return store, list, manifest
+}
+
+func TestExportFilesWritesArchiveWithStoredManifest(t *testing.T) {
+	t.Parallel()
+
+	store, list, manifest := writeExportFixture(t, "jpeg")
+	var buf bytes.Buffer
+	res, err := exportFiles(context.Background(), store, "nasa", list, newZipArchive(&buf))
+	if err != nil {
+		t.Fatalf("exportFiles: %v", err)
+	}
+	if res.files != 4 || res.verified != 1 {
+		t.Fatalf("exported %d files with %d verified, want 4 and 1", res.files, res.verified)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	got := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(r)
+		_ = r.Close()
+		got[f.Name] = string(data)
+	}
+	if len(got) != 4 || got["nasa/posts/20240101_000000_1.jpg"] != "jpeg" || got["nasa/profile.json"] != "{}" {
+		t.Fatalf("unexpected archive content: %v", got)
+	}
+	if got["nasa/SHA256SUMS"] != manifest {
+		t.Fatalf("manifest was not exported unchanged: %q", got["nasa/SHA256SUMS"])
+	}
+}
+
+func TestExportFilesFailsOnFilesChangedSinceDownload(t *testing.T) {
+	t.Parallel()
+
+	store, list, _ := writeExportFixture(t, "edited")
+	_, err := exportFiles(context.Background(), store, "nasa", list, newZipArchive(io.Discard))
+	if err == nil || !strings.Contains(err.Error(), "posts/20240101_000000_1.jpg") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+}
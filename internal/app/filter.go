@@ -0,0 +1,202 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/expr"
+	"github.com/baptistax/idl/internal/instagram"
+)
+
+// postSchema lists the fields available to --filter expressions.
+var postSchema = expr.Schema{
+	"caption":      expr.String,
+	"code":         expr.String,
+	"owner":        expr.String,
+	"type":         expr.String,
+	"product_type": expr.String,
+	"taken_at":     expr.Time,
+	"likes":        expr.Number,
+	"comments":     expr.Number,
+	"plays":        expr.Number,
+	"pinned":       expr.Bool,
+}
+
+// postFields exposes a media item to a --filter expression.
+func postFields(m instagram.Media) expr.Fields {
+	return func(name string) any {
+		switch name {
+		case "caption":
+			return m.CaptionText()
+		case "code":
+			return m.Code
+		case "owner":
+			return m.User.Username
+		case "type":
+			switch {
+			case len(m.CarouselMedia) > 0:
+				return "carousel"
+			case isVideoMedia(m):
+				return "video"
+			default:
+				return "photo"
+			}
+		case "product_type":
+			return m.ProductType
+		case "taken_at":
+			return time.Unix(m.TakenAt, 0)
+		case "likes":
+			return m.LikeCount
+		case "comments":
+			return m.CommentCount
+		case "plays":
+			return m.Plays()
+		case "pinned":
+			return m.IsPinned()
+		}
+		return nil
+	}
+}
+
+// postFilter scopes a run by date, media type and product type, and caps the number of posts per stage.
+type postFilter struct {
+	since        time.Time
+	until        time.Time
+	maxPosts     int
+	onlyVideos   bool
+	onlyPhotos   bool
+	productTypes map[string]struct{}
+	expr         *expr.Expr
+	// ids restricts the run to these media ids (carousel children included). It is set by
+	// idl verify --requeue.
+	ids map[string]struct{}
+}
+
+func newPostFilter(cfg config.Config) (postFilter, error) {
+	f := postFilter{
+		since:      cfg.Since,
+		until:      cfg.Until,
+		maxPosts:   cfg.MaxPosts,
+		onlyVideos: cfg.OnlyVideos || cfg.AudioOnly,
+		onlyPhotos: cfg.OnlyPhotos,
+	}
+	if len(cfg.ProductTypes) > 0 {
+		f.productTypes = make(map[string]struct{}, len(cfg.ProductTypes))
+		for _, pt := range cfg.ProductTypes {
+			f.productTypes[strings.ToLower(pt)] = struct{}{}
+		}
+	}
+	if len(cfg.MediaIDs) > 0 {
+		f.ids = make(map[string]struct{}, len(cfg.MediaIDs))
+		for _, id := range cfg.MediaIDs {
+			f.ids[id] = struct{}{}
+		}
+	}
+	if src := strings.TrimSpace(cfg.FilterExpr); src != "" {
+		e, err := expr.Parse(src, postSchema)
+		if err != nil {
+			return postFilter{}, fmt.Errorf("invalid --filter: %v", err)
+		}
+		f.expr = e
+	}
+	return f, nil
+}
+
+// matchPost reports whether a top-level post passes the date, product type, expression and media type filters.
+// A carousel passes the media type filter when at least one of its children does.
+func (f postFilter) matchPost(m instagram.Media) bool {
+	if m.TakenAt > 0 {
+		taken := time.Unix(m.TakenAt, 0)
+		if !f.since.IsZero() && taken.Before(f.since) {
+			return false
+		}
+		if !f.until.IsZero() && !taken.Before(f.until) {
+			return false
+		}
+	}
+	if f.productTypes != nil {
+		if _, ok := f.productTypes[strings.ToLower(m.ProductType)]; !ok {
+			return false
+		}
+	}
+	if !f.expr.Match(postFields(m)) {
+		return false
+	}
+	if f.ids != nil && !f.hasID(m) && !f.hasChildID(m) {
+		return false
+	}
+	if len(m.CarouselMedia) == 0 {
+		return f.matchType(m)
+	}
+	for _, cm := range m.CarouselMedia {
+		if f.matchType(cm) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchItem applies only the --filter expression and the media id restriction. It is used for
+// highlight items, which are not subject to the post-level date, type and count filters.
+func (f postFilter) matchItem(m instagram.Media) bool {
+	if f.ids != nil && !f.hasID(m) {
+		return false
+	}
+	return f.expr.Match(postFields(m))
+}
+
+func (f postFilter) hasID(m instagram.Media) bool {
+	_, ok := f.ids[mediaID(m)]
+	return ok
+}
+
+func (f postFilter) hasChildID(m instagram.Media) bool {
+	for _, cm := range m.CarouselMedia {
+		if f.hasID(cm) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f postFilter) matchType(m instagram.Media) bool {
+	switch {
+	case f.onlyVideos:
+		return isVideoMedia(m)
+	case f.onlyPhotos:
+		return !isVideoMedia(m)
+	default:
+		return true
+	}
+}
+
+// filterJobs drops carousel children that do not pass the media type filter or, when the run
+// is restricted to media ids, that are not listed.
+func (f postFilter) filterJobs(jobs []timelineMediaJob) []timelineMediaJob {
+	if !f.onlyVideos && !f.onlyPhotos && f.ids == nil {
+		return jobs
+	}
+	out := jobs[:0]
+	for _, job := range jobs {
+		if f.matchType(job.media) && (f.ids == nil || f.hasID(job.media)) {
+			out = append(out, job)
+		}
+	}
+	return out
+}
+
+// pastSince reports whether a reverse-chronological feed has moved beyond --since, meaning
+// no later item can match. Pinned posts are ignored because they are listed out of order.
+func (f postFilter) pastSince(m instagram.Media) bool {
+	if f.since.IsZero() || m.TakenAt <= 0 || m.IsPinned() {
+		return false
+	}
+	return time.Unix(m.TakenAt, 0).Before(f.since)
+}
+
+// reachedMax reports whether n posts exhaust the --max-posts budget.
+func (f postFilter) reachedMax(n int) bool {
+	return f.maxPosts > 0 && n >= f.maxPosts
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/instagram"
+)
+
+func mustPostFilter(t *testing.T, cfg config.Config) postFilter {
+	t.Helper()
+	f, err := newPostFilter(cfg)
+	if err != nil {
+		t.Fatalf("newPostFilter: %v", err)
+	}
+	return f
+}
+
+func TestPostFilterMatchesDateRangeAndProductType(t *testing.T) {
+	t.Parallel()
+
+	f := mustPostFilter(t, config.Config{
+		Since:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Until:        time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		ProductTypes: []string{"clips"},
+	})
+	inRange := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC).Unix()
+
+	if !f.matchPost(instagram.Media{TakenAt: inRange, ProductType: "clips"}) {
+		t.Fatal("expected clip in range to match")
+	}
+	if f.matchPost(instagram.Media{TakenAt: inRange, ProductType: "feed"}) {
+		t.Fatal("expected feed post to be filtered by product type")
+	}
+	if f.matchPost(instagram.Media{TakenAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC).Unix(), ProductType: "clips"}) {
+		t.Fatal("expected --until to be exclusive")
+	}
+}
+
+func TestPostFilterOnlyVideosKeepsVideoCarouselChildren(t *testing.T) {
+	t.Parallel()
+
+	f := mustPostFilter(t, config.Config{OnlyVideos: true})
+	carousel := instagram.Media{
+		MediaType: 8,
+		CarouselMedia: []instagram.Media{
+			{PK: "photo", MediaType: 1},
+			{PK: "video", MediaType: 2},
+		},
+	}
+
+	if !f.matchPost(carousel) {
+		t.Fatal("expected mixed carousel to match")
+	}
+	jobs := f.filterJobs(timelineMediaJobs(carousel))
+	if len(jobs) != 1 || jobs[0].media.PK != "video" || jobs[0].idx != 2 {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+	if f.matchPost(instagram.Media{MediaType: 1}) {
+		t.Fatal("expected photo to be filtered")
+	}
+}
+
+func TestPostFilterPastSinceIgnoresPinnedPosts(t *testing.T) {
+	t.Parallel()
+
+	f := mustPostFilter(t, config.Config{Since: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+	old := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+	if !f.pastSince(instagram.Media{TakenAt: old}) {
+		t.Fatal("expected old post to stop pagination")
+	}
+	pinned := instagram.Media{TakenAt: old, TimelinePinnedUserIDs: []json.RawMessage{json.RawMessage("1")}}
+	if f.pastSince(pinned) {
+		t.Fatal("expected pinned post not to stop pagination")
+	}
+}
+
+func TestPostFilterAppliesCaptionExpression(t *testing.T) {
+	t.Parallel()
+
+	f := mustPostFilter(t, config.Config{FilterExpr: `caption~"#launch" && type == video`})
+	launch := instagram.Media{MediaType: 2, Caption: &instagram.Caption{Text: "Liftoff! #Launch"}}
+
+	if !f.matchPost(launch) {
+		t.Fatal("expected matching caption to pass")
+	}
+	if f.matchPost(instagram.Media{MediaType: 2, Caption: &instagram.Caption{Text: "Landing"}}) {
+		t.Fatal("expected other caption to be filtered")
+	}
+	if f.matchItem(instagram.Media{MediaType: 1}) {
+		t.Fatal("expected highlight photo without caption to be filtered")
+	}
+
+	if _, err := newPostFilter(config.Config{FilterExpr: "views > 1"}); err == nil {
+		t.Fatal("expected unknown field to be rejected")
+	}
+}
+
+func TestPostFilterRestrictsToMediaIDs(t *testing.T) {
+	t.Parallel()
+
+	f := mustPostFilter(t, config.Config{MediaIDs: []string{"c2", "solo"}})
+	carousel := instagram.Media{PK: "p", CarouselMedia: []instagram.Media{{PK: "c1"}, {PK: "c2"}}}
+
+	if !f.matchPost(carousel) || !f.matchPost(instagram.Media{PK: "solo"}) {
+		t.Fatal("expected posts with listed ids to match")
+	}
+	if f.matchPost(instagram.Media{PK: "other"}) || f.matchItem(instagram.Media{PK: "other"}) {
+		t.Fatal("expected unlisted media to be skipped")
+	}
+	jobs := f.filterJobs(timelineMediaJobs(carousel))
+	if len(jobs) != 1 || jobs[0].idx != 2 {
+		t.Fatalf("expected only the listed child, got %+v", jobs)
+	}
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/storage"
+	"github.com/baptistax/idl/internal/utils"
+)
+
+// galleryFile is written to the user directory. It only references files by relative path,
+// so the folder can be opened from file:// or copied anywhere.
+const galleryFile = "index.html"
+
+//go:embed gallery.html
+var galleryHTML string
+
+var galleryTemplate = template.Must(template.New("gallery").Funcs(template.FuncMap{
+	"file": galleryFileURL,
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format("Jan 2, 2006 15:04")
+	},
+	"datetime": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+}).Parse(galleryHTML))
+
+type galleryPage struct {
+	*catalog
+	Sections    []gallerySection
+	GeneratedAt time.Time
+}
+
+type gallerySection struct {
+	ID    string
+	Title string
+	Posts []archivePost
+}
+
+// Gallery renders <user>/index.html, a static page with the posts, reels, tagged posts and
+// highlights saved for a user.
+func Gallery(ctx context.Context, cfg config.Config) error {
+	safeUser := utils.SanitizePathSegment(strings.TrimPrefix(strings.TrimSpace(cfg.Username), "@"))
+	store, err := storage.Open(cfg.OutputRoot)
+	if err != nil {
+		return err
+	}
+	userRoot := store.Location(safeUser)
+
+	cat, err := loadCatalog(ctx, store, safeUser)
+	if err != nil {
+		return fmt.Errorf("unable to scan %s: %v", userRoot, err)
+	}
+	if len(cat.Posts) == 0 && len(cat.Highlights) == 0 {
+		return fmt.Errorf("no archive found at %s (run idl <username> first)", userRoot)
+	}
+
+	data, err := renderGallery(cat, time.Now())
+	if err != nil {
+		return err
+	}
+	key := userKey(safeUser, galleryFile)
+	if err := storage.WriteFile(ctx, store, key, data); err != nil {
+		return fmt.Errorf("unable to save %s: %v", galleryFile, err)
+	}
+
+	printBanner(os.Stdout)
+	printKV(os.Stdout, "Target", safeUser)
+	printKV(os.Stdout, "Posts", fmt.Sprintf("%d", len(cat.Posts)))
+	printKV(os.Stdout, "Highlights", fmt.Sprintf("%d", len(cat.Highlights)))
+	printKV(os.Stdout, "Gallery", store.Location(key))
+	return nil
+}
+
+func renderGallery(cat *catalog, now time.Time) ([]byte, error) {
+	page := galleryPage{catalog: cat, GeneratedAt: now}
+	for _, sec := range []struct{ id, title string }{
+		{sectionPosts, "Posts"},
+		{sectionReels, "Reels"},
+		{sectionTagged, "Tagged"},
+	} {
+		var posts []archivePost
+		for _, p := range cat.Posts {
+			if p.Section == sec.id {
+				posts = append(posts, p)
+			}
+		}
+		if len(posts) > 0 {
+			page.Sections = append(page.Sections, gallerySection{ID: sec.id, Title: sec.title, Posts: posts})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := galleryTemplate.Execute(&buf, page); err != nil {
+		return nil, fmt.Errorf("unable to render gallery: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// galleryFileURL turns a key relative to the user directory into a relative URL.
+func galleryFileURL(key string) template.URL {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return template.URL(strings.Join(parts, "/"))
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baptistax/idl/internal/storage"
+)
+
+func TestLoadCatalogGroupsArchive(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := storage.NewFS(t.TempDir())
+	files := map[string]string{
+		"nasa/profile.json":                               `{"username":"nasa","full_name":"NASA","post_count":2}`,
+		"nasa/profile_pic/20240101_000000.000_abc.jpg":    "a",
+		"nasa/posts/20240301_101010_111_01.jpg":           "c1",
+		"nasa/posts/20240301_101010_112_02.mp4":           "c2",
+		"nasa/posts/20240301_101010_112_02_cover.jpg":     "c2 cover",
+		"nasa/posts/20240301_101010_100.txt":              "carousel caption",
+		"nasa/posts/20240201_090000_200.jpg":              "single",
+		"nasa/posts/20240201_090000_200.txt":              "single caption",
+		"nasa/posts/20240201_090000_200_comments.json":    "{}",
+		"nasa/reels/20240401_000000_300.mp4":              "reel",
+		"nasa/reels/20240401_000000_300.json":             `{"id":"300","code":"Cx","play_count":42}`,
+		"nasa/tagged/20240101_000000_esa_400.jpg":         "tagged",
+		"nasa/posts/20240501_000000_Ab/01.jpg":            "f1",
+		"nasa/posts/20240501_000000_Ab/manifest.json":     `{"id":"500","code":"Ab","taken_at":1714521600,"caption":"folder","children":[{"index":1,"id":"501","type":"image","file":"01.jpg"}]}`,
+		"nasa/highlights/Moon/cover.jpg":                  "cover",
+		"nasa/highlights/Moon/highlight.json":             `{"id":"h1","title":"Moon & Back","created_at":1700000000,"position":2}`,
+		"nasa/highlights/Mars/cover.png":                  "png cover",
+		"nasa/highlights/Mars/highlight.json":             `{"id":"h2","title":"Mars","created_at":1600000000,"position":1,"cover":"cover.png"}`,
+		"nasa/highlights/Mars/20231201_000000_700_01.jpg": "h image",
+		"nasa/highlights/Moon/20231101_000000_600_01.mp4": "h item",
+	}
+	for key, data := range files {
+		if err := storage.WriteFile(ctx, store, key, []byte(data)); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	cat, err := loadCatalog(ctx, store, "nasa")
+	if err != nil {
+		t.Fatalf("loadCatalog: %v", err)
+	}
+	if cat.Profile == nil || cat.Profile.FullName != "NASA" || cat.ProfilePic != "profile_pic/20240101_000000.000_abc.jpg" {
+		t.Fatalf("unexpected profile: %+v %q", cat.Profile, cat.ProfilePic)
+	}
+
+	var got []string
+	for _, p := range cat.Posts {
+		got = append(got, p.Section+":"+p.ID)
+	}
+	want := "posts:500 reels:300 posts:100 posts:200 tagged:400"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("posts = %v, want %s", got, want)
+	}
+
+	carousel := cat.Posts[2]
+	if carousel.Caption != "carousel caption" || len(carousel.Items) != 2 || carousel.Items[1].Poster != "posts/20240301_101010_112_02_cover.jpg" {
+		t.Fatalf("unexpected carousel: %+v", carousel)
+	}
+	if reel := cat.Posts[1]; reel.PlayCount != 42 || reel.Code != "Cx" {
+		t.Fatalf("unexpected reel: %+v", reel)
+	}
+	if tagged := cat.Posts[4]; tagged.Owner != "esa" {
+		t.Fatalf("unexpected tagged post: %+v", tagged)
+	}
+	if folder := cat.Posts[0]; folder.Caption != "folder" || len(folder.Items) != 1 || folder.Items[0].Key != "posts/20240501_000000_Ab/01.jpg" {
+		t.Fatalf("unexpected folder carousel: %+v", folder)
+	}
+
+	// Highlights follow the tray order, whatever their creation dates.
+	if len(cat.Highlights) != 2 || cat.Highlights[0].ID != "h2" || cat.Highlights[1].ID != "h1" {
+		t.Fatalf("highlights = %+v", cat.Highlights)
+	}
+	h := cat.Highlights[1]
+	if h.Title != "Moon & Back" || h.Cover != "highlights/Moon/cover.jpg" || len(h.Items) != 1 || h.Items[0].Type != itemVideo {
+		t.Fatalf("unexpected highlight: %+v", h)
+	}
+	if mars := cat.Highlights[0]; mars.Cover != "highlights/Mars/cover.png" || len(mars.Items) != 1 {
+		t.Fatalf("unexpected highlight: %+v", mars)
+	}
+}
+
+func TestRenderGalleryIsSelfContained(t *testing.T) {
+	t.Parallel()
+
+	cat := &catalog{
+		User: "nasa",
+		Posts: []archivePost{{
+			ID:      "1",
+			Section: sectionPosts,
+			TakenAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+			Caption: "<script>alert(1)</script>",
+			Items: []archiveItem{
+				{Key: "posts/a b.jpg", Type: itemImage},
+				{Key: "posts/b.mp4", Type: itemVideo, Poster: "posts/b_cover.jpg"},
+			},
+		}},
+		Highlights: []archiveHighlight{{Title: "Trip", Cover: "highlights/Trip/cover.jpg", Items: []archiveItem{{Key: "highlights/Trip/x.jpg", Type: itemImage}}}},
+	}
+	data, err := renderGallery(cat, time.Now())
+	if err != nil {
+		t.Fatalf("renderGallery: %v", err)
+	}
+	html := string(data)
+	for _, want := range []string{
+		`src="posts/a%20b.jpg"`,
+		`poster="posts/b_cover.jpg"`,
+		`<span class="count">1/2</span>`,
+		`href="#highlight-0"`,
+		`&lt;script&gt;alert(1)&lt;/script&gt;`,
+		"Mar 1, 2024",
+	} {
+		if !strings.Contains(html, want) {
+			t.Fatalf("gallery does not contain %q", want)
+		}
+	}
+	for _, external := range []string{`src="http`, `href="http`, "<link"} {
+		if strings.Contains(html, external) {
+			t.Fatalf("gallery references external assets (%s)", external)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// crossSite reports whether r was sent by a page of another site. Browsers set
+// Sec-Fetch-Site and Origin on such requests, even on "no-cors" ones that need no preflight;
+// scripts and curl send neither and pass.
+func crossSite(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" {
+		return true
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// localHosts lists the Host header values that address a server listening on addr: the
+// configured listen host and the loopback names, with the bound port. Checking the Host
+// header defeats DNS rebinding, where a page of another site resolves its own name to the
+// server and then counts as same-origin.
+func localHosts(addr net.Addr, listenHost string) map[string]bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return nil
+	}
+	names := []string{"localhost", "127.0.0.1", "::1"}
+	if listenHost != "" {
+		names = append(names, listenHost)
+	}
+	if !tcp.IP.IsUnspecified() {
+		names = append(names, tcp.IP.String())
+	}
+	port := strconv.Itoa(tcp.Port)
+	hosts := make(map[string]bool, 2*len(names))
+	for _, name := range names {
+		name = strings.ToLower(name)
+		hosts[net.JoinHostPort(name, port)] = true
+		if port == "80" {
+			hosts[name] = true
+		}
+	}
+	return hosts
+}
+
+// jsonRequest reports whether the body of r is declared as JSON. Plain HTML forms and
+// no-cors fetches cannot send this content type.
+func jsonRequest(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == "application/json"
+}
+
+// tokenMatches reports whether got equals want, in constant time. An empty want never
+// matches.
+func tokenMatches(got, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// randomHex returns n random bytes, hex-encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
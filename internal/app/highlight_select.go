@@ -0,0 +1,151 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/instagram"
+)
+
+// highlightSelection describes which highlights a run should download.
+type highlightSelection struct {
+	titles []string
+	ids    []string
+	pick   bool
+}
+
+// apply narrows the tray down to the selected highlights, prompting on out when pick is set.
+func (s highlightSelection) apply(hs []instagram.Highlight, out io.Writer) ([]instagram.Highlight, error) {
+	hs = filterHighlights(hs, s.titles, s.ids)
+	if s.pick && len(hs) > 0 {
+		return pickHighlights(hs, out)
+	}
+	return hs, nil
+}
+
+// filterHighlights keeps the highlights matching any of the given title patterns or ids.
+// With no patterns and no ids every highlight is kept.
+func filterHighlights(hs []instagram.Highlight, titles, ids []string) []instagram.Highlight {
+	if len(titles) == 0 && len(ids) == 0 {
+		return hs
+	}
+
+	wanted := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		wanted[strings.TrimPrefix(strings.TrimSpace(id), "highlight:")] = struct{}{}
+	}
+
+	out := make([]instagram.Highlight, 0, len(hs))
+	for _, h := range hs {
+		id := strings.TrimPrefix(h.ID, "highlight:")
+		if _, ok := wanted[id]; ok {
+			out = append(out, h)
+			continue
+		}
+		for _, t := range titles {
+			if matchHighlightTitle(t, h.Title) {
+				out = append(out, h)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// matchHighlightTitle matches a title against a /regex/ or a case-insensitive glob.
+func matchHighlightTitle(pattern, title string) bool {
+	if expr, ok := config.TitleRegexp(pattern); ok {
+		re, err := regexp.Compile(expr)
+		return err == nil && re.MatchString(title)
+	}
+	p := strings.ToLower(strings.TrimSpace(pattern))
+	t := strings.ToLower(strings.TrimSpace(title))
+	if ok, err := path.Match(p, t); err == nil {
+		return ok
+	}
+	return p == t
+}
+
+// pickHighlights lists the highlights on out and asks the user which ones to download.
+func pickHighlights(hs []instagram.Highlight, out io.Writer) ([]instagram.Highlight, error) {
+	if !isStdinTTY() {
+		return nil, errors.New("--pick-highlights requires an interactive terminal")
+	}
+	return promptHighlights(os.Stdin, out, hs)
+}
+
+func promptHighlights(in io.Reader, out io.Writer, hs []instagram.Highlight) ([]instagram.Highlight, error) {
+	for i, h := range hs {
+		title := h.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		if h.MediaCount > 0 {
+			fmt.Fprintf(out, "%3d) %s (%d items)\n", i+1, title, h.MediaCount)
+		} else {
+			fmt.Fprintf(out, "%3d) %s\n", i+1, title)
+		}
+	}
+	fmt.Fprint(out, "Select highlights (e.g. 1,3-5 or all): ")
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return nil, errors.New("no highlights selected")
+	}
+
+	idxs, err := parseSelection(line, len(hs))
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]instagram.Highlight, 0, len(idxs))
+	for _, i := range idxs {
+		selected = append(selected, hs[i])
+	}
+	return selected, nil
+}
+
+// parseSelection parses "1,3-5" or "all" into sorted, de-duplicated 0-based indexes below n.
+func parseSelection(s string, n int) ([]int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("no highlights selected")
+	}
+
+	chosen := make([]bool, n)
+	if strings.EqualFold(s, "all") {
+		for i := range chosen {
+			chosen[i] = true
+		}
+	} else {
+		for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+			lo, hi, isRange := strings.Cut(part, "-")
+			if !isRange {
+				hi = lo
+			}
+			a, errA := strconv.Atoi(strings.TrimSpace(lo))
+			b, errB := strconv.Atoi(strings.TrimSpace(hi))
+			if errA != nil || errB != nil || a < 1 || b > n || a > b {
+				return nil, fmt.Errorf("invalid selection %q", part)
+			}
+			for i := a; i <= b; i++ {
+				chosen[i-1] = true
+			}
+		}
+	}
+
+	out := make([]int, 0, n)
+	for i, ok := range chosen {
+		if ok {
+			out = append(out, i)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/baptistax/idl/internal/instagram"
+)
+
+var selectTray = []instagram.Highlight{
+	{ID: "highlight:111", Title: "Trip 2023", MediaCount: 12},
+	{ID: "highlight:222", Title: "Friends", MediaCount: 4},
+	{ID: "highlight:333", Title: "trip japan", MediaCount: 30},
+}
+
+func TestFilterHighlightsMatchesGlobRegexAndID(t *testing.T) {
+	t.Parallel()
+
+	got := filterHighlights(selectTray, []string{"TRIP*"}, nil)
+	if len(got) != 2 || got[0].ID != "highlight:111" || got[1].ID != "highlight:333" {
+		t.Fatalf("unexpected glob match: %+v", got)
+	}
+
+	got = filterHighlights(selectTray, []string{"/^Friends$/"}, []string{"333"})
+	if len(got) != 2 || got[0].ID != "highlight:222" || got[1].ID != "highlight:333" {
+		t.Fatalf("unexpected regex/id match: %+v", got)
+	}
+
+	if got := filterHighlights(selectTray, nil, nil); len(got) != len(selectTray) {
+		t.Fatalf("expected all highlights without selectors, got %d", len(got))
+	}
+}
+
+func TestPromptHighlightsParsesRanges(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	got, err := promptHighlights(strings.NewReader("1, 2-3\n"), &out, selectTray)
+	if err != nil {
+		t.Fatalf("promptHighlights: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 highlights, got %d", len(got))
+	}
+	if !strings.Contains(out.String(), "  2) Friends (4 items)") {
+		t.Fatalf("unexpected listing: %q", out.String())
+	}
+
+	if _, err := parseSelection("4", len(selectTray)); err == nil {
+		t.Fatal("expected out-of-range selection to fail")
+	}
+}
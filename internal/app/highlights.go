@@ -0,0 +1,90 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/storage"
+)
+
+// highlightMetadata is written as highlight.json in every highlights/<title>/ folder.
+type highlightMetadata struct {
+	ID        string              `json:"id"`
+	Title     string              `json:"title"`
+	CreatedAt int64               `json:"created_at,omitempty"`
+	Position  int                 `json:"position"`
+	ItemCount int                 `json:"item_count"`
+	Cover     string              `json:"cover,omitempty"`
+	Items     []highlightItemInfo `json:"items"`
+}
+
+type highlightItemInfo struct {
+	Index   int    `json:"index"`
+	ID      string `json:"id"`
+	TakenAt int64  `json:"taken_at,omitempty"`
+	Video   bool   `json:"video"`
+}
+
+func newHighlightMetadata(h instagram.Highlight, items []instagram.Media, cover string) highlightMetadata {
+	meta := highlightMetadata{
+		ID:        h.ID,
+		Title:     h.Title,
+		CreatedAt: h.CreatedAt,
+		Position:  h.Position,
+		ItemCount: len(items),
+		Cover:     cover,
+		Items:     make([]highlightItemInfo, 0, len(items)),
+	}
+	if meta.ItemCount == 0 {
+		meta.ItemCount = h.MediaCount
+	}
+	for i, m := range items {
+		meta.Items = append(meta.Items, highlightItemInfo{
+			Index:   i + 1,
+			ID:      mediaID(m),
+			TakenAt: m.TakenAt,
+			Video:   isVideoMedia(m),
+		})
+	}
+	return meta
+}
+
+// saveHighlightExtras downloads the highlight's cropped cover as cover.jpg and writes highlight.json
+// into the highlight folder. The metadata is written even when the cover download fails. With
+// --skip-existing, a stored cover is kept, and highlight.json is only rewritten when it changes.
+func (s *session) saveHighlightExtras(ctx context.Context, subdir string, h instagram.Highlight, items []instagram.Media) error {
+	firstErr := error(nil)
+	cover := ""
+	if u := strings.TrimSpace(h.CoverURL); u != "" {
+		rel := filepath.Join(s.safeUser, subdir, "cover.jpg")
+		if stored, ok := s.savedImage(ctx, rel); ok {
+			cover = stored
+		} else if saved, err := downloadImageCandidates(ctx, s.dl, s.pacer, []string{u}, rel); err != nil {
+			firstErr = fmt.Errorf("failed to download cover for highlight %s: %v", h.ID, err)
+		} else {
+			cover = path.Base(filepath.ToSlash(saved))
+		}
+	}
+
+	data, err := json.MarshalIndent(newHighlightMetadata(h, items, cover), "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	key := s.key(subdir, "highlight.json")
+	if s.skipExisting {
+		if old, err := storage.ReadFile(ctx, s.store, key); err == nil && bytes.Equal(old, data) {
+			return firstErr
+		}
+	}
+	if err := storage.WriteFile(ctx, s.store, key, data); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("unable to save highlight.json for %s: %v", h.ID, err)
+	}
+	return firstErr
+}
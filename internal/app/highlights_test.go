@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baptistax/idl/internal/downloader"
+	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/storage"
+)
+
+func TestNewHighlightMetadataKeepsItemOrder(t *testing.T) {
+	t.Parallel()
+
+	h := instagram.Highlight{ID: "h1", Title: "Trip", CreatedAt: 1700000000, Position: 3, MediaCount: 9}
+	items := []instagram.Media{
+		{PK: "a", TakenAt: 10},
+		{PK: "b", TakenAt: 20, MediaType: 2},
+	}
+
+	meta := newHighlightMetadata(h, items, "cover.jpg")
+	if meta.Title != "Trip" || meta.Position != 3 || meta.ItemCount != 2 || meta.Cover != "cover.jpg" {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+	if len(meta.Items) != 2 || meta.Items[0].ID != "a" || meta.Items[1].Index != 2 || !meta.Items[1].Video {
+		t.Fatalf("unexpected items: %+v", meta.Items)
+	}
+
+	if empty := newHighlightMetadata(h, nil, ""); empty.ItemCount != 9 {
+		t.Fatalf("expected tray media count fallback, got %d", empty.ItemCount)
+	}
+}
+
+// countingStore counts the files created in a Storage.
+type countingStore struct {
+	storage.Storage
+	mu      sync.Mutex
+	created []string
+}
+
+func (c *countingStore) Create(ctx context.Context, key string) (storage.Writer, error) {
+	c.mu.Lock()
+	c.created = append(c.created, key)
+	c.mu.Unlock()
+	return c.Storage.Create(ctx, key)
+}
+
+func TestSaveHighlightExtrasSkipsExistingFiles(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = io.WriteString(w, "\xff\xd8\xff\xe0cover")
+	}))
+	defer srv.Close()
+
+	store := &countingStore{Storage: storage.NewFS(t.TempDir())}
+	dl := downloader.New(downloader.Options{Storage: store, Timeout: 5 * time.Second})
+	s := &session{dl: dl, store: store, safeUser: "user", skipExisting: true}
+	h := instagram.Highlight{ID: "h1", Title: "Trip", CoverURL: srv.URL + "/cover.jpg"}
+	items := []instagram.Media{{PK: "a"}}
+
+	if err := s.saveHighlightExtras(context.Background(), "highlights/Trip", h, items); err != nil {
+		t.Fatalf("saveHighlightExtras: %v", err)
+	}
+	if requests != 1 || len(store.created) != 2 {
+		t.Fatalf("first save: %d requests, created %v", requests, store.created)
+	}
+	if err := s.saveHighlightExtras(context.Background(), "highlights/Trip", h, items); err != nil {
+		t.Fatalf("saveHighlightExtras again: %v", err)
+	}
+	if requests != 1 || len(store.created) != 2 {
+		t.Fatalf("unchanged highlight saved again: %d requests, created %v", requests, store.created)
+	}
+
+	// A changed highlight only rewrites its metadata.
+	items = append(items, instagram.Media{PK: "b"})
+	if err := s.saveHighlightExtras(context.Background(), "highlights/Trip", h, items); err != nil {
+		t.Fatalf("saveHighlightExtras after a change: %v", err)
+	}
+	if requests != 1 || len(store.created) != 3 || store.created[2] != "user/highlights/Trip/highlight.json" {
+		t.Fatalf("changed highlight: %d requests, created %v", requests, store.created)
+	}
+}
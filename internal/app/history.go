@@ -0,0 +1,200 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/storage"
+	"github.com/baptistax/idl/internal/utils"
+)
+
+const (
+	profileSnapshotDir    = "profile"
+	profileSnapshotSuffix = "_profile.json"
+	profileLatestFile     = "profile.json"
+)
+
+// profileSnapshot is the on-disk representation of a profile at a point in time.
+type profileSnapshot struct {
+	CapturedAt     time.Time `json:"captured_at"`
+	Username       string    `json:"username"`
+	UserID         string    `json:"user_id,omitempty"`
+	FullName       string    `json:"full_name"`
+	Biography      string    `json:"biography"`
+	ExternalURL    string    `json:"external_url,omitempty"`
+	BioLinks       []string  `json:"bio_links,omitempty"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+	PostCount      int64     `json:"post_count"`
+	Category       string    `json:"category,omitempty"`
+	IsVerified     bool      `json:"is_verified"`
+	IsPrivate      bool      `json:"is_private"`
+	ProfilePicURL  string    `json:"profile_pic_url,omitempty"`
+}
+
+func newProfileSnapshot(p instagram.Profile, capturedAt time.Time) profileSnapshot {
+	pic := p.ProfilePicURLHD
+	if pic == "" {
+		pic = p.ProfilePicURL
+	}
+	return profileSnapshot{
+		CapturedAt:     capturedAt.UTC(),
+		Username:       p.Username,
+		UserID:         p.UserID,
+		FullName:       p.FullName,
+		Biography:      p.Biography,
+		ExternalURL:    p.ExternalURL,
+		BioLinks:       p.BioLinks,
+		FollowerCount:  p.FollowerCount,
+		FollowingCount: p.FollowingCount,
+		PostCount:      p.PostCount,
+		Category:       p.Category,
+		IsVerified:     p.IsVerified,
+		IsPrivate:      p.IsPrivate,
+		ProfilePicURL:  pic,
+	}
+}
+
+// saveProfileSnapshot writes a timestamped snapshot under <user>/profile/ and refreshes
+// <user>/profile.json with the same content. Older snapshots are left untouched. It returns
+// the location of the new snapshot.
+func saveProfileSnapshot(ctx context.Context, store storage.Storage, safeUser string, snap profileSnapshot) (string, error) {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	data = append(data, '\n')
+
+	// Milliseconds keep the snapshots of runs started within the same second apart.
+	name := snap.CapturedAt.UTC().Format("20060102_150405.000") + profileSnapshotSuffix
+	key := userKey(safeUser, profileSnapshotDir, name)
+	if err := storage.WriteFile(ctx, store, key, data); err != nil {
+		return "", fmt.Errorf("unable to save profile snapshot: %v", err)
+	}
+	if err := storage.WriteFile(ctx, store, userKey(safeUser, profileLatestFile), data); err != nil {
+		return "", fmt.Errorf("unable to save profile snapshot: %v", err)
+	}
+	return store.Location(key), nil
+}
+
+// loadProfileSnapshots reads every snapshot stored for a user, oldest first.
+func loadProfileSnapshots(ctx context.Context, store storage.Storage, safeUser string) ([]profileSnapshot, error) {
+	dir := userKey(safeUser, profileSnapshotDir) + "/"
+	files, err := store.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		name := strings.TrimPrefix(f.Key, dir)
+		if strings.Contains(name, "/") || !strings.HasSuffix(name, profileSnapshotSuffix) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	snaps := make([]profileSnapshot, 0, len(names))
+	for _, name := range names {
+		data, err := storage.ReadFile(ctx, store, dir+name)
+		if err != nil {
+			return nil, err
+		}
+		var snap profileSnapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("invalid profile snapshot %s: %v", name, err)
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, nil
+}
+
+// diffProfileSnapshots describes the changes between two snapshots, one line per field.
+func diffProfileSnapshots(prev, next profileSnapshot) []string {
+	var out []string
+	text := func(label, a, b string) {
+		if a != b {
+			out = append(out, fmt.Sprintf("%s: %q -> %q", label, a, b))
+		}
+	}
+	count := func(label string, a, b int64) {
+		if a != b {
+			out = append(out, fmt.Sprintf("%s: %d -> %d (%+d)", label, a, b, b-a))
+		}
+	}
+	flag := func(label string, a, b bool) {
+		if a != b {
+			out = append(out, fmt.Sprintf("%s: %t -> %t", label, a, b))
+		}
+	}
+
+	text("username", prev.Username, next.Username)
+	text("full name", prev.FullName, next.FullName)
+	text("biography", prev.Biography, next.Biography)
+	text("external url", prev.ExternalURL, next.ExternalURL)
+	text("bio links", strings.Join(prev.BioLinks, " "), strings.Join(next.BioLinks, " "))
+	text("category", prev.Category, next.Category)
+	count("followers", prev.FollowerCount, next.FollowerCount)
+	count("following", prev.FollowingCount, next.FollowingCount)
+	count("posts", prev.PostCount, next.PostCount)
+	flag("verified", prev.IsVerified, next.IsVerified)
+	flag("private", prev.IsPrivate, next.IsPrivate)
+	if prev.ProfilePicURL != next.ProfilePicURL && prev.ProfilePicURL != "" && next.ProfilePicURL != "" {
+		// CDN URLs rotate their signatures, so only the presence of a change is meaningful.
+		out = append(out, "profile picture url changed")
+	}
+	return out
+}
+
+// History prints how a user's profile changed across the snapshots saved by previous runs.
+func History(ctx context.Context, cfg config.Config) error {
+	safeUser := utils.SanitizePathSegment(strings.TrimPrefix(strings.TrimSpace(cfg.Username), "@"))
+	store, err := storage.Open(cfg.OutputRoot)
+	if err != nil {
+		return err
+	}
+
+	snaps, err := loadProfileSnapshots(ctx, store, safeUser)
+	if err != nil {
+		return fmt.Errorf("unable to read profile snapshots: %v", err)
+	}
+	if len(snaps) == 0 {
+		return errors.New("no profile snapshots found (run idl <username> first)")
+	}
+
+	printBanner(os.Stdout)
+	printKV(os.Stdout, "Target", safeUser)
+	printKV(os.Stdout, "Snapshots", fmt.Sprintf("%d", len(snaps)))
+	printKV(os.Stdout, "First", formatSnapshotTime(snaps[0].CapturedAt))
+	printKV(os.Stdout, "Last", formatSnapshotTime(snaps[len(snaps)-1].CapturedAt))
+
+	changes := 0
+	for i := 1; i < len(snaps); i++ {
+		lines := diffProfileSnapshots(snaps[i-1], snaps[i])
+		if len(lines) == 0 {
+			continue
+		}
+		changes++
+		printSectionHeader(os.Stdout, 0, 0, formatSnapshotTime(snaps[i-1].CapturedAt)+" -> "+formatSnapshotTime(snaps[i].CapturedAt))
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+	if changes == 0 {
+		fmt.Println("\nNo changes recorded.")
+	}
+	return nil
+}
+
+func formatSnapshotTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
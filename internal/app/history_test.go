@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/baptistax/idl/internal/storage"
+)
+
+func TestProfileSnapshotsRoundTripInCaptureOrder(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewFS(t.TempDir())
+	later := profileSnapshot{CapturedAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Username: "nasa", FollowerCount: 120}
+	earlier := profileSnapshot{CapturedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Username: "nasa", FollowerCount: 100}
+	// A second run within the same second keeps its own snapshot.
+	again := profileSnapshot{CapturedAt: later.CapturedAt.Add(300 * time.Millisecond), Username: "nasa", FollowerCount: 121}
+
+	for _, snap := range []profileSnapshot{later, earlier, again} {
+		if _, err := saveProfileSnapshot(context.Background(), store, "nasa", snap); err != nil {
+			t.Fatalf("saveProfileSnapshot: %v", err)
+		}
+	}
+
+	snaps, err := loadProfileSnapshots(context.Background(), store, "nasa")
+	if err != nil {
+		t.Fatalf("loadProfileSnapshots: %v", err)
+	}
+	if len(snaps) != 3 {
+		t.Fatalf("expected 3 snapshots, got %d", len(snaps))
+	}
+	if snaps[0].FollowerCount != 100 || snaps[1].FollowerCount != 120 || snaps[2].FollowerCount != 121 {
+		t.Fatalf("unexpected snapshot order: %+v", snaps)
+	}
+}
+
+func TestDiffProfileSnapshotsReportsBioAndCountChanges(t *testing.T) {
+	t.Parallel()
+
+	prev := profileSnapshot{Biography: "old bio", FollowerCount: 100, PostCount: 5}
+	next := profileSnapshot{Biography: "new bio", FollowerCount: 90, PostCount: 5}
+
+	lines := diffProfileSnapshots(prev, next)
+	want := []string{
+		`biography: "old bio" -> "new bio"`,
+		"followers: 100 -> 90 (-10)",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("unexpected diff: %q", lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("unexpected diff line %d: got %q want %q", i, lines[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+)
+
+// hookQueueSize is how many events may wait for the hooks before the download blocks.
+const hookQueueSize = 256
+
+// hooks runs the --hook command and posts to the --hook-url for every saved file and every
+// finished stage and run. They run one event at a time, in order, on their own goroutine, so
+// a slow hook delays later hooks but not the download. Hook failures are logged and do not
+// affect the run.
+type hooks struct {
+	command string
+	url     string
+	timeout time.Duration
+	client  *http.Client
+
+	queue chan Event
+	done  chan struct{}
+}
+
+// newHooks returns the hooks configured in cfg, or nil when there are none. The caller must
+// close them.
+func newHooks(cfg config.Config) *hooks {
+	if cfg.HookCommand == "" && cfg.HookURL == "" {
+		return nil
+	}
+	h := &hooks{
+		command: cfg.HookCommand,
+		url:     cfg.HookURL,
+		timeout: cfg.HookTimeout,
+		client:  &http.Client{},
+		queue:   make(chan Event, hookQueueSize),
+		done:    make(chan struct{}),
+	}
+	if h.timeout <= 0 {
+		h.timeout = config.DefaultHookTimeout
+	}
+	go h.loop()
+	return h
+}
+
+// observe queues e if it triggers hooks.
+func (h *hooks) observe(e Event) {
+	switch e.Type {
+	case EventFileSaved, EventStageFinished, EventRunFinished:
+		h.queue <- e
+	}
+}
+
+// close waits for the queued hooks to finish.
+func (h *hooks) close() {
+	if h == nil {
+		return
+	}
+	close(h.queue)
+	<-h.done
+}
+
+func (h *hooks) loop() {
+	defer close(h.done)
+	for e := range h.queue {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		if h.command != "" {
+			if err := h.runCommand(e, payload); err != nil {
+				log.Printf("hook command failed (%s): %v", describeHookEvent(e), err)
+			}
+		}
+		if h.url != "" {
+			if err := h.post(payload); err != nil {
+				log.Printf("hook url failed (%s): %v", describeHookEvent(e), err)
+			}
+		}
+	}
+}
+
+// runCommand runs the hook command through the shell with the event in IDL_* variables and
+// as JSON on standard input. Its output goes to standard error.
+func (h *hooks) runCommand(e Event, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", h.command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", h.command)
+	}
+	cmd.Env = append(os.Environ(), hookEnv(e)...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	// Do not wait for background processes that keep the output open.
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", h.timeout)
+	}
+	return err
+}
+
+// post sends the event as JSON to the hook URL. Any status but 2xx is a failure.
+func (h *hooks) post(payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// hookEnv returns the environment variables describing e.
+func hookEnv(e Event) []string {
+	env := []string{
+		"IDL_EVENT=" + string(e.Type),
+		"IDL_TARGET=" + e.Target,
+		"IDL_STAGE=" + e.Stage,
+	}
+	if e.Type == EventFileSaved {
+		env = append(env,
+			"IDL_KEY="+e.Key,
+			"IDL_FILE="+e.Location,
+			"IDL_MEDIA_ID="+e.MediaID,
+			"IDL_CODE="+e.Code,
+			"IDL_TAKEN_AT="+strconv.FormatInt(e.TakenAt, 10),
+			"IDL_VIDEO="+strconv.FormatBool(e.Video),
+		)
+	} else {
+		env = append(env,
+			"IDL_SAVED="+strconv.Itoa(e.Saved),
+			"IDL_FAILED="+strconv.Itoa(e.Failed),
+			"IDL_SKIPPED="+strconv.Itoa(e.Skipped),
+			"IDL_ERROR="+e.Error,
+		)
+	}
+	return env
+}
+
+func describeHookEvent(e Event) string {
+	parts := []string{string(e.Type), e.Target}
+	switch {
+	case e.Key != "":
+		parts = append(parts, e.Key)
+	case e.Stage != "":
+		parts = append(parts, e.Stage)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+)
+
+func TestHooksRunCommandAndPost(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook command uses sh")
+	}
+	dir := t.TempDir()
+
+	var mu sync.Mutex
+	var posted []Event
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("decode hook body: %v", err)
+		}
+		mu.Lock()
+		posted = append(posted, e)
+		mu.Unlock()
+		// Failures are logged and do not stop later hooks.
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(ts.Close)
+
+	h := newHooks(config.Config{
+		HookCommand: `echo "$IDL_EVENT $IDL_TARGET $IDL_FILE $IDL_SAVED" >> "` + filepath.Join(dir, "env.txt") + `"; cat >> "` + filepath.Join(dir, "stdin.txt") + `"; echo >> "` + filepath.Join(dir, "stdin.txt") + `"`,
+		HookURL:     ts.URL,
+	})
+	h.observe(Event{Type: EventRunStarted, Target: "nasa"})
+	h.observe(Event{Type: EventFileSaved, Target: "nasa", Stage: StagePosts, Key: "nasa/posts/a.jpg", Location: "/out/nasa/posts/a.jpg"})
+	h.observe(Event{Type: EventFileSkipped, Target: "nasa", Key: "nasa/posts/b.jpg"})
+	h.observe(Event{Type: EventRunFinished, Target: "nasa", Saved: 1})
+	h.close()
+
+	env, err := os.ReadFile(filepath.Join(dir, "env.txt"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got, want := string(env), "file_saved nasa /out/nasa/posts/a.jpg \nrun_finished nasa  1\n"; got != want {
+		t.Fatalf("hook env:\n%q\nwant\n%q", got, want)
+	}
+	stdin, err := os.ReadFile(filepath.Join(dir, "stdin.txt"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(stdin)), "\n")
+	var first Event
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[0]), &first) != nil || first.Key != "nasa/posts/a.jpg" {
+		t.Fatalf("unexpected hook stdin: %q", stdin)
+	}
+	if len(posted) != 2 || posted[0].Type != EventFileSaved || posted[1].Saved != 1 {
+		t.Fatalf("unexpected posts: %+v", posted)
+	}
+}
+
+func TestHooksTimeout(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook command uses sh")
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	h := newHooks(config.Config{HookCommand: "sleep 5", HookURL: ts.URL, HookTimeout: 100 * time.Millisecond})
+	started := time.Now()
+	h.observe(Event{Type: EventRunFinished, Target: "nasa"})
+	h.close()
+	if elapsed := time.Since(started); elapsed > 1500*time.Millisecond {
+		t.Fatalf("hooks took %s despite the timeout", elapsed)
+	}
+}
+
+func TestRunFinishedHookOnEarlyFailure(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	var mu sync.Mutex
+	var posted []Event
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("decode hook body: %v", err)
+		}
+		mu.Lock()
+		posted = append(posted, e)
+		mu.Unlock()
+	}))
+	t.Cleanup(ts.Close)
+
+	err := RunWith(context.Background(), config.Config{
+		Username:     "@nasa",
+		CookiesPath:  filepath.Join(dir, "cookies.txt"),
+		OutputRoot:   filepath.Join(dir, "out"),
+		VideoQuality: "best",
+		HookURL:      ts.URL,
+	}, RunOptions{Output: io.Discard})
+	if err == nil {
+		t.Fatal("expected an error without cookies")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(posted) != 1 || posted[0].Type != EventRunFinished || posted[0].Target != "nasa" || !strings.Contains(posted[0].Error, "cookies") {
+		t.Fatalf("unexpected posts: %+v", posted)
+	}
+}
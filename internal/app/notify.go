@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/notify"
+)
+
+// newNotifier loads the --notify config file, or returns nil when there is none.
+func newNotifier(cfg config.Config) (*notify.Notifier, error) {
+	if cfg.NotifyPath == "" {
+		return nil, nil
+	}
+	nc, err := notify.Load(cfg.NotifyPath)
+	if err != nil {
+		return nil, err
+	}
+	return notify.New(nc), nil
+}
+
+// sendReport sends r to the sinks of n, if any. Failures are logged; they do not affect the
+// run. Notifications are sent even when ctx was cancelled, to report the interruption.
+func sendReport(ctx context.Context, n *notify.Notifier, r notify.Report) {
+	if n == nil || len(r.Targets) == 0 {
+		return
+	}
+	if err := n.Notify(context.WithoutCancel(ctx), r); err != nil {
+		log.Print(err)
+	}
+}
+
+// runRecorder collects the events of a run into the result of its target.
+type runRecorder struct {
+	mu  sync.Mutex
+	res notify.TargetResult
+}
+
+func newRunRecorder(target string) *runRecorder {
+	return &runRecorder{res: notify.TargetResult{Target: target}}
+}
+
+func (r *runRecorder) observe(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch e.Type {
+	case EventRunStarted:
+		// The canonical username, as resolved by Instagram.
+		r.res.Target = e.Target
+	case EventStageFinished:
+		r.res.Stages = append(r.res.Stages, notify.StageResult{
+			Stage:   e.Stage,
+			Saved:   e.Saved,
+			Failed:  e.Failed,
+			Skipped: e.Skipped,
+			Error:   e.Error,
+		})
+	case EventRunFinished:
+		r.res.Saved, r.res.Failed, r.res.Skipped = e.Saved, e.Failed, e.Skipped
+	}
+}
+
+// result returns the result of the run that returned err. Runs that failed before they
+// started (for example with expired cookies) have no events, only the error.
+func (r *runRecorder) result(err error) notify.TargetResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.res
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/notify"
+)
+
+func TestRunRecorder(t *testing.T) {
+	t.Parallel()
+
+	rec := newRunRecorder("NASA")
+	for _, e := range []Event{
+		{Type: EventRunStarted, Target: "nasa"},
+		{Type: EventStageStarted, Stage: StagePosts},
+		{Type: EventFileSaved},
+		{Type: EventStageFinished, Stage: StagePosts, Saved: 1},
+		{Type: EventStageFinished, Stage: StageReels, Error: "rate limited"},
+		{Type: EventRunFinished, Saved: 1, Skipped: 2, Error: "rate limited"},
+	} {
+		rec.observe(e)
+	}
+	res := rec.result(errors.New("rate limited"))
+	if res.Target != "nasa" || res.Saved != 1 || res.Skipped != 2 || res.Error != "rate limited" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if len(res.Stages) != 2 || res.Stages[0].Saved != 1 || res.Stages[1].Error != "rate limited" {
+		t.Fatalf("unexpected stages: %+v", res.Stages)
+	}
+}
+
+func TestRunNotifiesFailureBeforeStart(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	got := make(chan notify.Payload, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p notify.Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		got <- p
+	}))
+	t.Cleanup(ts.Close)
+	notifyPath := filepath.Join(dir, "notify.json")
+	if err := os.WriteFile(notifyPath, []byte(`{"sinks": [{"type": "webhook", "url": "`+ts.URL+`"}]}`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	err := Run(context.Background(), config.Config{
+		Username:     "nasa",
+		CookiesPath:  filepath.Join(dir, "cookies.txt"),
+		OutputRoot:   filepath.Join(dir, "out"),
+		VideoQuality: "best",
+		NotifyPath:   notifyPath,
+	})
+	if err == nil {
+		t.Fatal("expected an error without cookies")
+	}
+	select {
+	case p := <-got:
+		if p.Event != notify.Failure || len(p.Targets) != 1 || p.Targets[0].Target != "nasa" || !strings.Contains(p.Targets[0].Error, "cookies") {
+			t.Fatalf("unexpected notification: %+v", p)
+		}
+	default:
+		t.Fatal("no notification sent")
+	}
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/baptistax/idl/internal/downloader"
+	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/storage"
+)
+
+const profilePicDir = "profile_pic"
+
+// saveProfilePicture downloads the highest-resolution avatar into <user>/profile_pic/.
+// A new version is only kept when its content differs from the latest stored version, so
+// the folder accumulates one file per avatar change (including a return to an earlier one).
+// It returns the path of the stored file and whether it is a new version.
+func saveProfilePicture(ctx context.Context, dl *downloader.Downloader, pacer *Pacer, safeUser string, p instagram.Profile, capturedAt time.Time) (string, bool, error) {
+	url := strings.TrimSpace(p.ProfilePicURLHD)
+	if url == "" {
+		url = strings.TrimSpace(p.ProfilePicURL)
+	}
+	if url == "" {
+		return "", false, errors.New("profile has no picture URL")
+	}
+
+	if err := waitForDownloadTurn(ctx, pacer); err != nil {
+		return "", false, err
+	}
+	store := dl.Storage()
+	rel := filepath.Join(safeUser, profilePicDir, ".incoming.jpg")
+	incoming, err := dl.DownloadImageAsJPEG(ctx, url, rel)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to download profile picture: %v", err)
+	}
+	// The image may have been saved as PNG or WebP when it could not be converted.
+	dir := userKey(safeUser, profilePicDir)
+	incomingKey := path.Join(dir, path.Base(filepath.ToSlash(incoming)))
+	defer func() { _ = store.Remove(ctx, incomingKey) }()
+
+	data, err := storage.ReadFile(ctx, store, incomingKey)
+	if err != nil {
+		return "", false, err
+	}
+	sum := sha256.Sum256(data)
+	hexSum := hex.EncodeToString(sum[:])
+
+	latest, err := latestProfilePicture(ctx, store, dir)
+	if err != nil {
+		return "", false, err
+	}
+	if latest != "" {
+		if other, err := storedSHA256(ctx, store, latest); err != nil {
+			return "", false, err
+		} else if other == hexSum {
+			return store.Location(latest), false, nil
+		}
+	}
+
+	// Milliseconds keep two changes within the same second apart, as for profile snapshots.
+	name := fmt.Sprintf("%s_%s%s", capturedAt.UTC().Format("20060102_150405.000"), hexSum[:12], path.Ext(incomingKey))
+	final := path.Join(dir, name)
+	if err := storage.WriteFile(ctx, store, final, data); err != nil {
+		return "", false, err
+	}
+	if err := dl.RecordChecksum(final, data); err != nil {
+		return "", false, err
+	}
+	return store.Location(final), true, nil
+}
+
+// latestProfilePicture returns the key of the most recent version stored directly below dir,
+// or "" when there is none. File names start with their capture time, so the latest version
+// sorts last.
+func latestProfilePicture(ctx context.Context, store storage.Storage, dir string) (string, error) {
+	files, err := store.List(ctx, dir+"/")
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for _, f := range files {
+		name := strings.TrimPrefix(f.Key, dir+"/")
+		if strings.Contains(name, "/") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if latest == "" || name > path.Base(latest) {
+			latest = f.Key
+		}
+	}
+	return latest, nil
+}
+
+func storedSHA256(ctx context.Context, store storage.Storage, key string) (string, error) {
+	r, err := store.Open(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
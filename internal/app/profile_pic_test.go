@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baptistax/idl/internal/downloader"
+	"github.com/baptistax/idl/internal/instagram"
+)
+
+func TestSaveProfilePictureKeepsEachChange(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = io.WriteString(w, "\xff\xd8\xff\xe0"+r.URL.Query().Get("v"))
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	dl := downloader.New(downloader.Options{OutputDir: root, Timeout: 5 * time.Second})
+	profile := instagram.Profile{Username: "nasa", ProfilePicURLHD: srv.URL + "?v=first"}
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	first, isNew, err := saveProfilePicture(context.Background(), dl, nil, "nasa", profile, day)
+	if err != nil || !isNew {
+		t.Fatalf("first save: path=%q new=%v err=%v", first, isNew, err)
+	}
+
+	again, isNew, err := saveProfilePicture(context.Background(), dl, nil, "nasa", profile, day.Add(24*time.Hour))
+	if err != nil || isNew || again != first {
+		t.Fatalf("unchanged save: path=%q new=%v err=%v", again, isNew, err)
+	}
+
+	profile.ProfilePicURLHD = srv.URL + "?v=second"
+	changed, isNew, err := saveProfilePicture(context.Background(), dl, nil, "nasa", profile, day.Add(48*time.Hour))
+	if err != nil || !isNew || changed == first {
+		t.Fatalf("changed save: path=%q new=%v err=%v", changed, isNew, err)
+	}
+
+	// Going back to the first avatar is a change too.
+	profile.ProfilePicURLHD = srv.URL + "?v=first"
+	back, isNew, err := saveProfilePicture(context.Background(), dl, nil, "nasa", profile, day.Add(72*time.Hour))
+	if err != nil || !isNew || back == first {
+		t.Fatalf("reverted save: path=%q new=%v err=%v", back, isNew, err)
+	}
+
+	// A change within the same second does not overwrite the previous version.
+	profile.ProfilePicURLHD = srv.URL + "?v=third"
+	third, isNew, err := saveProfilePicture(context.Background(), dl, nil, "nasa", profile, day.Add(72*time.Hour+300*time.Millisecond))
+	if err != nil || !isNew || third == back {
+		t.Fatalf("same-second save: path=%q new=%v err=%v", third, isNew, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, "nasa", profilePicDir))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 stored versions, got %d", len(entries))
+	}
+}
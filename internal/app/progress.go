@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"sync"
@@ -9,6 +10,7 @@ import (
 )
 
 type Progress struct {
+	w         io.Writer
 	label     string
 	done      int
 	failed    int
@@ -21,11 +23,14 @@ type Progress struct {
 	printMu   sync.Mutex
 }
 
-func NewProgress(label string) *Progress {
+// NewProgress returns a progress line written to w; it redraws itself in place when w is a
+// terminal.
+func NewProgress(w io.Writer, label string) *Progress {
 	return &Progress{
+		w:         w,
 		label:     strings.TrimSpace(label),
 		startedAt: time.Now(),
-		isTTY:     isStdoutTTY(),
+		isTTY:     isTerminal(w),
 	}
 }
 
@@ -69,7 +74,7 @@ func (p *Progress) Failed() int {
 func (p *Progress) Finish() {
 	p.print(true)
 	if p.isTTY {
-		fmt.Print("\n")
+		fmt.Fprint(p.w, "\n")
 	}
 }
 
@@ -83,7 +88,7 @@ func (p *Progress) print(force bool) {
 		if !force && now.Sub(p.lastPrint) < 1*time.Second {
 			return
 		}
-		fmt.Println(p.line())
+		fmt.Fprintln(p.w, p.line())
 		p.lastPrint = now
 		return
 	}
@@ -97,7 +102,7 @@ func (p *Progress) print(force bool) {
 		line = line + strings.Repeat(" ", p.lastLen-len(line))
 	}
 	p.lastLen = len(line)
-	fmt.Printf("\r%s", line)
+	fmt.Fprintf(p.w, "\r%s", line)
 	p.lastPrint = now
 }
 
@@ -168,8 +173,21 @@ func formatElapsed(d time.Duration) string {
 	return fmt.Sprintf("%02d:%02d", minutes, seconds)
 }
 
-func isStdoutTTY() bool {
-	fi, err := os.Stdout.Stat()
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return (fi.Mode() & os.ModeCharDevice) != 0
+}
+
+func isStdinTTY() bool {
+	fi, err := os.Stdin.Stat()
 	if err != nil {
 		return false
 	}
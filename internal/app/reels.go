@@ -0,0 +1,189 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/storage"
+)
+
+// reelMetadata is written next to every reel as <basename>.json.
+type reelMetadata struct {
+	ID            string `json:"id"`
+	Code          string `json:"code,omitempty"`
+	TakenAt       int64  `json:"taken_at,omitempty"`
+	PlayCount     int64  `json:"play_count"`
+	AudioTitle    string `json:"audio_title,omitempty"`
+	AudioArtist   string `json:"audio_artist,omitempty"`
+	OriginalAudio bool   `json:"original_audio"`
+	// InPosts is true when the video itself was already saved by the Posts / Reels stage,
+	// in which case only this metadata file is written under reels/.
+	InPosts bool `json:"in_posts"`
+}
+
+func newReelMetadata(m instagram.Media, inPosts bool) reelMetadata {
+	title, artist, original := m.Audio()
+	return reelMetadata{
+		ID:            mediaID(m),
+		Code:          m.Code,
+		TakenAt:       m.TakenAt,
+		PlayCount:     m.Plays(),
+		AudioTitle:    title,
+		AudioArtist:   artist,
+		OriginalAudio: original,
+		InPosts:       inPosts,
+	}
+}
+
+// downloadReels walks the Reels tab and saves each reel, its cover frame and its metadata into reels/.
+// Reels whose id is in timelineIDs, or whose video is already stored in posts/ by an earlier
+// run, only get their metadata written.
+func (s *session) downloadReels(ctx context.Context, timelineIDs map[string]struct{}) error {
+	inPostsDir, err := s.savedPostVideos(ctx)
+	if err != nil {
+		return err
+	}
+
+	var progress *Progress
+	defer func() {
+		if progress != nil {
+			progress.Finish()
+		}
+	}()
+
+	after := ""
+	firstErr := error(nil)
+	downloaded := 0
+	skipped := 0
+	filtered := 0
+	posts := 0
+	done := false
+	seen := map[string]struct{}{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		items, pageInfo, err := s.ig.FetchReelsPage(ctx, s.username, s.userID, after)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range items {
+			id := mediaID(m)
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+
+			if s.filter.reachedMax(posts) || s.filter.pastSince(m) {
+				done = true
+				break
+			}
+			if !s.filter.matchPost(m) {
+				filtered++
+				continue
+			}
+			posts++
+
+			base := mediaBaseName(m, "", 0)
+			_, inPosts := timelineIDs[id]
+			if _, ok := inPostsDir[base]; ok {
+				inPosts = true
+			}
+			if err := writeReelMetadata(ctx, s.store, s.key("reels", base+".json"), newReelMetadata(m, inPosts)); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if inPosts {
+				skipped++
+				continue
+			}
+
+			if progress == nil {
+				progress = NewProgress(s.out, "REELS")
+				progress.Start()
+			}
+			progress.AddTotal(1)
+
+			if err := s.downloadReel(ctx, base, m); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				progress.IncFail()
+			} else {
+				downloaded++
+				progress.IncOK()
+			}
+			if err := s.savePostText(ctx, "reels", base, m); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		if done || !pageInfo.HasNextPage || pageInfo.EndCursor == "" {
+			break
+		}
+		after = pageInfo.EndCursor
+		time.Sleep(250 * time.Millisecond)
+	}
+
+	failed := 0
+	if progress != nil {
+		failed = progress.Failed()
+		progress.Finish()
+		progress = nil
+	}
+	printSectionSummary(s.out, downloaded, failed)
+	printSectionSkipped(s.out, skipped, "already saved from posts")
+	printSectionSkipped(s.out, filtered, "filtered out")
+	return firstErr
+}
+
+// savedPostVideos returns the base names of the videos (and audio tracks) stored in posts/.
+// A reel saved from the timeline has the same base name there as under reels/.
+func (s *session) savedPostVideos(ctx context.Context) (map[string]struct{}, error) {
+	files, err := s.store.List(ctx, s.key("posts")+"/")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list posts: %v", err)
+	}
+	bases := make(map[string]struct{}, len(files))
+	for _, fi := range files {
+		name := path.Base(fi.Key)
+		switch ext := path.Ext(name); ext {
+		case ".mp4", ".m4a":
+			bases[strings.TrimSuffix(name, ext)] = struct{}{}
+		}
+	}
+	return bases, nil
+}
+
+// downloadReel saves a reel and its cover frame into reels/. The cover is always saved here,
+// regardless of --video-covers.
+func (s *session) downloadReel(ctx context.Context, base string, m instagram.Media) error {
+	if err := s.downloadMedia(ctx, "reels", m, 0); err != nil {
+		return err
+	}
+	if s.videoCovers && isVideoMedia(m) {
+		return nil
+	}
+	return s.saveVideoCover(ctx, "reels", base, m)
+}
+
+func writeReelMetadata(ctx context.Context, store storage.Storage, key string, meta reelMetadata) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := storage.WriteFile(ctx, store, key, data); err != nil {
+		return fmt.Errorf("unable to save %s: %v", path.Base(key), err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/baptistax/idl/internal/downloader"
+	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/storage"
+)
+
+func TestDownloadReelsSkipsReelsStoredInPosts(t *testing.T) {
+	t.Parallel()
+
+	ig, _ := fakeInstagram(t, func(name string, vars map[string]string) string {
+		return `{"status":"ok","data":{"xdt_api__v1__clips__user__connection_v2":{"edges":[
+{"node":{"media":{"pk":"7","code":"abc","taken_at":1700000000,"media_type":2,"play_count":10}}}],
+"page_info":{"has_next_page":false}}}}`
+	})
+
+	root := t.TempDir()
+	dl := downloader.New(downloader.Options{OutputDir: root, Timeout: 5 * time.Second})
+	s := &session{ig: ig, dl: dl, store: dl.Storage(), safeUser: "user", username: "user", userID: "1", out: io.Discard}
+	base := mediaBaseName(instagram.Media{PK: "7", TakenAt: 1700000000}, "", 0)
+	// Saved from the timeline by an earlier run, which this run did not walk.
+	if err := storage.WriteFile(context.Background(), s.store, s.key("posts", base+".mp4"), []byte("video")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := s.downloadReels(context.Background(), map[string]struct{}{}); err != nil {
+		t.Fatalf("downloadReels: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, "user", "reels"))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != base+".json" {
+		t.Fatalf("expected only the reel metadata, got %v", entries)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "user", "reels", base+".json"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var meta reelMetadata
+	if err := json.Unmarshal(data, &meta); err != nil || !meta.InPosts || meta.PlayCount != 10 {
+		t.Fatalf("unexpected metadata %+v (err %v)", meta, err)
+	}
+}
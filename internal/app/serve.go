@@ -0,0 +1,828 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/instagram"
+	"github.com/baptistax/idl/internal/storage"
+	"github.com/baptistax/idl/internal/utils"
+)
+
+//go:embed serve.html
+var serveHTML []byte
+
+// csrfPlaceholder is replaced with the CSRF token of the server in serve.html.
+const csrfPlaceholder = "__IDL_CSRF__"
+
+// catalogTTL bounds how long a scanned archive is reused. Syncs started from the server
+// invalidate the catalog of their target immediately.
+const catalogTTL = 30 * time.Second
+
+// syncEventLimit caps the events kept for replay to clients that connect late.
+const syncEventLimit = 1000
+
+// Serve exposes the archive over HTTP: the gallery of every target, a JSON API, caption
+// search and background re-syncs with live progress. It returns when ctx is cancelled.
+func Serve(ctx context.Context, cfg config.Config) error {
+	store, err := storage.Open(cfg.OutputRoot)
+	if err != nil {
+		return err
+	}
+	srv := newServer(ctx, store, cfg)
+
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+	listenHost, _, _ := net.SplitHostPort(cfg.Addr)
+	srv.hosts = localHosts(ln.Addr(), listenHost)
+	printBanner(os.Stdout)
+	printKV(os.Stdout, "Output", store.Location(""))
+	printKV(os.Stdout, "Listening", "http://"+displayAddr(ln.Addr()))
+
+	hs := &http.Server{Handler: srv, ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 1)
+	go func() { errc <- hs.Serve(ln) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = hs.Shutdown(shutdownCtx)
+	srv.wait()
+	return nil
+}
+
+func displayAddr(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if ok && tcp.IP.IsUnspecified() {
+		return net.JoinHostPort("localhost", strconv.Itoa(tcp.Port))
+	}
+	return addr.String()
+}
+
+// server implements Serve.
+type server struct {
+	ctx   context.Context
+	store storage.Storage
+	cfg   config.Config
+	mux   *http.ServeMux
+	// run starts a download; it is runShared outside tests.
+	run func(ctx context.Context, cfg config.Config, opts RunOptions) error
+	// csrf must be sent as X-CSRF-Token to start a sync. Only the home page knows it, and
+	// pages of other sites cannot read it.
+	csrf  string
+	index []byte
+	// hosts lists the accepted Host headers (see localHosts); other requests are refused.
+	hosts map[string]bool
+
+	mu       sync.Mutex
+	catalogs map[string]cachedCatalog
+	targets  *cachedTargets
+	syncs    map[string]*syncJob
+	running  sync.WaitGroup
+	// client and pacer are shared by every sync; the first sync creates them.
+	client *instagram.Client
+	pacer  *Pacer
+}
+
+type cachedCatalog struct {
+	cat    *catalog
+	loaded time.Time
+}
+
+type cachedTargets struct {
+	users  []string
+	loaded time.Time
+}
+
+func newServer(ctx context.Context, store storage.Storage, cfg config.Config) *server {
+	s := &server{
+		ctx:      ctx,
+		store:    store,
+		cfg:      cfg,
+		mux:      http.NewServeMux(),
+		catalogs: map[string]cachedCatalog{},
+		syncs:    map[string]*syncJob{},
+		csrf:     randomHex(16),
+	}
+	s.run = s.runShared
+	s.index = bytes.Replace(serveHTML, []byte(csrfPlaceholder), []byte(s.csrf), 1)
+	s.mux.HandleFunc("GET /{$}", s.handleIndex)
+	s.mux.HandleFunc("GET /u/{user}/{$}", s.handleGallery)
+	s.mux.HandleFunc("GET /u/{user}/{file...}", s.handleFile)
+	s.mux.HandleFunc("GET /api/targets", s.handleTargets)
+	s.mux.HandleFunc("GET /api/targets/{user}", s.handleTarget)
+	s.mux.HandleFunc("GET /api/targets/{user}/media", s.handleMedia)
+	s.mux.HandleFunc("GET /api/targets/{user}/media/{id}", s.handleMediaItem)
+	s.mux.HandleFunc("POST /api/targets/{user}/sync", s.handleSync)
+	s.mux.HandleFunc("GET /api/targets/{user}/events", s.handleEvents)
+	s.mux.HandleFunc("GET /api/search", s.handleSearch)
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.hosts[strings.ToLower(r.Host)] {
+		http.Error(w, "unknown host", http.StatusMisdirectedRequest)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// wait blocks until background syncs have stopped, then stops the shared pacer.
+func (s *server) wait() {
+	s.running.Wait()
+	s.mu.Lock()
+	if s.pacer != nil {
+		s.pacer.Stop()
+	}
+	s.mu.Unlock()
+}
+
+// runShared is RunWith with the Instagram client and pacer of the server, so that syncs
+// share one session and one request rate.
+func (s *server) runShared(ctx context.Context, cfg config.Config, opts RunOptions) error {
+	s.mu.Lock()
+	if s.client == nil {
+		ig, err := newInstagramClient(cfg)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		s.client = ig
+		s.pacer = newDefaultPacer()
+		s.pacer.Start()
+	}
+	opts.Client, opts.Pacer = s.client, s.pacer
+	s.mu.Unlock()
+	return RunWith(ctx, cfg, opts)
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(s.index)
+}
+
+func (s *server) handleGallery(w http.ResponseWriter, r *http.Request) {
+	cat, ok := s.catalogFor(w, r)
+	if !ok {
+		return
+	}
+	data, err := renderGallery(cat, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(data)
+}
+
+// handleFile serves a file of the user directory, with range support when the backend
+// returns seekable files (local directories).
+func (s *server) handleFile(w http.ResponseWriter, r *http.Request) {
+	user, ok := targetName(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	key, err := storage.CleanKey(user + "/" + r.PathValue("file"))
+	if err != nil || !strings.HasPrefix(key, user+"/") || strings.HasPrefix(path.Base(key), ".") {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := s.store.Stat(r.Context(), key)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	f, err := s.store.Open(r.Context(), key)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	defer f.Close()
+	if rs, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.ModTime, rs)
+		return
+	}
+	if ct := contentTypeOf(key); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	_, _ = io.Copy(w, f)
+}
+
+func contentTypeOf(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	case ".mp4":
+		return "video/mp4"
+	case ".m4a":
+		return "audio/mp4"
+	case ".json":
+		return "application/json"
+	case ".txt":
+		return "text/plain; charset=utf-8"
+	}
+	return ""
+}
+
+func writeStorageError(w http.ResponseWriter, r *http.Request, err error) {
+	if storage.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// targetSummary is returned by /api/targets.
+type targetSummary struct {
+	User       string           `json:"user"`
+	Posts      int              `json:"posts"`
+	Highlights int              `json:"highlights"`
+	Profile    *profileSnapshot `json:"profile,omitempty"`
+	ProfilePic string           `json:"profile_pic,omitempty"`
+	Sync       *syncStatus      `json:"sync,omitempty"`
+}
+
+func (s *server) handleTargets(w http.ResponseWriter, r *http.Request) {
+	users, err := s.listTargets(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]targetSummary, 0, len(users))
+	for _, user := range users {
+		cat, err := s.catalog(r.Context(), user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, s.summary(cat))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *server) handleTarget(w http.ResponseWriter, r *http.Request) {
+	cat, ok := s.catalogFor(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.summary(cat))
+}
+
+func (s *server) summary(cat *catalog) targetSummary {
+	t := targetSummary{
+		User:       cat.User,
+		Posts:      len(cat.Posts),
+		Highlights: len(cat.Highlights),
+		Profile:    cat.Profile,
+		ProfilePic: cat.ProfilePic,
+	}
+	s.mu.Lock()
+	if job := s.syncs[cat.User]; job != nil {
+		st := job.status()
+		t.Sync = &st
+	}
+	s.mu.Unlock()
+	return t
+}
+
+// mediaPage is returned by /api/targets/{user}/media.
+type mediaPage struct {
+	Total int           `json:"total"`
+	Items []archivePost `json:"items"`
+}
+
+// handleMedia lists the posts of a target, newest first. Query parameters: section (posts,
+// reels, tagged), type (image, video, audio), since and until (as for --since/--until), q
+// (caption search), limit (default 50) and offset.
+func (s *server) handleMedia(w http.ResponseWriter, r *http.Request) {
+	cat, ok := s.catalogFor(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	f, err := parseMediaQuery(q, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parsePage(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	matches := []archivePost{}
+	for _, p := range cat.Posts {
+		if f.match(p) {
+			matches = append(matches, p)
+		}
+	}
+	page := mediaPage{Total: len(matches), Items: []archivePost{}}
+	if offset < len(matches) {
+		page.Items = matches[offset:min(offset+limit, len(matches))]
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *server) handleMediaItem(w http.ResponseWriter, r *http.Request) {
+	cat, ok := s.catalogFor(w, r)
+	if !ok {
+		return
+	}
+	id := r.PathValue("id")
+	for _, p := range cat.Posts {
+		if p.ID == id || (p.Code != "" && p.Code == id) {
+			writeJSON(w, http.StatusOK, p)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// searchResult is one match of /api/search.
+type searchResult struct {
+	User string      `json:"user"`
+	Post archivePost `json:"post"`
+}
+
+// handleSearch finds posts whose caption contains every word of q (case-insensitive),
+// across all targets or the one given by target.
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	words := strings.Fields(strings.ToLower(q.Get("q")))
+	if len(words) == 0 {
+		http.Error(w, "missing q", http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parsePage(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	users := []string{q.Get("target")}
+	if users[0] == "" {
+		if users, err = s.listTargets(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var results []searchResult
+	for _, user := range users {
+		cat, err := s.catalog(r.Context(), user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, p := range cat.Posts {
+			if captionMatches(p.Caption, words) {
+				results = append(results, searchResult{User: cat.User, Post: p})
+			}
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Post.TakenAt.After(results[j].Post.TakenAt) })
+	out := struct {
+		Total   int            `json:"total"`
+		Results []searchResult `json:"results"`
+	}{Total: len(results), Results: []searchResult{}}
+	if offset < len(results) {
+		out.Results = results[offset:min(offset+limit, len(results))]
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func captionMatches(caption string, words []string) bool {
+	if caption == "" {
+		return false
+	}
+	caption = strings.ToLower(caption)
+	for _, w := range words {
+		if !strings.Contains(caption, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// mediaQuery filters the posts of a catalog.
+type mediaQuery struct {
+	section string
+	typ     string
+	since   time.Time
+	until   time.Time
+	words   []string
+}
+
+func parseMediaQuery(q map[string][]string, now time.Time) (mediaQuery, error) {
+	get := func(k string) string {
+		if v := q[k]; len(v) > 0 {
+			return strings.TrimSpace(v[0])
+		}
+		return ""
+	}
+	f := mediaQuery{section: get("section"), typ: get("type"), words: strings.Fields(strings.ToLower(get("q")))}
+	switch f.section {
+	case "", sectionPosts, sectionReels, sectionTagged:
+	default:
+		return f, fmt.Errorf("invalid section %q", f.section)
+	}
+	switch f.typ {
+	case "", itemImage, itemVideo, itemAudio:
+	default:
+		return f, fmt.Errorf("invalid type %q", f.typ)
+	}
+	var err error
+	if v := get("since"); v != "" {
+		if f.since, err = config.ParseTimeBound(v, now, false); err != nil {
+			return f, fmt.Errorf("invalid since: %v", err)
+		}
+	}
+	if v := get("until"); v != "" {
+		if f.until, err = config.ParseTimeBound(v, now, true); err != nil {
+			return f, fmt.Errorf("invalid until: %v", err)
+		}
+	}
+	return f, nil
+}
+
+func (f mediaQuery) match(p archivePost) bool {
+	if f.section != "" && p.Section != f.section {
+		return false
+	}
+	if !f.since.IsZero() && p.TakenAt.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !p.TakenAt.Before(f.until) {
+		return false
+	}
+	if len(f.words) > 0 && !captionMatches(p.Caption, f.words) {
+		return false
+	}
+	if f.typ != "" {
+		for _, it := range p.Items {
+			if it.Type == f.typ {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func parsePage(q map[string][]string) (limit, offset int, err error) {
+	limit = 50
+	if v := q["limit"]; len(v) > 0 && v[0] != "" {
+		if limit, err = strconv.Atoi(v[0]); err != nil || limit <= 0 {
+			return 0, 0, errors.New("invalid limit")
+		}
+	}
+	if v := q["offset"]; len(v) > 0 && v[0] != "" {
+		if offset, err = strconv.Atoi(v[0]); err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+	}
+	return limit, offset, nil
+}
+
+// targetName returns the sanitized {user} of a request.
+func targetName(r *http.Request) (string, bool) {
+	user := utils.SanitizePathSegment(strings.TrimPrefix(r.PathValue("user"), "@"))
+	return user, user != "" && user == r.PathValue("user")
+}
+
+// catalogFor loads the catalog of the request's {user}, answering 404 when there is no
+// archive for it.
+func (s *server) catalogFor(w http.ResponseWriter, r *http.Request) (*catalog, bool) {
+	user, ok := targetName(r)
+	if !ok {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	cat, err := s.catalog(r.Context(), user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if len(cat.Posts) == 0 && len(cat.Highlights) == 0 && cat.Profile == nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return cat, true
+}
+
+func (s *server) catalog(ctx context.Context, user string) (*catalog, error) {
+	s.mu.Lock()
+	c, ok := s.catalogs[user]
+	s.mu.Unlock()
+	if ok && time.Since(c.loaded) < catalogTTL {
+		return c.cat, nil
+	}
+	cat, err := loadCatalog(ctx, s.store, user)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.catalogs[user] = cachedCatalog{cat: cat, loaded: time.Now()}
+	s.mu.Unlock()
+	return cat, nil
+}
+
+// listTargets returns the user directories of the output, sorted.
+func (s *server) listTargets(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	t := s.targets
+	s.mu.Unlock()
+	if t != nil && time.Since(t.loaded) < catalogTTL {
+		return t.users, nil
+	}
+	files, err := s.store.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	users := []string{}
+	for _, f := range files {
+		user, rest, ok := strings.Cut(f.Key, "/")
+		if !ok || seen[user] || strings.HasPrefix(user, ".") {
+			continue
+		}
+		// Only directories written by idl count as targets.
+		if rest == profileLatestFile || strings.HasPrefix(rest, sectionPosts+"/") || strings.HasPrefix(rest, sectionReels+"/") ||
+			strings.HasPrefix(rest, sectionTagged+"/") || strings.HasPrefix(rest, "highlights/") {
+			seen[user] = true
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+	s.mu.Lock()
+	s.targets = &cachedTargets{users: users, loaded: time.Now()}
+	s.mu.Unlock()
+	return users, nil
+}
+
+// invalidate drops the cached scans after the archive of user changed.
+func (s *server) invalidate(user string) {
+	s.mu.Lock()
+	delete(s.catalogs, user)
+	s.targets = nil
+	s.mu.Unlock()
+}
+
+// syncJob is a background download started from the server.
+type syncJob struct {
+	user      string
+	startedAt time.Time
+
+	mu         sync.Mutex
+	events     []Event
+	subs       map[chan Event]struct{}
+	finishedAt time.Time
+	err        error
+	// The counts cover every event, not only the ones kept in events.
+	stage                  string
+	saved, failed, skipped int
+}
+
+// syncStatus describes a syncJob in the API.
+type syncStatus struct {
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Stage      string     `json:"stage,omitempty"`
+	Saved      int        `json:"saved"`
+	Failed     int        `json:"failed"`
+	Skipped    int        `json:"skipped"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func (j *syncJob) status() syncStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.statusLocked()
+}
+
+func (j *syncJob) statusLocked() syncStatus {
+	st := syncStatus{Running: j.finishedAt.IsZero(), StartedAt: j.startedAt}
+	if !j.finishedAt.IsZero() {
+		finished := j.finishedAt
+		st.FinishedAt = &finished
+	}
+	st.Stage, st.Saved, st.Failed, st.Skipped = j.stage, j.saved, j.failed, j.skipped
+	if j.err != nil {
+		st.Error = j.err.Error()
+	}
+	return st
+}
+
+func (j *syncJob) publish(e Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch e.Type {
+	case EventStageStarted:
+		j.stage = e.Stage
+	case EventFileSaved:
+		j.saved++
+	case EventFileFailed:
+		j.failed++
+	case EventFileSkipped:
+		j.skipped++
+	}
+	if len(j.events) == syncEventLimit {
+		j.events = append(j.events[:0:0], j.events[1:]...)
+	}
+	j.events = append(j.events, e)
+	for ch := range j.subs {
+		select {
+		case ch <- e:
+		default:
+			// A slow client misses events rather than stalling the download.
+		}
+	}
+}
+
+// subscribe returns the current status, the latest events and a channel with the following
+// ones. The channel is nil when the job has finished.
+func (j *syncJob) subscribe() (syncStatus, []Event, chan Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := j.statusLocked()
+	past := append([]Event(nil), j.events...)
+	if !j.finishedAt.IsZero() {
+		return st, past, nil
+	}
+	ch := make(chan Event, 64)
+	j.subs[ch] = struct{}{}
+	return st, past, ch
+}
+
+func (j *syncJob) unsubscribe(ch chan Event) {
+	j.mu.Lock()
+	delete(j.subs, ch)
+	j.mu.Unlock()
+}
+
+// handleSync starts a download of the target in the background, with the download flags
+// given to idl serve. Syncs run one at a time: it answers 409 while any sync is running. Only
+// targets that are already in the archive can be synced, and only from the home page: the
+// request must carry its CSRF token and must not come from another site.
+func (s *server) handleSync(w http.ResponseWriter, r *http.Request) {
+	if crossSite(r) || !tokenMatches(r.Header.Get("X-CSRF-Token"), s.csrf) {
+		http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+		return
+	}
+	user, ok := targetName(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	users, err := s.listTargets(r.Context())
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	if !slices.Contains(users, user) {
+		http.Error(w, "no archive for "+user, http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	for other, job := range s.syncs {
+		if job.status().Running {
+			s.mu.Unlock()
+			if other != user {
+				http.Error(w, "a sync of "+other+" is already running", http.StatusConflict)
+				return
+			}
+			writeJSON(w, http.StatusConflict, job.status())
+			return
+		}
+	}
+	job := &syncJob{user: user, startedAt: time.Now(), subs: map[chan Event]struct{}{}}
+	s.syncs[user] = job
+	s.running.Add(1)
+	s.mu.Unlock()
+
+	cfg := s.cfg
+	cfg.Command = config.CommandDownload
+	cfg.Username = user
+	cfg.PickHighlights = false
+	go func() {
+		defer s.running.Done()
+		// The console output of a sync would interleave with the server's own.
+		err := s.run(s.ctx, cfg, RunOptions{Observer: job.publish, Output: io.Discard})
+		if err != nil {
+			log.Printf("sync %s: %v", user, err)
+		}
+		s.invalidate(user)
+		job.mu.Lock()
+		job.err = err
+		job.finishedAt = time.Now()
+		for ch := range job.subs {
+			close(ch)
+		}
+		job.subs = nil
+		job.mu.Unlock()
+	}()
+	writeJSON(w, http.StatusAccepted, job.status())
+}
+
+// handleEvents streams the progress of the target's latest sync as server-sent events: a
+// "status" event with the counts so far, the latest events (up to syncEventLimit) as
+// "replay" events, then live ones until the sync finishes. Each event is a JSON Event; the
+// stream ends with a "done" event carrying the final status.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	user, ok := targetName(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	job := s.syncs[user]
+	s.mu.Unlock()
+	if job == nil {
+		http.Error(w, "no sync started for "+user, http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	st, past, ch := job.subscribe()
+	if ch != nil {
+		defer job.unsubscribe(ch)
+	}
+	writeSSE(w, "status", st)
+	for _, e := range past {
+		writeSSE(w, "replay", e)
+	}
+	flusher.Flush()
+	for ch != nil {
+		select {
+		case e, open := <-ch:
+			if !open {
+				ch = nil
+				break
+			}
+			writeSSE(w, "", e)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+	writeSSE(w, "done", job.status())
+	flusher.Flush()
+}
+
+func writeSSE(w io.Writer, event string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
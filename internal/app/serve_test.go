@@ -0,0 +1,297 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/storage"
+)
+
+func newTestServer(t *testing.T) (*server, *httptest.Server) {
+	t.Helper()
+	ctx := context.Background()
+	store := storage.NewFS(t.TempDir())
+	for key, data := range map[string]string{
+		"nasa/profile.json":                  `{"username":"nasa","full_name":"NASA"}`,
+		"nasa/posts/20240301_101010_100.jpg": "jpeg data",
+		"nasa/posts/20240301_101010_100.txt": "Launch day at the Cape",
+		"nasa/posts/20240201_090000_200.mp4": "video",
+		"nasa/posts/20240201_090000_200.txt": "Moon landing replay",
+		"esa/reels/20240101_000000_300.mp4":  "reel",
+		"esa/reels/20240101_000000_300.txt":  "Launch of Ariane",
+	} {
+		if err := storage.WriteFile(ctx, store, key, []byte(data)); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	srv := newServer(ctx, store, config.Config{})
+	ts := httptest.NewUnstartedServer(srv)
+	srv.hosts = localHosts(ts.Listener.Addr(), "")
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return srv, ts
+}
+
+func getJSON(t *testing.T, url string, v any) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("decode %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServeAPI(t *testing.T) {
+	t.Parallel()
+	_, ts := newTestServer(t)
+
+	var targets []targetSummary
+	getJSON(t, ts.URL+"/api/targets", &targets)
+	if len(targets) != 2 || targets[0].User != "esa" || targets[1].User != "nasa" || targets[1].Posts != 2 {
+		t.Fatalf("unexpected targets: %+v", targets)
+	}
+
+	var page mediaPage
+	getJSON(t, ts.URL+"/api/targets/nasa/media?type=video", &page)
+	if page.Total != 1 || page.Items[0].ID != "200" {
+		t.Fatalf("unexpected media page: %+v", page)
+	}
+	getJSON(t, ts.URL+"/api/targets/nasa/media?since=2024-02-15&limit=10", &page)
+	if page.Total != 1 || page.Items[0].ID != "100" {
+		t.Fatalf("unexpected media page: %+v", page)
+	}
+	if code := getJSON(t, ts.URL+"/api/targets/nasa/media?type=gif", nil); code != http.StatusBadRequest {
+		t.Fatalf("invalid type: status %d", code)
+	}
+
+	var post archivePost
+	getJSON(t, ts.URL+"/api/targets/nasa/media/100", &post)
+	if post.Caption != "Launch day at the Cape" || len(post.Items) != 1 {
+		t.Fatalf("unexpected post: %+v", post)
+	}
+	if code := getJSON(t, ts.URL+"/api/targets/nobody/media", nil); code != http.StatusNotFound {
+		t.Fatalf("unknown target: status %d", code)
+	}
+
+	var search struct {
+		Total   int            `json:"total"`
+		Results []searchResult `json:"results"`
+	}
+	getJSON(t, ts.URL+"/api/search?q=LAUNCH", &search)
+	if search.Total != 2 || search.Results[0].User != "nasa" || search.Results[1].User != "esa" {
+		t.Fatalf("unexpected search results: %+v", search)
+	}
+	getJSON(t, ts.URL+"/api/search?q=launch+cape", &search)
+	if search.Total != 1 {
+		t.Fatalf("unexpected search results: %+v", search)
+	}
+}
+
+func TestServeRejectsForeignHosts(t *testing.T) {
+	t.Parallel()
+	_, ts := newTestServer(t)
+	port := ts.URL[strings.LastIndex(ts.URL, ":")+1:]
+
+	for host, want := range map[string]int{
+		"localhost:" + port:      http.StatusOK,
+		"127.0.0.1:" + port:      http.StatusOK,
+		"[::1]:" + port:          http.StatusOK,
+		"LOCALHOST:" + port:      http.StatusOK,
+		"rebind.example:" + port: http.StatusMisdirectedRequest,
+		"localhost:1":            http.StatusMisdirectedRequest,
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/targets", nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET with Host %s: %v", host, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("Host %s: status %d, want %d", host, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestServeFilesAndGallery(t *testing.T) {
+	t.Parallel()
+	_, ts := newTestServer(t)
+
+	req, _ := http.NewRequest("GET", ts.URL+"/u/nasa/posts/20240301_101010_100.jpg", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "jpeg" {
+		t.Fatalf("range request: %d %q", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get(ts.URL + "/u/nasa/posts/missing.jpg")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing file: status %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/u/nasa/")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `src="posts/20240301_101010_100.jpg"`) {
+		t.Fatalf("gallery does not link the media: %s", body)
+	}
+}
+
+func TestServeSyncStreamsEvents(t *testing.T) {
+	t.Parallel()
+	srv, ts := newTestServer(t)
+
+	release := make(chan struct{})
+	srv.run = func(ctx context.Context, cfg config.Config, opts RunOptions) error {
+		obs := &observer{fn: opts.Observer, target: cfg.Username}
+		obs.emit(Event{Type: EventRunStarted})
+		obs.emit(Event{Type: EventStageStarted, Stage: StagePosts})
+		<-release
+		obs.emit(Event{Type: EventFileSaved, Key: cfg.Username + "/posts/x.jpg"})
+		obs.emit(Event{Type: EventStageFinished})
+		obs.emit(Event{Type: EventRunFinished})
+		return nil
+	}
+
+	// The home page carries the CSRF token.
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GET /: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), `content="`+srv.csrf+`"`) {
+		t.Fatal("home page lacks the CSRF token")
+	}
+	sync := func(user, token string, header map[string]string) int {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/targets/"+user+"/sync", nil)
+		if token != "" {
+			req.Header.Set("X-CSRF-Token", token)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := sync("nasa", "", nil); code != http.StatusForbidden {
+		t.Fatalf("sync without token: status %d", code)
+	}
+	if code := sync("nasa", srv.csrf, map[string]string{"Origin": "https://evil.example"}); code != http.StatusForbidden {
+		t.Fatalf("cross-site sync: status %d", code)
+	}
+	if code := sync("someone_else", srv.csrf, nil); code != http.StatusNotFound {
+		t.Fatalf("sync of a target outside the archive: status %d", code)
+	}
+	if code := sync("nasa", srv.csrf, map[string]string{"Sec-Fetch-Site": "same-origin"}); code != http.StatusAccepted {
+		t.Fatalf("sync: status %d", code)
+	}
+	if code := sync("nasa", srv.csrf, nil); code != http.StatusConflict {
+		t.Fatalf("second sync: status %d", code)
+	}
+	if code := sync("esa", srv.csrf, nil); code != http.StatusConflict {
+		t.Fatalf("sync of another target during a sync: status %d", code)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/targets/nasa/events")
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer resp.Body.Close()
+	close(release)
+
+	var types []string
+	var first, done syncStatus
+	sc := bufio.NewScanner(resp.Body)
+	last := ""
+	for sc.Scan() {
+		line := sc.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			last = name
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		name := last
+		last = ""
+		if name == "status" {
+			if err := json.Unmarshal([]byte(data), &first); err != nil {
+				t.Fatalf("status event: %v", err)
+			}
+			continue
+		}
+		if name == "done" {
+			if err := json.Unmarshal([]byte(data), &done); err != nil {
+				t.Fatalf("done event: %v", err)
+			}
+			break
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatalf("event: %v", err)
+		}
+		types = append(types, string(e.Type))
+	}
+	want := "run_started stage_started file_saved stage_finished run_finished"
+	if strings.Join(types, " ") != want {
+		t.Fatalf("events = %v, want %s", types, want)
+	}
+	if !first.Running || first.Stage != StagePosts {
+		t.Fatalf("unexpected initial status: %+v", first)
+	}
+	if done.Running || done.Saved != 1 || done.Stage != StagePosts {
+		t.Fatalf("unexpected final status: %+v", done)
+	}
+	srv.wait()
+}
+
+func TestSyncJobCountsEventsBeyondTheReplayLimit(t *testing.T) {
+	t.Parallel()
+	job := &syncJob{subs: map[chan Event]struct{}{}}
+	job.publish(Event{Type: EventStageStarted, Stage: StagePosts})
+	for range syncEventLimit + 10 {
+		job.publish(Event{Type: EventFileSaved})
+	}
+	job.publish(Event{Type: EventFileFailed})
+	st, past, _ := job.subscribe()
+	if len(past) != syncEventLimit {
+		t.Fatalf("kept %d events, want %d", len(past), syncEventLimit)
+	}
+	if st.Saved != syncEventLimit+10 || st.Failed != 1 || st.Stage != StagePosts {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+}
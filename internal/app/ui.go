@@ -2,11 +2,13 @@ package app
 
 import (
 	"fmt"
+	"io"
 	"strings"
 	"time"
 )
 
-func printBanner() {
+// printBanner writes the banner that starts the output of a command.
+func printBanner(w io.Writer) {
 	lines := []string{
 		" ___ ____  _      ",
 		"|_ _|  _ \\| |     ",
@@ -24,37 +26,43 @@ func printBanner() {
 	}
 
 	border := "+" + strings.Repeat("-", width+2) + "+"
-	fmt.Println(border)
+	fmt.Fprintln(w, border)
 	for _, line := range lines {
-		fmt.Printf("| %-*s |\n", width, line)
+		fmt.Fprintf(w, "| %-*s |\n", width, line)
 	}
-	fmt.Println(border)
+	fmt.Fprintln(w, border)
 }
 
-func printKV(label, value string) {
-	fmt.Printf("%-10s %s\n", label+":", value)
+func printKV(w io.Writer, label, value string) {
+	fmt.Fprintf(w, "%-10s %s\n", label+":", value)
 }
 
-func printSectionHeader(step, total int, title string) {
+func printSectionHeader(w io.Writer, step, total int, title string) {
 	header := title
 	if step > 0 && total > 0 {
 		header = fmt.Sprintf("[%d/%d] %s", step, total, title)
 	}
-	fmt.Printf("\n%s\n", header)
-	fmt.Println(strings.Repeat("-", len(header)))
+	fmt.Fprintf(w, "\n%s\n", header)
+	fmt.Fprintln(w, strings.Repeat("-", len(header)))
 }
 
-func printSectionSummary(downloaded, failed int) {
-	fmt.Printf("Saved: %d files\n", downloaded)
+func printSectionSummary(w io.Writer, downloaded, failed int) {
+	fmt.Fprintf(w, "Saved: %d files\n", downloaded)
 	if failed > 0 {
-		fmt.Printf("Failed: %d files\n", failed)
+		fmt.Fprintf(w, "Failed: %d files\n", failed)
 	}
 }
 
-func printFooter(elapsed time.Duration, success bool) {
+func printSectionSkipped(w io.Writer, skipped int, reason string) {
+	if skipped > 0 {
+		fmt.Fprintf(w, "Skipped: %d items (%s)\n", skipped, reason)
+	}
+}
+
+func printFooter(w io.Writer, elapsed time.Duration, success bool) {
 	label := "Finished in"
 	if !success {
 		label = "Stopped in"
 	}
-	fmt.Printf("\n%s %s\n", label, formatElapsed(elapsed))
+	fmt.Fprintf(w, "\n%s %s\n", label, formatElapsed(elapsed))
 }
@@ -0,0 +1,299 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/baptistax/idl/internal/blake3"
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/downloader"
+	"github.com/baptistax/idl/internal/integrity"
+	"github.com/baptistax/idl/internal/storage"
+	"github.com/baptistax/idl/internal/utils"
+)
+
+// corruptFile is a file of the archive that failed integrity.Check. rel is relative to the
+// user directory.
+type corruptFile struct {
+	rel     string
+	err     error
+	mediaID string
+}
+
+// Verify checks every image and video saved for a user and reports corrupt files. With
+// --checksums, the files listed in the SHA256SUMS and B3SUMS manifests are also re-hashed.
+// With --requeue, the corrupt files are removed and their media downloaded again.
+func Verify(ctx context.Context, cfg config.Config) error {
+	safeUser := utils.SanitizePathSegment(strings.TrimPrefix(strings.TrimSpace(cfg.Username), "@"))
+	store, err := storage.Open(cfg.OutputRoot)
+	if err != nil {
+		return err
+	}
+	userRoot := store.Location(safeUser)
+
+	checked, corrupt, err := scanArchive(ctx, store, safeUser)
+	if err != nil {
+		return fmt.Errorf("unable to scan %s: %v", userRoot, err)
+	}
+	if checked == 0 && !cfg.Checksums {
+		if files, err := store.List(ctx, safeUser+"/"); err == nil && len(files) == 0 {
+			return fmt.Errorf("no archive found at %s (run idl <username> first)", userRoot)
+		}
+	}
+
+	entries := 0
+	if cfg.Checksums {
+		n, mismatched, err := checkManifests(ctx, store, safeUser)
+		if err != nil {
+			return err
+		}
+		entries = n
+		corrupt = mergeCorrupt(corrupt, mismatched)
+	}
+
+	printBanner(os.Stdout)
+	printKV(os.Stdout, "Target", safeUser)
+	printKV(os.Stdout, "Checked", fmt.Sprintf("%d files", checked))
+	if cfg.Checksums {
+		printKV(os.Stdout, "Checksums", fmt.Sprintf("%d entries", entries))
+	}
+	printKV(os.Stdout, "Corrupt", fmt.Sprintf("%d files", len(corrupt)))
+	if len(corrupt) == 0 {
+		return nil
+	}
+
+	printSectionHeader(os.Stdout, 0, 0, "Corrupt files")
+	for _, c := range corrupt {
+		fmt.Printf("%s: %v\n", c.rel, c.err)
+	}
+	if !cfg.Requeue {
+		return fmt.Errorf("%d corrupt files (run idl verify --requeue %s to download them again)", len(corrupt), safeUser)
+	}
+
+	ids := []string(nil)
+	seen := map[string]struct{}{}
+	unknown := 0
+	for _, c := range corrupt {
+		if c.mediaID == "" {
+			unknown++
+			continue
+		}
+		if err := store.Remove(ctx, userKey(safeUser, c.rel)); err != nil {
+			return fmt.Errorf("unable to remove %s: %v", c.rel, err)
+		}
+		if _, ok := seen[c.mediaID]; !ok {
+			seen[c.mediaID] = struct{}{}
+			ids = append(ids, c.mediaID)
+		}
+	}
+	if unknown > 0 {
+		fmt.Printf("\n%d files cannot be matched to a post and were left in place.\n", unknown)
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("%d corrupt files", len(corrupt))
+	}
+
+	fmt.Printf("\nRe-downloading %d media items...\n", len(ids))
+	run := cfg
+	run.Command = config.CommandDownload
+	run.MediaIDs = ids
+	return Run(ctx, run)
+}
+
+// scanArchive checks every image and video stored for a user. Temporary files left by an
+// interrupted download are ignored.
+func scanArchive(ctx context.Context, store storage.Storage, safeUser string) (int, []corruptFile, error) {
+	files, err := store.List(ctx, safeUser+"/")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	checked := 0
+	var corrupt []corruptFile
+	manifests := map[string]*carouselManifest{}
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return checked, corrupt, err
+		}
+		name := path.Base(f.Key)
+		if strings.Contains(name, ".tmp") || !integrity.Checked(path.Ext(name)) {
+			continue
+		}
+
+		checked++
+		if err := checkStored(ctx, store, f.Key); err != nil {
+			if ctx.Err() != nil {
+				return checked, corrupt, ctx.Err()
+			}
+			c := corruptFile{rel: strings.TrimPrefix(f.Key, safeUser+"/"), err: err}
+			if !strings.HasPrefix(c.rel, profilePicDir+"/") {
+				c.mediaID = archivedMediaID(ctx, store, f.Key, manifests)
+			}
+			corrupt = append(corrupt, c)
+		}
+	}
+	sort.Slice(corrupt, func(i, j int) bool { return corrupt[i].rel < corrupt[j].rel })
+	return checked, corrupt, nil
+}
+
+func checkStored(ctx context.Context, store storage.Storage, key string) error {
+	r, err := store.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return integrity.Check(r, path.Ext(key))
+}
+
+// checkManifests re-hashes the files listed in the SHA256SUMS and B3SUMS manifests of a
+// user. Files that are missing or whose digest differs are returned as corrupt.
+func checkManifests(ctx context.Context, store storage.Storage, safeUser string) (int, []corruptFile, error) {
+	type manifest struct {
+		name string
+		hash func() hash.Hash
+	}
+	found := false
+	entries := 0
+	byRel := map[string]corruptFile{}
+	manifests := map[string]*carouselManifest{}
+	for _, m := range []manifest{
+		{downloader.SHA256SumsFile, sha256.New},
+		{downloader.BLAKE3SumsFile, blake3.New},
+	} {
+		sums, err := readChecksums(ctx, store, userKey(safeUser, m.name))
+		if storage.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("unable to read %s: %v", m.name, err)
+		}
+		found = true
+
+		names := make([]string, 0, len(sums))
+		for name := range sums {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := ctx.Err(); err != nil {
+				return 0, nil, err
+			}
+			entries++
+			if _, ok := byRel[name]; ok {
+				continue
+			}
+			key := userKey(safeUser, name)
+			got, err := hashStored(ctx, store, key, m.hash())
+			switch {
+			case storage.IsNotExist(err):
+				err = errors.New("missing file")
+			case err == nil && got != sums[name]:
+				err = fmt.Errorf("%s mismatch", strings.TrimSuffix(m.name, "SUMS"))
+			}
+			if err == nil {
+				continue
+			}
+			c := corruptFile{rel: name, err: err}
+			if !strings.HasPrefix(name, profilePicDir+"/") {
+				c.mediaID = archivedMediaID(ctx, store, key, manifests)
+			}
+			byRel[name] = c
+		}
+	}
+	if !found {
+		return 0, nil, fmt.Errorf("no %s or %s found in %s (download with --checksums first)", downloader.SHA256SumsFile, downloader.BLAKE3SumsFile, store.Location(safeUser))
+	}
+
+	corrupt := make([]corruptFile, 0, len(byRel))
+	for _, c := range byRel {
+		corrupt = append(corrupt, c)
+	}
+	sort.Slice(corrupt, func(i, j int) bool { return corrupt[i].rel < corrupt[j].rel })
+	return entries, corrupt, nil
+}
+
+func readChecksums(ctx context.Context, store storage.Storage, key string) (map[string]string, error) {
+	r, err := store.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return downloader.ParseChecksums(r, path.Base(key))
+}
+
+func hashStored(ctx context.Context, store storage.Storage, key string, h hash.Hash) (string, error) {
+	r, err := store.Open(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// mergeCorrupt adds the files of more that are not already in corrupt, keeping the result
+// sorted.
+func mergeCorrupt(corrupt, more []corruptFile) []corruptFile {
+	seen := map[string]struct{}{}
+	for _, c := range corrupt {
+		seen[c.rel] = struct{}{}
+	}
+	for _, c := range more {
+		if _, ok := seen[c.rel]; !ok {
+			corrupt = append(corrupt, c)
+		}
+	}
+	sort.Slice(corrupt, func(i, j int) bool { return corrupt[i].rel < corrupt[j].rel })
+	return corrupt
+}
+
+// archivedMediaID finds the media id of a saved file, from the manifest.json of a carousel
+// folder or from the YYYYMMDD_HHMMSS[_label]_<id>[_NN][_cover] filename. Files that do not
+// belong to a single media item (profile pictures, highlight covers) yield "".
+func archivedMediaID(ctx context.Context, store storage.Storage, key string, manifests map[string]*carouselManifest) string {
+	dir := path.Dir(key)
+	base := strings.TrimSuffix(strings.TrimSuffix(path.Base(key), path.Ext(key)), "_cover")
+
+	man, ok := manifests[dir]
+	if !ok {
+		man = readCarouselManifest(ctx, store, dir)
+		manifests[dir] = man
+	}
+	if man != nil {
+		for _, c := range man.Children {
+			if c.File != "" && strings.TrimSuffix(c.File, path.Ext(c.File)) == base {
+				return c.ID
+			}
+		}
+	}
+	return mediaIDFromBaseName(base)
+}
+
+func mediaIDFromBaseName(base string) string {
+	n, _ := parseArchivedName(base)
+	return n.id
+}
+
+func readCarouselManifest(ctx context.Context, store storage.Storage, dirKey string) *carouselManifest {
+	data, err := storage.ReadFile(ctx, store, path.Join(dirKey, "manifest.json"))
+	if err != nil {
+		return nil
+	}
+	var man carouselManifest
+	if err := json.Unmarshal(data, &man); err != nil {
+		return nil
+	}
+	return &man
+}
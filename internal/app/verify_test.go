@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/baptistax/idl/internal/downloader"
+	"github.com/baptistax/idl/internal/storage"
+)
+
+func TestMediaIDFromBaseName(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"20240304_050607_3312345678901234567":            "3312345678901234567",
+		"20240304_050607_3312345678901234567_02":         "3312345678901234567",
+		"20240304_050607_other.user_3312345678901234567": "3312345678901234567",
+		"20240304_050607_my_friend_123456_01":            "123456",
+		"cover":                                          "",
+		"01":                                             "",
+	}
+	for in, want := range cases {
+		if got := mediaIDFromBaseName(in); got != want {
+			t.Fatalf("mediaIDFromBaseName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestScanArchiveReportsCorruptFiles(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	write("posts/20240304_050607_111_01.jpg", "broken")
+	write("posts/20240304_050607_111.txt", "caption")
+	write("posts/20240304_050607_222.mp4.tmp", "partial")
+	write("posts/20240304_050607_Cabc/02_cover.jpg", "broken")
+	write("posts/20240304_050607_Cabc/manifest.json", `{"id":"p","children":[{"index":2,"id":"333","type":"video","file":"02.mp4"}]}`)
+	write("highlights/Trip/cover.jpg", "broken")
+
+	checked, corrupt, err := scanArchive(context.Background(), storage.NewFS(filepath.Dir(root)), filepath.Base(root))
+	if err != nil {
+		t.Fatalf("scanArchive: %v", err)
+	}
+	if checked != 3 || len(corrupt) != 3 {
+		t.Fatalf("unexpected scan: checked=%d corrupt=%+v", checked, corrupt)
+	}
+
+	ids := map[string]string{}
+	for _, c := range corrupt {
+		ids[filepath.ToSlash(c.rel)] = c.mediaID
+	}
+	want := map[string]string{
+		"posts/20240304_050607_111_01.jpg":        "111",
+		"posts/20240304_050607_Cabc/02_cover.jpg": "333",
+		"highlights/Trip/cover.jpg":               "",
+	}
+	for rel, id := range want {
+		if got, ok := ids[rel]; !ok || got != id {
+			t.Fatalf("%s: got id %q (reported %v), want %q", rel, got, ok, id)
+		}
+	}
+}
+
+func TestCheckManifestsReportsMismatchedAndMissingFiles(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	store := storage.NewFS(filepath.Dir(root))
+	if _, _, err := checkManifests(context.Background(), store, filepath.Base(root)); err == nil {
+		t.Fatalf("expected an error without manifests")
+	}
+
+	write := func(rel, content string) {
+		t.Helper()
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	sha := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	write("posts/20240304_050607_111.mp4", "intact")
+	write("posts/20240304_050607_222.mp4", "changed")
+	write(downloader.SHA256SumsFile, sha("intact")+"  posts/20240304_050607_111.mp4\n"+
+		sha("original")+"  posts/20240304_050607_222.mp4\n"+
+		sha("gone")+"  reels/20240304_050607_333.mp4\n")
+
+	entries, corrupt, err := checkManifests(context.Background(), store, filepath.Base(root))
+	if err != nil {
+		t.Fatalf("checkManifests: %v", err)
+	}
+	if entries != 3 || len(corrupt) != 2 {
+		t.Fatalf("unexpected result: entries=%d corrupt=%+v", entries, corrupt)
+	}
+	if c := corrupt[0]; filepath.ToSlash(c.rel) != "posts/20240304_050607_222.mp4" || c.mediaID != "222" || c.err.Error() != "SHA256 mismatch" {
+		t.Fatalf("unexpected mismatch entry: %+v", c)
+	}
+	if c := corrupt[1]; filepath.ToSlash(c.rel) != "reels/20240304_050607_333.mp4" || c.mediaID != "333" || c.err.Error() != "missing file" {
+		t.Fatalf("unexpected missing entry: %+v", c)
+	}
+}
@@ -0,0 +1,231 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+	"github.com/baptistax/idl/internal/notify"
+	"github.com/baptistax/idl/internal/utils"
+)
+
+// watchOverlap is how far before the last successful check a check starts looking, so that
+// posts published while a check ran (or with a slightly earlier timestamp) are not missed.
+// Files saved by the previous check are skipped.
+const watchOverlap = 24 * time.Hour
+
+// watchBackoff is the delay before retrying a target whose check failed. It doubles with
+// each consecutive failure, up to the interval.
+const watchBackoff = time.Minute
+
+// watchTarget is the state of one watched target, as kept in the state file.
+type watchTarget struct {
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	Failures    int        `json:"failures,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+
+	// next is when the target is checked again.
+	next time.Time
+}
+
+// Watch checks cfg.Targets for new posts every cfg.Interval (plus a random delay up to
+// cfg.Jitter) until ctx is cancelled. After a successful check, only items newer than that
+// check are fetched; failed checks are retried with backoff. The checks of each cycle are
+// reported to the --notify sinks together.
+func Watch(ctx context.Context, cfg config.Config) error {
+	ig, err := newInstagramClient(cfg)
+	if err != nil {
+		return err
+	}
+	pacer := newDefaultPacer()
+	pacer.Start()
+	defer pacer.Stop()
+
+	w, err := newWatcher(cfg, func(ctx context.Context, cfg config.Config, opts RunOptions) error {
+		opts.Client = ig
+		opts.Pacer = pacer
+		return RunWith(ctx, cfg, opts)
+	})
+	if err != nil {
+		return err
+	}
+	printBanner(os.Stdout)
+	printKV(os.Stdout, "Targets", strings.Join(cfg.Targets, ", "))
+	printKV(os.Stdout, "Interval", fmt.Sprintf("%s (+ up to %s)", cfg.Interval, cfg.Jitter))
+	printKV(os.Stdout, "State", cfg.StatePath)
+	fmt.Println()
+	w.loop(ctx)
+	return nil
+}
+
+// watcher implements Watch.
+type watcher struct {
+	cfg     config.Config
+	run     func(ctx context.Context, cfg config.Config, opts RunOptions) error
+	backoff time.Duration
+	notify  *notify.Notifier
+	// now and after are time.Now and time.After outside tests.
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+
+	targets map[string]*watchTarget
+	cycle   int
+}
+
+func newWatcher(cfg config.Config, run func(context.Context, config.Config, RunOptions) error) (*watcher, error) {
+	n, err := newNotifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{
+		cfg:     cfg,
+		run:     run,
+		backoff: watchBackoff,
+		notify:  n,
+		now:     time.Now,
+		after:   time.After,
+		targets: map[string]*watchTarget{},
+	}
+	data, err := os.ReadFile(cfg.StatePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read watch state: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &w.targets); err != nil {
+			return nil, fmt.Errorf("invalid watch state %s: %v", cfg.StatePath, err)
+		}
+	}
+	now := w.now()
+	for _, name := range cfg.Targets {
+		t := w.target(name)
+		// A restart does not check again targets that were checked recently.
+		if t.LastSuccess != nil && t.Failures == 0 {
+			if next := t.LastSuccess.Add(cfg.Interval); next.After(now) {
+				t.next = next
+			}
+		}
+	}
+	return w, nil
+}
+
+func (w *watcher) target(name string) *watchTarget {
+	key := strings.ToLower(name)
+	t := w.targets[key]
+	if t == nil {
+		t = &watchTarget{}
+		w.targets[key] = t
+	}
+	return t
+}
+
+// loop runs the checks that are due, then sleeps until the next one, until ctx is cancelled.
+func (w *watcher) loop(ctx context.Context) {
+	for {
+		now := w.now()
+		var due []string
+		next := time.Time{}
+		for _, name := range w.cfg.Targets {
+			t := w.target(name)
+			if !t.next.After(now) {
+				due = append(due, name)
+			} else if next.IsZero() || t.next.Before(next) {
+				next = t.next
+			}
+		}
+		if len(due) > 0 {
+			w.cycle++
+			report := notify.Report{StartedAt: now}
+			for _, name := range due {
+				if ctx.Err() != nil {
+					break
+				}
+				if res, ok := w.check(ctx, name); ok {
+					report.Targets = append(report.Targets, res)
+				}
+			}
+			w.save()
+			report.FinishedAt = w.now()
+			sendReport(ctx, w.notify, report)
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.after(next.Sub(now)):
+		}
+	}
+}
+
+// check downloads what is new for one target and schedules its next check. It reports false
+// when the check was interrupted by ctx.
+func (w *watcher) check(ctx context.Context, name string) (notify.TargetResult, bool) {
+	t := w.target(name)
+	cfg := w.cfg
+	cfg.Command = config.CommandDownload
+	cfg.Username = name
+	if t.LastSuccess != nil {
+		if since := t.LastSuccess.Add(-watchOverlap); since.After(cfg.Since) {
+			cfg.Since = since
+		}
+		cfg.SkipExisting = true
+	}
+
+	rec := newRunRecorder(name)
+	startedAt := w.now()
+	err := w.run(ctx, cfg, RunOptions{Observer: rec.observe})
+	if ctx.Err() != nil {
+		// Stopped: check again on the next start.
+		return notify.TargetResult{}, false
+	}
+	result := rec.result(err)
+	now := w.now()
+	elapsed := now.Sub(startedAt).Round(time.Second)
+	t.LastAttempt = &startedAt
+	if err != nil {
+		t.Failures++
+		t.LastError = err.Error()
+		retry := min(w.backoff<<min(t.Failures-1, 16), w.cfg.Interval)
+		t.next = now.Add(w.delay(retry))
+		log.Printf("cycle %d: %s failed after %s (%d saved, %d failed): %v; retrying in %s",
+			w.cycle, name, elapsed, result.Saved, result.Failed, err, t.next.Sub(now).Round(time.Second))
+		return result, true
+	}
+	t.LastSuccess = &startedAt
+	t.Failures = 0
+	t.LastError = ""
+	t.next = now.Add(w.delay(w.cfg.Interval))
+	log.Printf("cycle %d: %s checked in %s: %d new, %d skipped; next check in %s",
+		w.cycle, name, elapsed, result.Saved, result.Skipped, t.next.Sub(now).Round(time.Second))
+	return result, true
+}
+
+// delay adds the random jitter to d.
+func (w *watcher) delay(d time.Duration) time.Duration {
+	if w.cfg.Jitter > 0 {
+		d += rand.N(w.cfg.Jitter)
+	}
+	return d
+}
+
+// save writes the state file. A failure is logged: the next check simply fetches more.
+func (w *watcher) save() {
+	data, err := json.MarshalIndent(w.targets, "", "  ")
+	if err == nil {
+		data = append(data, '\n')
+		err = utils.WriteFileAtomic(w.cfg.StatePath, data)
+	}
+	if err != nil {
+		log.Printf("unable to save watch state: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/baptistax/idl/internal/config"
+)
+
+// fakeClock stands in for the clock of a watcher: waiting moves it forward at once.
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) after(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestWatchFetchesIncrementallyAndRetries(t *testing.T) {
+	t.Parallel()
+	state := filepath.Join(t.TempDir(), "watch.json")
+	cfg := config.Config{Targets: []string{"nasa"}, StatePath: state, Interval: time.Hour}
+
+	var calls []config.Config
+	ctx, cancel := context.WithCancel(context.Background())
+	run := func(ctx context.Context, cfg config.Config, opts RunOptions) error {
+		calls = append(calls, cfg)
+		switch len(calls) {
+		case 1:
+			return nil
+		case 2:
+			return errors.New("rate limited")
+		case 4:
+			cancel()
+		}
+		opts.Observer(Event{Type: EventRunFinished, Saved: 1})
+		return nil
+	}
+	w, err := newWatcher(cfg, run)
+	if err != nil {
+		t.Fatalf("newWatcher: %v", err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	w.now = func() time.Time { return clock.now }
+	w.after = clock.after
+	w.loop(ctx)
+
+	if len(calls) != 4 {
+		t.Fatalf("got %d checks, want 4", len(calls))
+	}
+	// A check every interval, and a retry after the backoff when the second one failed.
+	if want := []time.Duration{time.Hour, watchBackoff, time.Hour}; !slices.Equal(clock.waits, want) {
+		t.Fatalf("waits = %v, want %v", clock.waits, want)
+	}
+	if first := calls[0]; first.Username != "nasa" || !first.Since.IsZero() || first.SkipExisting {
+		t.Fatalf("first check is not a full download: %+v", first)
+	}
+	// The failed check does not move the start of the next one.
+	for i, since := range []time.Time{start, start, start.Add(time.Hour + watchBackoff)} {
+		c := calls[i+1]
+		if want := since.Add(-watchOverlap); !c.Since.Equal(want) || !c.SkipExisting {
+			t.Fatalf("check %d: since %v, skip existing %v; want since %v", i+2, c.Since, c.SkipExisting, want)
+		}
+	}
+
+	// The state survives a restart.
+	w, err = newWatcher(config.Config{Targets: []string{"NASA"}, StatePath: state, Interval: time.Hour}, run)
+	if err != nil {
+		t.Fatalf("newWatcher: %v", err)
+	}
+	tgt := w.target("nasa")
+	if tgt.LastSuccess == nil || !tgt.LastSuccess.Equal(start.Add(time.Hour+watchBackoff)) || tgt.Failures != 0 {
+		t.Fatalf("unexpected state after restart: %+v", tgt)
+	}
+}
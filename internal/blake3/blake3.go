@@ -0,0 +1,251 @@
+// Package blake3 implements the BLAKE3 hash function (default hashing mode, 32-byte output).
+//
+// It follows the portable reference implementation and favours clarity over speed; it is
+// used for optional archive checksums, where throughput is bounded by the network.
+package blake3
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	// Size is the default output length in bytes.
+	Size = 32
+	// BlockSize is the compression function block size in bytes.
+	BlockSize = 64
+
+	chunkLen = 1024
+
+	chunkStart = 1 << 0
+	chunkEnd   = 1 << 1
+	parent     = 1 << 2
+	root       = 1 << 3
+)
+
+var iv = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A,
+	0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+var msgPermutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+func g(s *[16]uint32, a, b, c, d int, mx, my uint32) {
+	s[a] = s[a] + s[b] + mx
+	s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+	s[c] = s[c] + s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+	s[a] = s[a] + s[b] + my
+	s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+	s[c] = s[c] + s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+}
+
+func round(s *[16]uint32, m *[16]uint32) {
+	// Columns.
+	g(s, 0, 4, 8, 12, m[0], m[1])
+	g(s, 1, 5, 9, 13, m[2], m[3])
+	g(s, 2, 6, 10, 14, m[4], m[5])
+	g(s, 3, 7, 11, 15, m[6], m[7])
+	// Diagonals.
+	g(s, 0, 5, 10, 15, m[8], m[9])
+	g(s, 1, 6, 11, 12, m[10], m[11])
+	g(s, 2, 7, 8, 13, m[12], m[13])
+	g(s, 3, 4, 9, 14, m[14], m[15])
+}
+
+func permute(m *[16]uint32) {
+	var p [16]uint32
+	for i := range p {
+		p[i] = m[msgPermutation[i]]
+	}
+	*m = p
+}
+
+func compress(cv *[8]uint32, block *[16]uint32, counter uint64, blockLen, flags uint32) [16]uint32 {
+	s := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		iv[0], iv[1], iv[2], iv[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+	m := *block
+	for r := 0; r < 7; r++ {
+		round(&s, &m)
+		if r < 6 {
+			permute(&m)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		s[i] ^= s[i+8]
+		s[i+8] ^= cv[i]
+	}
+	return s
+}
+
+func first8(s [16]uint32) [8]uint32 {
+	var cv [8]uint32
+	copy(cv[:], s[:8])
+	return cv
+}
+
+func wordsFromBlock(b []byte) [16]uint32 {
+	var buf [BlockSize]byte
+	copy(buf[:], b)
+	var w [16]uint32
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(buf[i*4:])
+	}
+	return w
+}
+
+// output is a compression input that can produce either a chaining value or the root hash.
+type output struct {
+	cv       [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o output) chainingValue() [8]uint32 {
+	return first8(compress(&o.cv, &o.block, o.counter, o.blockLen, o.flags))
+}
+
+func (o output) rootBytes(out []byte) {
+	var buf [BlockSize]byte
+	for counter := uint64(0); len(out) > 0; counter++ {
+		words := compress(&o.cv, &o.block, counter, o.blockLen, o.flags|root)
+		for i, w := range words {
+			binary.LittleEndian.PutUint32(buf[i*4:], w)
+		}
+		out = out[copy(out, buf[:]):]
+	}
+}
+
+type chunkState struct {
+	cv               [8]uint32
+	counter          uint64
+	block            [BlockSize]byte
+	blockLen         int
+	blocksCompressed int
+}
+
+func newChunkState(counter uint64) chunkState {
+	return chunkState{cv: iv, counter: counter}
+}
+
+func (c *chunkState) len() int {
+	return BlockSize*c.blocksCompressed + c.blockLen
+}
+
+func (c *chunkState) startFlag() uint32 {
+	if c.blocksCompressed == 0 {
+		return chunkStart
+	}
+	return 0
+}
+
+func (c *chunkState) update(p []byte) {
+	for len(p) > 0 {
+		if c.blockLen == BlockSize {
+			words := wordsFromBlock(c.block[:])
+			c.cv = first8(compress(&c.cv, &words, c.counter, BlockSize, c.startFlag()))
+			c.blocksCompressed++
+			c.block = [BlockSize]byte{}
+			c.blockLen = 0
+		}
+		n := copy(c.block[c.blockLen:], p)
+		c.blockLen += n
+		p = p[n:]
+	}
+}
+
+func (c *chunkState) output() output {
+	return output{
+		cv:       c.cv,
+		block:    wordsFromBlock(c.block[:c.blockLen]),
+		counter:  c.counter,
+		blockLen: uint32(c.blockLen),
+		flags:    c.startFlag() | chunkEnd,
+	}
+}
+
+func parentOutput(left, right [8]uint32) output {
+	var block [16]uint32
+	copy(block[:8], left[:])
+	copy(block[8:], right[:])
+	return output{cv: iv, block: block, blockLen: BlockSize, flags: parent}
+}
+
+// Hasher is an incremental BLAKE3 hasher. It implements hash.Hash.
+type Hasher struct {
+	chunk   chunkState
+	cvStack [][8]uint32
+}
+
+// New returns a BLAKE3 hasher with a 32-byte output.
+func New() hash.Hash {
+	return &Hasher{chunk: newChunkState(0)}
+}
+
+// Sum256 returns the BLAKE3 hash of data.
+func Sum256(data []byte) [Size]byte {
+	h := &Hasher{chunk: newChunkState(0)}
+	_, _ = h.Write(data)
+	var out [Size]byte
+	h.finalize(out[:])
+	return out
+}
+
+func (h *Hasher) Size() int      { return Size }
+func (h *Hasher) BlockSize() int { return BlockSize }
+
+func (h *Hasher) Reset() {
+	h.chunk = newChunkState(0)
+	h.cvStack = h.cvStack[:0]
+}
+
+func (h *Hasher) addChunkCV(cv [8]uint32, totalChunks uint64) {
+	// Merge completed subtrees: every trailing zero bit of the chunk count closes one.
+	for totalChunks&1 == 0 {
+		top := h.cvStack[len(h.cvStack)-1]
+		h.cvStack = h.cvStack[:len(h.cvStack)-1]
+		cv = parentOutput(top, cv).chainingValue()
+		totalChunks >>= 1
+	}
+	h.cvStack = append(h.cvStack, cv)
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// A full chunk is only finalized once more input arrives, because the last chunk
+		// of the input must be compressed with the root flag.
+		if h.chunk.len() == chunkLen {
+			cv := h.chunk.output().chainingValue()
+			total := h.chunk.counter + 1
+			h.addChunkCV(cv, total)
+			h.chunk = newChunkState(total)
+		}
+		take := min(chunkLen-h.chunk.len(), len(p))
+		h.chunk.update(p[:take])
+		p = p[take:]
+	}
+	return n, nil
+}
+
+func (h *Hasher) finalize(out []byte) {
+	o := h.chunk.output()
+	for i := len(h.cvStack) - 1; i >= 0; i-- {
+		o = parentOutput(h.cvStack[i], o.chainingValue())
+	}
+	o.rootBytes(out)
+}
+
+// Sum appends the hash to b without changing the hasher state.
+func (h *Hasher) Sum(b []byte) []byte {
+	var out [Size]byte
+	h.finalize(out[:])
+	return append(b, out[:]...)
+}
@@ -0,0 +1,60 @@
+package blake3
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// Inputs are the official test vector pattern: byte i is i % 251.
+func TestSum256MatchesReferenceVectors(t *testing.T) {
+	t.Parallel()
+
+	vectors := []struct {
+		n    int
+		want string
+	}{
+		{0, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+		{1, "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213"},
+		{1023, "10108970eeda3eb932baac1428c7a2163b0e924c9a9e25b35bba72b28f70bd11"},
+		{1024, "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+		{1025, "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+		{2048, "e776b6028c7cd22a4d0ba182a8bf62205d2ef576467e838ed6f2529b85fba24a"},
+		{2049, "5f4d72f40d7a5f82b15ca2b2e44b1de3c2ef86c426c95c1af0b6879522563030"},
+		{3072, "b98cb0ff3623be03326b373de6b9095218513e64f1ee2edd2525c7ad1e5cffd2"},
+		{3073, "7124b49501012f81cc7f11ca069ec9226cecb8a2c850cfe644e327d22d3e1cd3"},
+		{4096, "015094013f57a5277b59d8475c0501042c0b642e531b0a1c8f58d2163229e969"},
+	}
+	for _, v := range vectors {
+		in := make([]byte, v.n)
+		for i := range in {
+			in[i] = byte(i % 251)
+		}
+		got := Sum256(in)
+		if hex.EncodeToString(got[:]) != v.want {
+			t.Errorf("len %d: got %x, want %s", v.n, got, v.want)
+		}
+	}
+}
+
+func TestHasherIncrementalWritesMatchSum256(t *testing.T) {
+	t.Parallel()
+
+	in := make([]byte, 10000)
+	for i := range in {
+		in[i] = byte(i % 251)
+	}
+	want := Sum256(in)
+
+	h := New()
+	for rest, step := in, 1; len(rest) > 0; step = step*3 + 1 {
+		n := min(step, len(rest))
+		_, _ = h.Write(rest[:n])
+		rest = rest[n:]
+	}
+	if got := h.Sum(nil); hex.EncodeToString(got) != hex.EncodeToString(want[:]) {
+		t.Fatalf("incremental hash %x, want %x", got, want)
+	}
+	if again := h.Sum(nil); hex.EncodeToString(again) != hex.EncodeToString(want[:]) {
+		t.Fatal("Sum must not change the hasher state")
+	}
+}
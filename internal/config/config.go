@@ -2,9 +2,19 @@ package config
 
 import (
 	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/baptistax/idl/internal/storage"
 )
 
 const (
@@ -13,28 +23,461 @@ const (
 	DefaultUserAgent   = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
 )
 
+type Command string
+
+const (
+	CommandDownload Command = "download"
+	CommandHistory  Command = "history"
+	CommandVerify   Command = "verify"
+	CommandExport   Command = "export"
+	CommandGallery  Command = "gallery"
+	CommandServe    Command = "serve"
+	CommandDaemon   Command = "daemon"
+	CommandWatch    Command = "watch"
+)
+
+// Defaults of idl serve, idl daemon and idl watch.
+const (
+	DefaultServeAddr      = "localhost:8080"
+	DefaultDaemonAddr     = "localhost:8081"
+	DefaultStatePath      = "idl-jobs.json"
+	DefaultWatchStatePath = "idl-watch.json"
+	DefaultWatchInterval  = time.Hour
+	DefaultWatchJitter    = 10 * time.Minute
+)
+
+// DefaultHookTimeout bounds each run of --hook and each request to --hook-url.
+const DefaultHookTimeout = 30 * time.Second
+
+// Archive formats accepted by idl export --format.
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+)
+
+// Stages of a download run, in order. --stages selects a subset.
+var Stages = []string{"posts", "reels", "tagged", "highlights"}
+
+// Carousel layouts accepted by --layout.
+const (
+	LayoutFlat    = "flat"
+	LayoutFolders = "folders"
+)
+
 type Config struct {
+	Command     Command
 	Username    string
 	CookiesPath string
-	OutputRoot  string
-	UserAgent   string
+	// OutputRoot is a local directory or an s3://bucket/prefix location.
+	OutputRoot string
+	UserAgent  string
+
+	// HighlightTitles holds title patterns: globs matched case-insensitively, or regular
+	// expressions when wrapped in slashes (/^trip/). HighlightIDs holds exact highlight ids.
+	// When both are empty and PickHighlights is false, every highlight is downloaded.
+	HighlightTitles []string
+	HighlightIDs    []string
+	PickHighlights  bool
+
+	// Post filters. Since is inclusive and Until exclusive; zero values disable the bound.
+	// MaxPosts limits the number of posts per stage (0 means unlimited).
+	Since        time.Time
+	Until        time.Time
+	MaxPosts     int
+	OnlyVideos   bool
+	OnlyPhotos   bool
+	ProductTypes []string
+	// FilterExpr is a --filter expression (see package expr), applied to posts, reels,
+	// tagged posts and highlight items.
+	FilterExpr string
+	// Comments enables exporting the comments and replies of every post as JSON.
+	Comments bool
+	// VideoQuality selects the video representation: best, worst, <=720p, bandwidth<=2M
+	// or a comma-separated combination. It is parsed by instagram.ParseVideoQuality.
+	VideoQuality string
+	// ImageMaxWidth caps the width of downloaded images in pixels (0 means no cap).
+	ImageMaxWidth int
+	// AudioOnly saves only the audio track of videos as tagged .m4a files and implies OnlyVideos
+	// for posts, reels and tagged posts.
+	AudioOnly bool
+	// VideoCovers also saves the poster frame of every video as <basename>_cover.jpg.
+	VideoCovers bool
+	// Requeue makes idl verify re-download the media of corrupt files.
+	Requeue bool
+	// SkipExisting skips media whose file is already in the output.
+	SkipExisting bool
+	// Checksums maintains a SHA256SUMS manifest in the user directory while downloading; for
+	// idl verify it checks the files against the manifests. BLAKE3 also maintains B3SUMS and
+	// implies Checksums.
+	Checksums bool
+	BLAKE3    bool
+	// ToArchive makes a download run write a tar stream to this file ("-" for standard
+	// output) instead of the output directory.
+	ToArchive string
+	// ArchiveFormat and ArchiveFile are the --format and --file of idl export. ArchiveFile
+	// defaults to <username>.<format> and may be "-" for standard output.
+	ArchiveFormat string
+	ArchiveFile   string
+	// Stages restricts a download run to these stages (see Stages); empty means all.
+	Stages []string
+	// Addr is the listen address of idl serve and idl daemon.
+	Addr string
+	// StatePath is the job queue file of idl daemon, or the file where idl watch remembers
+	// its last checks. Workers caps the jobs the daemon runs at once; jobs of the same target
+	// never run at once.
+	StatePath string
+	Workers   int
+	// Token is the bearer token that every request to idl daemon must carry. It defaults to
+	// $IDL_TOKEN.
+	Token string
+	// HookCommand is run through the shell and HookURL receives a POST after every saved
+	// file and every finished stage and run, each within HookTimeout.
+	HookCommand string
+	HookURL     string
+	HookTimeout time.Duration
+	// NotifyPath is a JSON file of notification sinks (see package notify) that receive the
+	// results of runs, daemon jobs and watch cycles.
+	NotifyPath string
+	// Targets are the usernames checked by idl watch, every Interval plus up to Jitter.
+	Targets  []string
+	Interval time.Duration
+	Jitter   time.Duration
+	// MediaIDs restricts a download run to these media ids. It is not a flag; idl verify
+	// --requeue sets it to the media of the corrupt files.
+	MediaIDs []string
+	// Layout is "flat" (carousel children are saved next to other posts with a _NN suffix)
+	// or "folders" (each carousel gets its own folder with a manifest.json).
+	Layout string
 }
 
-func ParseArgs(args []string) (Config, error) {
-	if len(args) != 1 {
-		return Config{}, errors.New("usage: idl <username>")
-	}
-	username := strings.TrimSpace(args[0])
-	if username == "" {
-		return Config{}, errors.New("usage: idl <username>")
+const usage = "usage: idl [download] [flags] <username> | idl history [--output dir] <username> | idl verify [--requeue] [--checksums] [flags] <username> | idl export [--format zip|tar.gz] [--file path] <username> | idl gallery [--output dir] <username> | idl serve [--addr host:port] [flags] | idl daemon --token secret [--addr host:port] [--state file] [--workers n] [flags] | idl watch [--interval 1h] [--jitter 10m] [--state file] [flags] <username>..."
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return errors.New("value must not be empty")
 	}
+	*l = append(*l, v)
+	return nil
+}
 
-	return Config{
-		Username:    username,
+func ParseArgs(args []string) (Config, error) {
+	cfg := Config{
+		Command:     CommandDownload,
 		CookiesPath: filepath.Clean(DefaultCookiesPath),
 		OutputRoot:  filepath.Clean(DefaultOutputRoot),
 		UserAgent:   DefaultUserAgent,
-	}, nil
+	}
+
+	// A first argument naming a command selects it. A user named like a command is
+	// downloaded with "idl download <username>" or "idl -- <username>".
+	if len(args) > 0 {
+		switch Command(args[0]) {
+		case CommandDownload, CommandHistory, CommandVerify, CommandExport, CommandGallery, CommandServe, CommandDaemon, CommandWatch:
+			cfg.Command = Command(args[0])
+			args = args[1:]
+		}
+	}
+
+	fs := flag.NewFlagSet("idl", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var titles, ids, productTypes, stages stringList
+	var since, until string
+	fs.StringVar(&cfg.OutputRoot, "output", DefaultOutputRoot, "output directory or s3://bucket/prefix")
+	if cfg.Command == CommandExport {
+		fs.StringVar(&cfg.ArchiveFormat, "format", FormatZip, "archive format: zip or tar.gz")
+		fs.StringVar(&cfg.ArchiveFile, "file", "", "archive to write (default <username>.<format>, - for standard output)")
+	}
+	if cfg.Command == CommandServe {
+		fs.StringVar(&cfg.Addr, "addr", DefaultServeAddr, "listen address")
+	}
+	if cfg.Command == CommandDaemon {
+		fs.StringVar(&cfg.Addr, "addr", DefaultDaemonAddr, "listen address")
+		fs.StringVar(&cfg.StatePath, "state", DefaultStatePath, "job queue file")
+		fs.IntVar(&cfg.Workers, "workers", 2, "maximum jobs running at once")
+		fs.StringVar(&cfg.Token, "token", os.Getenv("IDL_TOKEN"), "bearer token required by the API (default $IDL_TOKEN)")
+	}
+	if cfg.Command == CommandDownload || cfg.Command == CommandDaemon || cfg.Command == CommandWatch {
+		fs.StringVar(&cfg.NotifyPath, "notify", "", "JSON file of notification sinks for run results")
+	}
+	if cfg.Command == CommandWatch {
+		fs.StringVar(&cfg.StatePath, "state", DefaultWatchStatePath, "file remembering the last check of each target")
+		fs.DurationVar(&cfg.Interval, "interval", DefaultWatchInterval, "time between checks of a target")
+		fs.DurationVar(&cfg.Jitter, "jitter", DefaultWatchJitter, "random delay added to each interval")
+	}
+	if cfg.Command == CommandDownload {
+		fs.StringVar(&cfg.ToArchive, "to-archive", "", "write a tar stream to this file (- for standard output; .tar.gz compresses) instead of --output")
+	}
+	if cfg.Command == CommandVerify {
+		fs.BoolVar(&cfg.Requeue, "requeue", false, "re-download the media of corrupt files")
+	}
+	// verify, serve, daemon and watch accept the download flags too, so that --requeue,
+	// re-syncs, jobs and checks download with the same options.
+	switch cfg.Command {
+	case CommandDownload, CommandVerify, CommandServe, CommandDaemon, CommandWatch:
+		fs.Var(&titles, "highlight", "download only highlights whose title matches (glob, or /regex/); repeatable")
+		fs.Var(&ids, "highlight-id", "download only the highlight with this id; repeatable")
+		fs.BoolVar(&cfg.PickHighlights, "pick-highlights", false, "choose highlights interactively")
+		fs.StringVar(&since, "since", "", "only posts taken at or after this date (YYYY-MM-DD, RFC 3339 or relative like 30d; units h, d, w, mo, y)")
+		fs.StringVar(&until, "until", "", "only posts taken before the end of this date (YYYY-MM-DD, RFC 3339 or relative like 7d; units h, d, w, mo, y)")
+		fs.IntVar(&cfg.MaxPosts, "max-posts", 0, "stop after this many posts per stage")
+		fs.BoolVar(&cfg.OnlyVideos, "only-videos", false, "download only videos")
+		fs.BoolVar(&cfg.OnlyPhotos, "only-photos", false, "download only photos")
+		fs.StringVar(&cfg.Layout, "layout", LayoutFlat, "carousel layout: flat or folders")
+		fs.StringVar(&cfg.VideoQuality, "video-quality", "best", "video quality: best, worst, <=720p, bandwidth<=2M")
+		fs.IntVar(&cfg.ImageMaxWidth, "image-max-width", 0, "maximum image width in pixels (0 = largest available)")
+		fs.BoolVar(&cfg.AudioOnly, "audio-only", false, "save only the audio of videos as .m4a")
+		fs.BoolVar(&cfg.VideoCovers, "video-covers", false, "also save the cover image of every video as <basename>_cover.jpg")
+		fs.BoolVar(&cfg.SkipExisting, "skip-existing", false, "do not download media whose file is already in the output")
+		fs.BoolVar(&cfg.Checksums, "checksums", false, "maintain a SHA256SUMS manifest (verify: check files against the manifests)")
+		fs.BoolVar(&cfg.BLAKE3, "blake3", false, "also maintain a B3SUMS manifest; implies --checksums")
+		fs.BoolVar(&cfg.Comments, "comments", false, "also export comments and replies of each post as JSON")
+		fs.StringVar(&cfg.FilterExpr, "filter", "", `only items matching this expression, e.g. 'caption~"#launch" && type == video'`)
+		fs.Var(&stages, "stages", "only run these stages: posts, reels, tagged, highlights; comma-separated, repeatable")
+		fs.StringVar(&cfg.HookCommand, "hook", "", "shell command run after every saved file, stage and run (event in IDL_* variables and JSON on stdin)")
+		fs.StringVar(&cfg.HookURL, "hook-url", "", "URL that receives a JSON POST after every saved file, stage and run")
+		fs.DurationVar(&cfg.HookTimeout, "hook-timeout", DefaultHookTimeout, "time limit of each hook")
+		fs.Var(&productTypes, "product-type", "only posts of these product types (clips, feed, carousel_container, ...); comma-separated, repeatable")
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return Config{}, fmt.Errorf("%v\n%s", err, usage)
+	}
+	switch cfg.Command {
+	case CommandServe, CommandDaemon:
+		if len(positional) != 0 {
+			return Config{}, errors.New(usage)
+		}
+	case CommandWatch:
+		if len(positional) == 0 {
+			return Config{}, errors.New(usage)
+		}
+		for _, p := range positional {
+			p = strings.TrimPrefix(strings.TrimSpace(p), "@")
+			if p == "" {
+				return Config{}, errors.New(usage)
+			}
+			if !slices.Contains(cfg.Targets, p) {
+				cfg.Targets = append(cfg.Targets, p)
+			}
+		}
+	default:
+		if len(positional) != 1 {
+			return Config{}, errors.New(usage)
+		}
+		cfg.Username = strings.TrimSpace(positional[0])
+		if cfg.Username == "" {
+			return Config{}, errors.New(usage)
+		}
+	}
+
+	for _, t := range titles {
+		if re, ok := TitleRegexp(t); ok {
+			if _, err := regexp.Compile(re); err != nil {
+				return Config{}, fmt.Errorf("invalid --highlight pattern %q: %v", t, err)
+			}
+		}
+	}
+	if bucket, _, ok := storage.ParseS3URL(cfg.OutputRoot); ok {
+		if bucket == "" {
+			return Config{}, fmt.Errorf("invalid --output %q (expected s3://bucket/prefix)", cfg.OutputRoot)
+		}
+	} else if strings.TrimSpace(cfg.OutputRoot) == "" {
+		return Config{}, errors.New("--output must not be empty")
+	} else {
+		cfg.OutputRoot = filepath.Clean(cfg.OutputRoot)
+	}
+
+	cfg.HighlightTitles = titles
+	cfg.HighlightIDs = ids
+
+	now := time.Now()
+	if since != "" {
+		if cfg.Since, err = ParseTimeBound(since, now, false); err != nil {
+			return Config{}, fmt.Errorf("invalid --since: %v", err)
+		}
+	}
+	if until != "" {
+		if cfg.Until, err = ParseTimeBound(until, now, true); err != nil {
+			return Config{}, fmt.Errorf("invalid --until: %v", err)
+		}
+	}
+	if !cfg.Since.IsZero() && !cfg.Until.IsZero() && !cfg.Since.Before(cfg.Until) {
+		return Config{}, errors.New("--since must be before --until")
+	}
+	if cfg.MaxPosts < 0 {
+		return Config{}, errors.New("--max-posts must not be negative")
+	}
+	if cfg.ImageMaxWidth < 0 {
+		return Config{}, errors.New("--image-max-width must not be negative")
+	}
+	if cfg.Layout == "" {
+		cfg.Layout = LayoutFlat
+	}
+	if cfg.Layout != LayoutFlat && cfg.Layout != LayoutFolders {
+		return Config{}, fmt.Errorf("invalid --layout %q (expected flat or folders)", cfg.Layout)
+	}
+	if cfg.OnlyVideos && cfg.OnlyPhotos {
+		return Config{}, errors.New("--only-videos and --only-photos are mutually exclusive")
+	}
+	if cfg.AudioOnly && cfg.OnlyPhotos {
+		return Config{}, errors.New("--audio-only and --only-photos are mutually exclusive")
+	}
+	if cfg.BLAKE3 {
+		cfg.Checksums = true
+	}
+	if cfg.Command == CommandExport {
+		if cfg.ArchiveFormat != FormatZip && cfg.ArchiveFormat != FormatTarGz {
+			return Config{}, fmt.Errorf("invalid --format %q (expected zip or tar.gz)", cfg.ArchiveFormat)
+		}
+		if cfg.ArchiveFile == "" {
+			cfg.ArchiveFile = strings.TrimPrefix(cfg.Username, "@") + "." + cfg.ArchiveFormat
+		}
+	}
+	if cfg.Command == CommandDaemon {
+		if cfg.Workers < 1 {
+			return Config{}, errors.New("--workers must be at least 1")
+		}
+		if strings.TrimSpace(cfg.StatePath) == "" {
+			return Config{}, errors.New("--state must not be empty")
+		}
+		if cfg.Token = strings.TrimSpace(cfg.Token); cfg.Token == "" {
+			return Config{}, errors.New("idl daemon needs an API token: set --token or IDL_TOKEN")
+		}
+	}
+	if cfg.HookURL != "" {
+		if u, err := url.Parse(cfg.HookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Config{}, fmt.Errorf("invalid --hook-url %q (expected an http or https URL)", cfg.HookURL)
+		}
+	}
+	if cfg.HookTimeout < 0 {
+		return Config{}, errors.New("--hook-timeout must not be negative")
+	}
+	if cfg.Command == CommandWatch {
+		if cfg.Interval <= 0 {
+			return Config{}, errors.New("--interval must be positive")
+		}
+		if cfg.Jitter < 0 {
+			return Config{}, errors.New("--jitter must not be negative")
+		}
+		if strings.TrimSpace(cfg.StatePath) == "" {
+			return Config{}, errors.New("--state must not be empty")
+		}
+		if cfg.PickHighlights {
+			return Config{}, errors.New("--pick-highlights is interactive and cannot be used with idl watch")
+		}
+	}
+	if cfg.Stages, err = ParseStages(stages); err != nil {
+		return Config{}, err
+	}
+	for _, v := range productTypes {
+		for _, pt := range strings.Split(v, ",") {
+			if pt = strings.ToLower(strings.TrimSpace(pt)); pt != "" {
+				cfg.ProductTypes = append(cfg.ProductTypes, pt)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// ParseStages parses comma-separated stage names, keeping the order of Stages. No names
+// yields nil (all stages).
+func ParseStages(values []string) ([]string, error) {
+	want := map[string]bool{}
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if !slices.Contains(Stages, name) {
+				return nil, fmt.Errorf("invalid stage %q (expected %s)", name, strings.Join(Stages, ", "))
+			}
+			want[name] = true
+		}
+	}
+	var out []string
+	for _, name := range Stages {
+		if want[name] {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+// ParseTimeBound parses an absolute date (YYYY-MM-DD, interpreted in UTC), an RFC 3339
+// timestamp or a relative age counted back from now: a number followed by h (hours),
+// d (days), w (weeks), mo (months) or y (years), such as 12h, 30d or 6mo.
+// When endOfDay is set, a plain date resolves to the start of the following day so
+// that the whole day is included by an exclusive upper bound.
+func ParseTimeBound(s string, now time.Time, endOfDay bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	num := strings.TrimRight(s, "abcdefghijklmnopqrstuvwxyz")
+	if n, err := strconv.Atoi(num); err == nil && n >= 0 {
+		switch s[len(num):] {
+		case "h":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, -n), nil
+		case "w":
+			return now.AddDate(0, 0, -7*n), nil
+		case "mo":
+			return now.AddDate(0, -n, 0), nil
+		case "y":
+			return now.AddDate(-n, 0, 0), nil
+		case "m":
+			// Rejected rather than guessed: it would read as minutes.
+			return time.Time{}, fmt.Errorf("ambiguous unit in %q (use %dmo for months)", s, n)
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q (use YYYY-MM-DD, RFC 3339 or a relative age with h, d, w, mo or y)", s)
+}
+
+// TitleRegexp reports whether a --highlight pattern is a /regex/ and returns the expression.
+func TitleRegexp(pattern string) (string, bool) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return pattern[1 : len(pattern)-1], true
+	}
+	return "", false
+}
+
+// parseInterspersed parses flags that may appear before or after positional arguments.
+// Every argument after "--" is positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
 }
 
 func ResolveCookiesPath(path string) string {
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseArgsAcceptsFlagsAfterUsername(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseArgs([]string{"nasa", "--highlight", "Trip*", "--highlight", "/^x/", "--highlight-id", "123"})
+	if err != nil {
+		t.Fatalf("ParseArgs: %v", err)
+	}
+	if cfg.Command != CommandDownload || cfg.Username != "nasa" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if len(cfg.HighlightTitles) != 2 || len(cfg.HighlightIDs) != 1 {
+		t.Fatalf("unexpected highlight selectors: %+v", cfg)
+	}
+}
+
+func TestParseArgsVerifyCommand(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseArgs([]string{"verify", "nasa", "--requeue", "--layout", "folders"})
+	if err != nil {
+		t.Fatalf("ParseArgs: %v", err)
+	}
+	if cfg.Command != CommandVerify || cfg.Username != "nasa" || !cfg.Requeue || cfg.Layout != LayoutFolders {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if _, err := ParseArgs([]string{"nasa", "--requeue"}); err == nil {
+		t.Fatal("--requeue should only be accepted by verify")
+	}
+}
+
+func TestParseArgsOutput(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseArgs([]string{"nasa", "--output", "s3://archive/instagram/", "--skip-existing"})
+	if err != nil {
+		t.Fatalf("ParseArgs: %v", err)
+	}
+	if cfg.OutputRoot != "s3://archive/instagram/" || !cfg.SkipExisting {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	cfg, err = ParseArgs([]string{"history", "--output", "archive/./ig/", "nasa"})
+	if err != nil {
+		t.Fatalf("ParseArgs: %v", err)
+	}
+	if cfg.OutputRoot != filepath.Join("archive", "ig") {
+		t.Fatalf("unexpected output: %q", cfg.OutputRoot)
+	}
+}
+
+func TestParseArgsExport(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseArgs([]string{"export", "@nasa"})
+	if err != nil {
+		t.Fatalf("ParseArgs: %v", err)
+	}
+	if cfg.Command != CommandExport || cfg.ArchiveFormat != FormatZip || cfg.ArchiveFile != "nasa.zip" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	cfg, err = ParseArgs([]string{"export", "nasa", "--format", "tar.gz", "--file", "-"})
+	if err != nil {
+		t.Fatalf("ParseArgs: %v", err)
+	}
+	if cfg.ArchiveFormat != FormatTarGz || cfg.ArchiveFile != "-" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	if _, err := ParseArgs([]string{"export", "nasa", "--format", "rar"}); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+	if _, err := ParseArgs([]string{"export", "nasa", "--to-archive", "-"}); err == nil {
+		t.Fatalf("expected error for --to-archive with export")
+	}
+}
+
+func TestParseArgsDaemon(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseArgs([]string{"daemon", "--token", "secret", "--workers", "4", "--stages", "reels,posts"})
+	if err != nil {
+		t.Fatalf("ParseArgs: %v", err)
+	}
+	if cfg.Command != CommandDaemon || cfg.Addr != DefaultDaemonAddr || cfg.StatePath != DefaultStatePath {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if cfg.Token != "secret" || cfg.Workers != 4 || len(cfg.Stages) != 2 || cfg.Stages[0] != "posts" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	for _, args := range [][]string{
+		{"daemon", "--token", "secret", "nasa"},
+		{"daemon", "--token", "secret", "--workers", "0"},
+		{"daemon", "--token", "secret", "--stages", "stories"},
+		{"daemon", "--token", " "},
+	} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Fatalf("expected error for %q", args)
+		}
+	}
+}
+
+func TestParseArgsWatch(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := ParseArgs([]string{"watch", "nasa", "@esa", "--interval", "30m", "nasa", "--notify", "notify.json"})
+	if err != nil {
+		t.Fatalf("ParseArgs: %v", err)
+	}
+	if cfg.Command != CommandWatch || len(cfg.Targets) != 2 || cfg.Targets[1] != "esa" {
+		t.Fatalf("unexpected targets: %+v", cfg.Targets)
+	}
+	if cfg.NotifyPath != "notify.json" {
+		t.Fatalf("unexpected notify path: %q", cfg.NotifyPath)
+	}
+	if cfg.Interval != 30*time.Minute || cfg.Jitter != DefaultWatchJitter || cfg.StatePath != DefaultWatchStatePath {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	for _, args := range [][]string{
+		{"watch"},
+		{"watch", "nasa", "--interval", "0s"},
+		{"watch", "nasa", "--jitter", "-1m"},
+		{"watch", "nasa", "--pick-highlights"},
+	} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Fatalf("expected error for %q", args)
+		}
+	}
+}
+
+func TestParseArgsRejectsInvalidInput(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range [][]string{
+		nil,
+		{"a", "b"},
+		{"nasa", "--highlight", "/[/"},
+		{"history"},
+		{"nasa", "--only-videos", "--only-photos"},
+		{"nasa", "--layout", "nested"},
+		{"nasa", "--audio-only", "--only-photos"},
+		{"nasa", "--image-max-width", "-1"},
+		{"nasa", "--since", "2024-02-01", "--until", "2024-01-01"},
+		{"nasa", "--output", "s3://"},
+		{"nasa", "--output", ""},
+		{"nasa", "--hook-url", "ftp://example.com/hook"},
+		{"nasa", "--hook-timeout", "-1s"},
+		{"history", "nasa", "--notify", "notify.json"},
+	} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Fatalf("expected error for %q", args)
+		}
+	}
+}
+
+func TestParseArgsDownloadsUsersNamedLikeCommands(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range [][]string{
+		{"download", "history"},
+		{"download", "--pick-highlights", "history"},
+		{"--", "history"},
+		{"--pick-highlights", "--", "history"},
+	} {
+		cfg, err := ParseArgs(args)
+		if err != nil {
+			t.Fatalf("ParseArgs(%q): %v", args, err)
+		}
+		if cfg.Command != CommandDownload || cfg.Username != "history" {
+			t.Fatalf("ParseArgs(%q) = %s %q, want a download of history", args, cfg.Command, cfg.Username)
+		}
+	}
+
+	cfg, err := ParseArgs([]string{"history", "nasa"})
+	if err != nil || cfg.Command != CommandHistory || cfg.Username != "nasa" {
+		t.Fatalf("history command: %+v, %v", cfg, err)
+	}
+}
+
+func TestParseTimeBound(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		in       string
+		endOfDay bool
+		want     time.Time
+	}{
+		{"2024-01-02", false, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"2024-01-02", true, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"30d", false, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{"2w", false, time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC)},
+		{"1mo", false, time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)},
+		{"12h", false, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"1y", false, time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC)},
+		{"2024-01-02T03:04:05Z", true, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		got, err := ParseTimeBound(tc.in, now, tc.endOfDay)
+		if err != nil {
+			t.Fatalf("ParseTimeBound(%q): %v", tc.in, err)
+		}
+		if !got.Equal(tc.want) {
+			t.Fatalf("ParseTimeBound(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"yesterday", "6m", "30", "d", "-2d", "3dd"} {
+		if _, err := ParseTimeBound(in, now, false); err == nil {
+			t.Fatalf("expected error for %q", in)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baptistax/idl/internal/blake3"
+	"github.com/baptistax/idl/internal/storage"
+)
+
+// Checksum manifests written under each user directory, in sha256sum/b3sum format.
+const (
+	SHA256SumsFile = "SHA256SUMS"
+	BLAKE3SumsFile = "B3SUMS"
+)
+
+// checksums keeps the manifests of every user directory touched by the Downloader. Entries
+// of files from earlier runs are loaded from disk, so a manifest grows incrementally and an
+// entry is replaced when its file is downloaded again. Manifests are rewritten atomically,
+// at most once per flushInterval and on FlushChecksums (only on FlushChecksums when the
+// storage is append-only).
+type checksums struct {
+	mu        sync.Mutex
+	store     storage.Storage
+	blake3    bool
+	dirs      map[string]*sumsDir
+	lastFlush time.Time
+}
+
+const flushInterval = time.Second
+
+type sumsDir struct {
+	sha256 map[string]string
+	blake3 map[string]string
+	dirty  bool
+}
+
+// fileHash hashes a file while it is written. A nil *fileHash discards its input.
+type fileHash struct {
+	sha256 hash.Hash
+	blake3 hash.Hash
+}
+
+func (h *fileHash) Write(p []byte) (int, error) {
+	if h == nil {
+		return len(p), nil
+	}
+	_, _ = h.sha256.Write(p)
+	if h.blake3 != nil {
+		_, _ = h.blake3.Write(p)
+	}
+	return len(p), nil
+}
+
+// newFileHash returns nil when checksums are disabled.
+func (d *Downloader) newFileHash() *fileHash {
+	if d.sums == nil {
+		return nil
+	}
+	h := &fileHash{sha256: sha256.New()}
+	if d.sums.blake3 {
+		h.blake3 = blake3.New()
+	}
+	return h
+}
+
+// recordChecksum stores the hash of the file saved under key.
+func (d *Downloader) recordChecksum(key string, h *fileHash) error {
+	if d.sums == nil || h == nil {
+		return nil
+	}
+	sha := hex.EncodeToString(h.sha256.Sum(nil))
+	b3 := ""
+	if h.blake3 != nil {
+		b3 = hex.EncodeToString(h.blake3.Sum(nil))
+	}
+	return d.sums.record(key, sha, b3)
+}
+
+// RecordChecksum records the hash of data, the content written to relPath outside the
+// Downloader (for example a file rewritten with tags). It is a no-op when checksums are
+// disabled.
+func (d *Downloader) RecordChecksum(relPath string, data []byte) error {
+	h := d.newFileHash()
+	if h == nil {
+		return nil
+	}
+	_, _ = h.Write(data)
+	return d.recordChecksum(filepath.ToSlash(relPath), h)
+}
+
+// FlushChecksums writes every manifest with pending changes.
+func (d *Downloader) FlushChecksums() error {
+	if d.sums == nil {
+		return nil
+	}
+	d.sums.mu.Lock()
+	defer d.sums.mu.Unlock()
+	return d.sums.flushLocked()
+}
+
+func (c *checksums) record(key, sha, b3 string) error {
+	user, name, ok := strings.Cut(key, "/")
+	if !ok || strings.HasPrefix(path.Base(name), ".") {
+		// Only files inside a user directory are tracked; hidden files are temporary.
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dir, err := c.dirLocked(user)
+	if err != nil {
+		return err
+	}
+	dir.sha256[name] = sha
+	if b3 != "" {
+		dir.blake3[name] = b3
+	}
+	dir.dirty = true
+
+	if storage.IsAppendOnly(c.store) || time.Since(c.lastFlush) < flushInterval {
+		return nil
+	}
+	return c.flushLocked()
+}
+
+func (c *checksums) dirLocked(user string) (*sumsDir, error) {
+	if dir, ok := c.dirs[user]; ok {
+		return dir, nil
+	}
+	sha, err := c.read(user + "/" + SHA256SumsFile)
+	if err != nil {
+		return nil, err
+	}
+	b3, err := c.read(user + "/" + BLAKE3SumsFile)
+	if err != nil {
+		return nil, err
+	}
+	if sha == nil {
+		sha = map[string]string{}
+	}
+	if b3 == nil {
+		b3 = map[string]string{}
+	}
+	dir := &sumsDir{sha256: sha, blake3: b3}
+	c.dirs[user] = dir
+	return dir, nil
+}
+
+func (c *checksums) flushLocked() error {
+	c.lastFlush = time.Now()
+	for user, dir := range c.dirs {
+		if !dir.dirty {
+			continue
+		}
+		if err := c.write(user+"/"+SHA256SumsFile, dir.sha256); err != nil {
+			return fmt.Errorf("unable to save %s: %v", SHA256SumsFile, err)
+		}
+		if c.blake3 {
+			if err := c.write(user+"/"+BLAKE3SumsFile, dir.blake3); err != nil {
+				return fmt.Errorf("unable to save %s: %v", BLAKE3SumsFile, err)
+			}
+		}
+		dir.dirty = false
+	}
+	return nil
+}
+
+// read loads a manifest from storage. A missing manifest yields nil.
+func (c *checksums) read(key string) (map[string]string, error) {
+	// Manifests are kept up to date even when the run is cancelled.
+	r, err := c.store.Open(context.Background(), key)
+	if storage.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ParseChecksums(r, path.Base(key))
+}
+
+func (c *checksums) write(key string, sums map[string]string) error {
+	return storage.WriteFile(context.Background(), c.store, key, []byte(FormatChecksums(sums)))
+}
+
+// checksumEscaper escapes file names as sha256sum does when they contain a backslash or a
+// line break; such lines start with a backslash.
+var checksumEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+
+// FormatChecksums renders sums (path to hex digest) as a manifest in sha256sum format,
+// sorted by path.
+func FormatChecksums(sums map[string]string) string {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		file := name
+		if strings.ContainsAny(file, "\\\n\r") {
+			b.WriteByte('\\')
+			file = checksumEscaper.Replace(file)
+		}
+		b.WriteString(sums[name])
+		b.WriteString("  ")
+		b.WriteString(file)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// ReadChecksumFile reads a local manifest (see ParseChecksums).
+func ReadChecksumFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseChecksums(f, filepath.Base(path))
+}
+
+// ParseChecksums parses a manifest in sha256sum format ("<hex>  <path>" per line, with
+// escaped paths on lines starting with a backslash) into a map from slash-separated path to
+// lowercase hex digest. name is used in error messages.
+func ParseChecksums(r io.Reader, name string) (map[string]string, error) {
+	sums := map[string]string{}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		escaped := strings.HasPrefix(text, `\`)
+		if escaped {
+			text = text[1:]
+		}
+		sum, file, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: malformed line", name, line)
+		}
+		// The second separator character is " " (text mode) or "*" (binary mode).
+		file = strings.TrimPrefix(strings.TrimPrefix(file, " "), "*")
+		if escaped {
+			if file, ok = unescapeChecksumName(file); !ok {
+				return nil, fmt.Errorf("%s:%d: invalid escape in file name", name, line)
+			}
+		}
+		sums[file] = strings.ToLower(sum)
+	}
+	return sums, sc.Err()
+}
+
+// unescapeChecksumName reverses checksumEscaper.
+func unescapeChecksumName(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			return "", false
+		}
+		switch s[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
@@ -0,0 +1,150 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baptistax/idl/internal/blake3"
+)
+
+func TestDownloadsMaintainChecksumManifests(t *testing.T) {
+	t.Parallel()
+
+	body := map[string]string{"/a": "first", "/b": "second", "/c": "replaced"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, body[r.URL.Path])
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	newDL := func() *Downloader {
+		return New(Options{OutputDir: dir, Timeout: 5 * time.Second, BLAKE3: true})
+	}
+	download := func(dl *Downloader, path, rel string) {
+		t.Helper()
+		if _, err := dl.DownloadToFile(context.Background(), srv.URL+path, rel); err != nil {
+			t.Fatalf("DownloadToFile: %v", err)
+		}
+	}
+
+	dl := newDL()
+	download(dl, "/a", filepath.Join("user", "posts", "a.mp4"))
+	download(dl, "/b", filepath.Join("user", "posts", "b.mp4"))
+	if err := dl.FlushChecksums(); err != nil {
+		t.Fatalf("FlushChecksums: %v", err)
+	}
+
+	// A later run keeps the entries of earlier runs and replaces re-downloaded files.
+	dl = newDL()
+	download(dl, "/c", filepath.Join("user", "posts", "a.mp4"))
+	if err := dl.FlushChecksums(); err != nil {
+		t.Fatalf("FlushChecksums: %v", err)
+	}
+
+	sha := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	b3 := func(s string) string {
+		sum := blake3.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "user", SHA256SumsFile))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	want := sha("replaced") + "  posts/a.mp4\n" + sha("second") + "  posts/b.mp4\n"
+	if string(data) != want {
+		t.Fatalf("unexpected %s:\n%s\nwant:\n%s", SHA256SumsFile, data, want)
+	}
+
+	sums, err := ReadChecksumFile(filepath.Join(dir, "user", BLAKE3SumsFile))
+	if err != nil {
+		t.Fatalf("ReadChecksumFile: %v", err)
+	}
+	if len(sums) != 2 || sums["posts/a.mp4"] != b3("replaced") || sums["posts/b.mp4"] != b3("second") {
+		t.Fatalf("unexpected %s: %v", BLAKE3SumsFile, sums)
+	}
+}
+
+func TestRecordChecksumAfterInPlaceChange(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "original")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	dl := New(Options{OutputDir: dir, Timeout: 5 * time.Second, Checksums: true})
+	rel := filepath.Join("user", "reels", "x.m4a")
+	path, err := dl.DownloadToFile(context.Background(), srv.URL, rel)
+	if err != nil {
+		t.Fatalf("DownloadToFile: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("tagged"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := dl.RecordChecksum(rel, []byte("tagged")); err != nil {
+		t.Fatalf("RecordChecksum: %v", err)
+	}
+	if err := dl.FlushChecksums(); err != nil {
+		t.Fatalf("FlushChecksums: %v", err)
+	}
+
+	sums, err := ReadChecksumFile(filepath.Join(dir, "user", SHA256SumsFile))
+	if err != nil {
+		t.Fatalf("ReadChecksumFile: %v", err)
+	}
+	sum := sha256.Sum256([]byte("tagged"))
+	if sums["reels/x.m4a"] != hex.EncodeToString(sum[:]) {
+		t.Fatalf("unexpected entry: %v", sums)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "user", BLAKE3SumsFile)); !os.IsNotExist(err) {
+		t.Fatalf("B3SUMS should not be written without BLAKE3, got err=%v", err)
+	}
+}
+
+func TestChecksumManifestEscapesFileNames(t *testing.T) {
+	t.Parallel()
+
+	sums := map[string]string{
+		"posts/a.jpg":          "aa",
+		"posts/line\nbreak":    "bb",
+		`posts/back\slash.mp4`: "cc",
+	}
+	text := FormatChecksums(sums)
+	want := "aa  posts/a.jpg\n\\cc  posts/back\\\\slash.mp4\n\\bb  posts/line\\nbreak\n"
+	if text != want {
+		t.Fatalf("FormatChecksums:\n%q\nwant\n%q", text, want)
+	}
+	got, err := ParseChecksums(strings.NewReader(text), SHA256SumsFile)
+	if err != nil {
+		t.Fatalf("ParseChecksums: %v", err)
+	}
+	if len(got) != len(sums) {
+		t.Fatalf("round trip: %q", got)
+	}
+	for name, sum := range sums {
+		if got[name] != sum {
+			t.Fatalf("round trip: %q", got)
+		}
+	}
+
+	for _, bad := range []string{"aa\n", "\\aa  posts/x\\t\n"} {
+		_, err := ParseChecksums(strings.NewReader(bad), SHA256SumsFile)
+		if err == nil || !strings.HasPrefix(err.Error(), SHA256SumsFile+":1:") {
+			t.Fatalf("ParseChecksums(%q): %v", bad, err)
+		}
+	}
+}
@@ -11,27 +11,39 @@ import (
 	"image/png"
 	"io"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/baptistax/idl/internal/utils"
+	"github.com/baptistax/idl/internal/integrity"
+	"github.com/baptistax/idl/internal/storage"
 	xwebp "golang.org/x/image/webp"
 )
 
 type Options struct {
 	OutputDir string
+	// Storage receives the downloaded files; relPath arguments are its keys. It defaults to
+	// a local directory at OutputDir.
+	Storage   storage.Storage
 	Timeout   time.Duration
 	UserAgent string
 	Referer   string
+	// VerifyMedia validates images and MP4 files (see integrity.Verifier) before they are
+	// kept. Incomplete responses are always rejected.
+	VerifyMedia bool
+	// Checksums maintains a SHA256SUMS manifest in every user directory (the first element
+	// of relPath). BLAKE3 additionally maintains B3SUMS. Files are hashed while they are written.
+	Checksums bool
+	BLAKE3    bool
 }
 
 type Downloader struct {
-	outputDir  string
+	store      storage.Storage
 	httpClient *http.Client
 	userAgent  string
 	referer    string
+	verify     bool
+	sums       *checksums
 }
 
 func New(opts Options) *Downloader {
@@ -41,26 +53,38 @@ func New(opts Options) *Downloader {
 	if opts.OutputDir == "" {
 		opts.OutputDir = "./out"
 	}
+	if opts.Storage == nil {
+		opts.Storage = storage.NewFS(opts.OutputDir)
+	}
 	if opts.Referer == "" {
 		opts.Referer = "https://www.instagram.com/"
 	}
-	return &Downloader{
-		outputDir: opts.OutputDir,
+	d := &Downloader{
+		store: opts.Storage,
 		httpClient: &http.Client{
 			Timeout: opts.Timeout,
 		},
 		userAgent: opts.UserAgent,
 		referer:   opts.Referer,
+		verify:    opts.VerifyMedia,
 	}
-}
-
-func (d *Downloader) DownloadToFile(ctx context.Context, url, relPath string) (string, error) {
-	if err := utils.EnsureDir(filepath.Dir(filepath.Join(d.outputDir, relPath))); err != nil {
-		return "", err
+	if opts.Checksums || opts.BLAKE3 {
+		d.sums = &checksums{
+			store:  opts.Storage,
+			blake3: opts.BLAKE3,
+			dirs:   map[string]*sumsDir{},
+		}
 	}
+	return d
+}
 
-	outPath := filepath.Join(d.outputDir, relPath)
+// Storage returns the backend the files are written to.
+func (d *Downloader) Storage() storage.Storage {
+	return d.store
+}
 
+// DownloadToFile streams url into relPath and returns the location of the saved file.
+func (d *Downloader) DownloadToFile(ctx context.Context, url, relPath string) (string, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return "", err
@@ -83,42 +107,20 @@ func (d *Downloader) DownloadToFile(ctx context.Context, url, relPath string) (s
 		return "", fmt.Errorf("status inesperado: %s", resp.Status)
 	}
 
-	tmpPath := outPath + ".tmp"
-	f, err := os.Create(tmpPath)
-	if err != nil {
-		return "", err
-	}
-
-	if _, err := io.Copy(f, resp.Body); err != nil {
-		_ = f.Close()
-		_ = os.Remove(tmpPath)
-		return "", err
-	}
-
-	if err := f.Close(); err != nil {
-		_ = os.Remove(tmpPath)
-		return "", err
-	}
-
-	if err := renameReplace(tmpPath, outPath); err != nil {
-		_ = os.Remove(tmpPath)
-		return "", err
-	}
-
-	return outPath, nil
+	return d.save(ctx, relPath, filepath.Ext(relPath), func(w io.Writer) error {
+		n, err := io.Copy(w, resp.Body)
+		if err != nil {
+			return err
+		}
+		return checkComplete(resp, n)
+	})
 }
 
 // DownloadImageAsJPEG downloads an image and ensures the output is a JPEG file.
 // If the response is a PNG or WebP, it is converted to JPEG (quality 95) and saved at relPath.
-// If conversion fails, no output file is created and an error is returned (callers may retry with another URL).
+// If conversion fails, the original image is kept with its own extension instead.
 // relPath is expected to end with ".jpg" or ".jpeg".
 func (d *Downloader) DownloadImageAsJPEG(ctx context.Context, url, relPath string) (string, error) {
-	if err := utils.EnsureDir(filepath.Dir(filepath.Join(d.outputDir, relPath))); err != nil {
-		return "", err
-	}
-
-	outPath := filepath.Join(d.outputDir, relPath)
-
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return "", err
@@ -142,34 +144,18 @@ func (d *Downloader) DownloadImageAsJPEG(ctx context.Context, url, relPath strin
 		return "", fmt.Errorf("unexpected status: %s", resp.Status)
 	}
 
-	tmpDownloadPath := outPath + ".tmp.download"
-	f, err := os.Create(tmpDownloadPath)
-	if err != nil {
-		return "", err
+	// Images are small enough to be held in memory, which lets them be converted before
+	// anything is written.
+	data, err := io.ReadAll(resp.Body)
+	if err == nil {
+		err = checkComplete(resp, int64(len(data)))
 	}
-
-	// Capture the first bytes for content sniffing.
-	sniff := make([]byte, 512)
-	n, readErr := io.ReadFull(resp.Body, sniff)
-	if readErr != nil && !errorsIsEOF(readErr) {
-		_ = f.Close()
-		_ = os.Remove(tmpDownloadPath)
-		return "", readErr
-	}
-	sniff = sniff[:n]
-	reader := io.MultiReader(bytes.NewReader(sniff), resp.Body)
-	if _, err := io.Copy(f, reader); err != nil {
-		_ = f.Close()
-		_ = os.Remove(tmpDownloadPath)
-		return "", err
-	}
-	if err := f.Close(); err != nil {
-		_ = os.Remove(tmpDownloadPath)
+	if err != nil {
 		return "", err
 	}
 
 	headerType := normalizeContentType(resp.Header.Get("Content-Type"))
-	sniffType := strings.ToLower(strings.TrimSpace(http.DetectContentType(sniff)))
+	sniffType := strings.ToLower(strings.TrimSpace(http.DetectContentType(data)))
 	contentType := headerType
 	// Prefer sniffed type when it is a known image subtype. This avoids conversion failures
 	// when servers mislabel Content-Type.
@@ -179,58 +165,83 @@ func (d *Downloader) DownloadImageAsJPEG(ctx context.Context, url, relPath strin
 	if contentType == "" {
 		contentType = sniffType
 	}
+	if d.verify {
+		if err := integrity.Check(bytes.NewReader(data), extFromContentType(contentType)); err != nil {
+			return "", fmt.Errorf("corrupt download: %v", err)
+		}
+	}
 
+	key, out := imageToSave(relPath, contentType, data)
+	return d.save(ctx, key, "", func(w io.Writer) error {
+		_, err := w.Write(out)
+		return err
+	})
+}
+
+// imageToSave returns the key and content to store for a downloaded image. JPEG is kept as
+// is and PNG and WebP are converted to JPEG. Other payloads, and images that cannot be
+// converted, keep their original format under the matching extension.
+func imageToSave(relPath, contentType string, data []byte) (string, []byte) {
 	switch contentType {
 	case "image/jpeg", "image/jpg":
-		if err := renameReplace(tmpDownloadPath, outPath); err != nil {
-			return "", err
+		return relPath, data
+	case "image/png", "image/webp":
+		converted, err := convertImageToJPEG(data, contentType)
+		if err != nil {
+			// Fallback: keep the original image if conversion fails.
+			return replaceExt(relPath, extFromContentType(contentType)), data
 		}
-		return outPath, nil
-	case "image/png":
-		jpegTmp := outPath + ".tmp.jpg"
-		if err := convertImageFileToJPEG(tmpDownloadPath, jpegTmp, contentType); err != nil {
-			// Fallback: keep the original PNG if conversion fails.
-			_ = os.Remove(jpegTmp)
-			fallback := replaceExt(outPath, ".png")
-			if rerr := renameReplace(tmpDownloadPath, fallback); rerr != nil {
-				_ = os.Remove(tmpDownloadPath)
-				return "", fmt.Errorf("failed to convert png to jpeg: %v (and failed to preserve original: %v)", err, rerr)
-			}
-			return fallback, nil
-		}
-		_ = os.Remove(tmpDownloadPath)
-		if err := renameReplace(jpegTmp, outPath); err != nil {
-			_ = os.Remove(jpegTmp)
-			return "", err
-		}
-		return outPath, nil
-	case "image/webp":
-		jpegTmp := outPath + ".tmp.jpg"
-		if err := convertImageFileToJPEG(tmpDownloadPath, jpegTmp, contentType); err != nil {
-			// Fallback: keep the original WebP if conversion fails.
-			_ = os.Remove(jpegTmp)
-			fallback := replaceExt(outPath, ".webp")
-			if rerr := renameReplace(tmpDownloadPath, fallback); rerr != nil {
-				_ = os.Remove(tmpDownloadPath)
-				return "", fmt.Errorf("failed to convert webp to jpeg: %v (and failed to preserve original: %v)", err, rerr)
-			}
-			return fallback, nil
-		}
-		_ = os.Remove(tmpDownloadPath)
-		if err := renameReplace(jpegTmp, outPath); err != nil {
-			_ = os.Remove(jpegTmp)
-			return "", err
-		}
-		return outPath, nil
+		return relPath, converted
 	default:
 		// Preserve unknown payloads.
-		fallback := replaceExt(outPath, extFromContentType(contentType))
-		if rerr := renameReplace(tmpDownloadPath, fallback); rerr != nil {
-			_ = os.Remove(tmpDownloadPath)
-			return "", fmt.Errorf("unsupported image content-type %q", contentType)
+		return replaceExt(relPath, extFromContentType(contentType)), data
+	}
+}
+
+// save writes a file to storage through write, hashing it and, when VerifyMedia is set and
+// verifyExt is not empty, validating it as verifyExt on the way. The file is only committed
+// when write succeeds and the content is valid. It returns the location of the saved file.
+func (d *Downloader) save(ctx context.Context, relPath, verifyExt string, write func(io.Writer) error) (string, error) {
+	key := filepath.ToSlash(relPath)
+	w, err := d.store.Create(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	sum := d.newFileHash()
+	writers := []io.Writer{w, sum}
+	var check *integrity.Verifier
+	if d.verify && verifyExt != "" {
+		check = integrity.NewVerifier(verifyExt)
+		writers = append(writers, check)
+	}
+	if err := write(io.MultiWriter(writers...)); err != nil {
+		_ = w.Abort()
+		return "", err
+	}
+	if check != nil {
+		if err := check.Close(); err != nil {
+			_ = w.Abort()
+			return "", fmt.Errorf("corrupt download: %v", err)
 		}
-		return fallback, nil
 	}
+	if err := w.Commit(); err != nil {
+		return "", err
+	}
+
+	saved := d.store.Location(key)
+	if err := d.recordChecksum(key, sum); err != nil {
+		return saved, err
+	}
+	return saved, nil
+}
+
+// checkComplete rejects a response body that is shorter or longer than its Content-Length.
+func checkComplete(resp *http.Response, written int64) error {
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		return fmt.Errorf("incomplete download: got %d of %d bytes", written, resp.ContentLength)
+	}
+	return nil
 }
 
 func normalizeContentType(ct string) string {
@@ -262,47 +273,27 @@ func replaceExt(path, newExt string) string {
 	return base + newExt
 }
 
-func renameReplace(src, dst string) error {
-	if err := os.Rename(src, dst); err == nil {
-		return nil
-	}
-	// On Windows, Rename fails if dst exists.
-	_ = os.Remove(dst)
-	return os.Rename(src, dst)
-}
-
-func convertImageFileToJPEG(inPath, outPath, contentType string) error {
-	in, err := os.Open(inPath)
-	if err != nil {
-		return err
-	}
-	defer in.Close()
-
+// convertImageToJPEG re-encodes a PNG or WebP image as JPEG.
+func convertImageToJPEG(data []byte, contentType string) ([]byte, error) {
 	var img image.Image
+	var err error
 	switch contentType {
 	case "image/webp":
-		img, err = xwebp.Decode(in)
+		img, err = xwebp.Decode(bytes.NewReader(data))
 	case "image/png":
-		img, err = png.Decode(in)
+		img, err = png.Decode(bytes.NewReader(data))
 	default:
-		return fmt.Errorf("unsupported conversion from %q", contentType)
+		return nil, fmt.Errorf("unsupported conversion from %q", contentType)
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	opaque := flattenToOpaque(img)
-
-	out, err := os.Create(outPath)
-	if err != nil {
-		return err
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, flattenToOpaque(img), &jpeg.Options{Quality: 95}); err != nil {
+		return nil, err
 	}
-	defer out.Close()
-
-	if err := jpeg.Encode(out, opaque, &jpeg.Options{Quality: 95}); err != nil {
-		return err
-	}
-	return out.Close()
+	return out.Bytes(), nil
 }
 
 func flattenToOpaque(img image.Image) *image.RGBA {
@@ -312,8 +303,3 @@ func flattenToOpaque(img image.Image) *image.RGBA {
 	draw.Draw(dst, b, img, b.Min, draw.Over)
 	return dst
 }
-
-func errorsIsEOF(err error) bool {
-	// io.ReadFull returns io.EOF or io.ErrUnexpectedEOF when the stream is smaller than the buffer.
-	return err == io.EOF || err == io.ErrUnexpectedEOF
-}
@@ -1,14 +1,22 @@
 package downloader
 
 import (
+	"bytes"
 	"context"
+	"image"
+	"image/png"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/baptistax/idl/internal/storage"
 )
 
 func TestDownloadToFileOverwritesDestinationAndLeavesNoTmp(t *testing.T) {
@@ -55,3 +63,139 @@ func TestDownloadToFileOverwritesDestinationAndLeavesNoTmp(t *testing.T) {
 		t.Fatalf("temporary file should not remain, got err=%v", err)
 	}
 }
+
+func TestDownloadToFileRejectsTruncatedAndCorruptMedia(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/short" {
+			w.Header().Set("Content-Length", "100")
+		}
+		_, _ = io.WriteString(w, "not an mp4")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	dl := New(Options{OutputDir: dir, Timeout: 5 * time.Second, VerifyMedia: true})
+
+	for _, path := range []string{"/short", "/corrupt"} {
+		rel := filepath.Join("user", "posts", strings.TrimPrefix(path, "/")+".mp4")
+		if _, err := dl.DownloadToFile(context.Background(), srv.URL+path, rel); err == nil {
+			t.Fatalf("expected error for %s", path)
+		}
+		if _, err := os.Stat(filepath.Join(dir, rel)); !os.IsNotExist(err) {
+			t.Fatalf("%s should not be kept, got err=%v", rel, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, rel) + ".tmp"); !os.IsNotExist(err) {
+			t.Fatalf("temporary file should not remain, got err=%v", err)
+		}
+	}
+}
+
+// memStorage is an in-memory storage.Storage.
+type memStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+type memWriter struct {
+	s   *memStorage
+	key string
+	buf bytes.Buffer
+}
+
+func (w *memWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+func (w *memWriter) Abort() error                { return nil }
+func (w *memWriter) Commit() error {
+	w.s.mu.Lock()
+	defer w.s.mu.Unlock()
+	w.s.files[w.key] = w.buf.Bytes()
+	return nil
+}
+
+func (s *memStorage) Create(ctx context.Context, key string) (storage.Writer, error) {
+	return &memWriter{s: s, key: key}, nil
+}
+
+func (s *memStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[key]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memStorage) Stat(ctx context.Context, key string) (storage.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[key]
+	if !ok {
+		return storage.FileInfo{}, fs.ErrNotExist
+	}
+	return storage.FileInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+func (s *memStorage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.Stat(ctx, key)
+	return err == nil, nil
+}
+
+func (s *memStorage) List(ctx context.Context, prefix string) ([]storage.FileInfo, error) {
+	return nil, nil
+}
+
+func (s *memStorage) Remove(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, key)
+	return nil
+}
+
+func (s *memStorage) Location(key string) string { return "mem://" + key }
+
+func TestDownloaderWritesThroughStorage(t *testing.T) {
+	t.Parallel()
+
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/image" {
+			_, _ = w.Write(pngData.Bytes())
+			return
+		}
+		_, _ = io.WriteString(w, "video")
+	}))
+	defer srv.Close()
+
+	mem := &memStorage{files: map[string][]byte{}}
+	dl := New(Options{Storage: mem, Timeout: 5 * time.Second, Checksums: true})
+
+	got, err := dl.DownloadImageAsJPEG(context.Background(), srv.URL+"/image", filepath.Join("user", "posts", "a.jpg"))
+	if err != nil {
+		t.Fatalf("DownloadImageAsJPEG: %v", err)
+	}
+	if got != "mem://user/posts/a.jpg" {
+		t.Fatalf("unexpected location %q", got)
+	}
+	if data := mem.files["user/posts/a.jpg"]; len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		t.Fatalf("expected a converted JPEG, got % x", data[:min(len(data), 4)])
+	}
+
+	if _, err := dl.DownloadToFile(context.Background(), srv.URL+"/video", filepath.Join("user", "reels", "b.mp4")); err != nil {
+		t.Fatalf("DownloadToFile: %v", err)
+	}
+	if err := dl.FlushChecksums(); err != nil {
+		t.Fatalf("FlushChecksums: %v", err)
+	}
+	sums, err := ParseChecksums(bytes.NewReader(mem.files["user/"+SHA256SumsFile]), SHA256SumsFile)
+	if err != nil {
+		t.Fatalf("ParseChecksums: %v", err)
+	}
+	if len(sums) != 2 || sums["posts/a.jpg"] == "" || sums["reels/b.mp4"] == "" {
+		t.Fatalf("unexpected manifest: %v", sums)
+	}
+}
@@ -0,0 +1,70 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+)
+
+// Segment is one part of a segmented stream. Range, when set, is an HTTP byte range
+// such as "0-1023" within URL.
+type Segment struct {
+	URL   string
+	Range string
+}
+
+// DownloadSegmentsToFile downloads segments in order and concatenates them into relPath.
+// The file only appears once every segment has been written.
+func (d *Downloader) DownloadSegmentsToFile(ctx context.Context, segments []Segment, relPath string) (string, error) {
+	if len(segments) == 0 {
+		return "", fmt.Errorf("no segments to download")
+	}
+	return d.save(ctx, relPath, filepath.Ext(relPath), func(w io.Writer) error {
+		for i, seg := range segments {
+			if err := d.appendSegment(ctx, w, seg); err != nil {
+				return fmt.Errorf("segment %d/%d: %v", i+1, len(segments), err)
+			}
+		}
+		return nil
+	})
+}
+
+func (d *Downloader) appendSegment(ctx context.Context, w io.Writer, seg Segment) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, seg.URL, nil)
+	if err != nil {
+		return err
+	}
+	if d.userAgent != "" {
+		req.Header.Set("User-Agent", d.userAgent)
+	}
+	if d.referer != "" {
+		req.Header.Set("Referer", d.referer)
+	}
+	req.Header.Set("Accept", "*/*")
+	if seg.Range != "" {
+		req.Header.Set("Range", "bytes="+seg.Range)
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	// A server that ignores Range answers 200 with the whole resource, which would corrupt
+	// the assembled file.
+	if seg.Range != "" && resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("server ignored byte range %s", seg.Range)
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return err
+	}
+	return checkComplete(resp, n)
+}
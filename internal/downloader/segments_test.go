@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadSegmentsToFileConcatenatesInOrder(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/whole" {
+			http.ServeContent(w, r, "whole", time.Time{}, strings.NewReader("INITmedia"))
+			return
+		}
+		_, _ = io.WriteString(w, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	dl := New(Options{OutputDir: dir, Timeout: 5 * time.Second})
+
+	got, err := dl.DownloadSegmentsToFile(context.Background(), []Segment{
+		{URL: srv.URL + "/whole", Range: "0-3"},
+		{URL: srv.URL + "/seg1"},
+		{URL: srv.URL + "/seg2"},
+	}, filepath.Join("user", "clip.mp4"))
+	if err != nil {
+		t.Fatalf("DownloadSegmentsToFile: %v", err)
+	}
+
+	data, err := os.ReadFile(got)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(data, []byte("INITseg1seg2")) {
+		t.Fatalf("unexpected contents: %q", data)
+	}
+}
+
+func TestDownloadSegmentsToFileFailsWithoutPartialFile(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		// Ignores the Range header.
+		_, _ = io.WriteString(w, "data")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	dl := New(Options{OutputDir: dir, Timeout: 5 * time.Second})
+	rel := filepath.Join("user", "clip.mp4")
+
+	for _, segs := range [][]Segment{
+		{{URL: srv.URL + "/ok"}, {URL: srv.URL + "/missing"}},
+		{{URL: srv.URL + "/ok", Range: "0-1"}},
+	} {
+		if _, err := dl.DownloadSegmentsToFile(context.Background(), segs, rel); err == nil {
+			t.Fatalf("expected error for %+v", segs)
+		}
+		if _, err := os.Stat(filepath.Join(dir, rel)); !os.IsNotExist(err) {
+			t.Fatalf("no file should be written, got err=%v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, rel) + ".tmp"); !os.IsNotExist(err) {
+			t.Fatalf("temporary file should not remain, got err=%v", err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// Package expr implements the small boolean filter language used by --filter.
+//
+// An expression compares fields against literals and combines the comparisons with
+// &&, || and !, for example:
+//
+//	caption~"#launch" && taken_at > 2024-01-01 && type == video
+//
+// Supported operators are == and != (all kinds; exact, case-sensitive match for strings),
+// ~ and !~ (case-insensitive substring, strings only) and <, <=, >, >= (numbers and
+// times). String literals may be quoted or bare words; times are YYYY-MM-DD (UTC) or
+// RFC 3339.
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the type of a field.
+type Kind int
+
+const (
+	String Kind = iota
+	Number
+	Time
+	Bool
+)
+
+// Schema maps the field names an expression may use to their kinds.
+type Schema map[string]Kind
+
+// Fields returns the value of a field when evaluating an expression. The returned value
+// must be a string, int64, time.Time or bool according to the field's Kind.
+type Fields func(name string) any
+
+// Expr is a parsed filter expression.
+type Expr struct {
+	root node
+	src  string
+}
+
+// Parse compiles src against schema. Unknown fields, operators that do not apply to a
+// field's kind and malformed literals are reported as errors.
+func Parse(src string, schema Schema) (*Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, schema: schema}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at offset %d", p.peek(), p.peek().pos)
+	}
+	return &Expr{root: root, src: src}, nil
+}
+
+// Match evaluates the expression.
+func (e *Expr) Match(fields Fields) bool {
+	if e == nil || e.root == nil {
+		return true
+	}
+	return e.root.eval(fields)
+}
+
+func (e *Expr) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.src
+}
+
+type node interface {
+	eval(Fields) bool
+}
+
+type andNode struct{ l, r node }
+
+func (n andNode) eval(f Fields) bool { return n.l.eval(f) && n.r.eval(f) }
+
+type orNode struct{ l, r node }
+
+func (n orNode) eval(f Fields) bool { return n.l.eval(f) || n.r.eval(f) }
+
+type notNode struct{ n node }
+
+func (n notNode) eval(f Fields) bool { return !n.n.eval(f) }
+
+type cmpNode struct {
+	field string
+	kind  Kind
+	op    string
+	str   string
+	num   int64
+	tm    time.Time
+	b     bool
+}
+
+func (n cmpNode) eval(f Fields) bool {
+	v := f(n.field)
+	switch n.kind {
+	case String:
+		s, _ := v.(string)
+		switch n.op {
+		case "==":
+			return s == n.str
+		case "!=":
+			return s != n.str
+		case "~":
+			return strings.Contains(strings.ToLower(s), n.str)
+		case "!~":
+			return !strings.Contains(strings.ToLower(s), n.str)
+		}
+	case Number:
+		x, _ := v.(int64)
+		return compareOrdered(x, n.num, n.op)
+	case Time:
+		t, _ := v.(time.Time)
+		return compareOrdered(t.Unix(), n.tm.Unix(), n.op)
+	case Bool:
+		b, _ := v.(bool)
+		if n.op == "==" {
+			return b == n.b
+		}
+		return b != n.b
+	}
+	return false
+}
+
+func compareOrdered(a, b int64, op string) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+type parser struct {
+	toks   []token
+	i      int
+	schema Schema
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = orNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = andNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch t := p.peek(); t.kind {
+	case tokNot:
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	case tokLParen:
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("expected ) at offset %d", p.peek().pos)
+		}
+		p.next()
+		return n, nil
+	case tokWord:
+		return p.parseComparison()
+	default:
+		return nil, fmt.Errorf("unexpected %s at offset %d", t, t.pos)
+	}
+}
+
+func (p *parser) parseComparison() (node, error) {
+	ft := p.next()
+	name := strings.ToLower(ft.text)
+	kind, ok := p.schema[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", ft.text)
+	}
+
+	opTok := p.next()
+	if opTok.kind != tokOp {
+		return nil, fmt.Errorf("expected operator after %q at offset %d", ft.text, opTok.pos)
+	}
+	op := opTok.text
+	if !opAllowed(kind, op) {
+		return nil, fmt.Errorf("operator %s is not supported for field %q", op, ft.text)
+	}
+
+	lit := p.next()
+	if lit.kind != tokWord && lit.kind != tokString {
+		return nil, fmt.Errorf("expected value after %s at offset %d", op, lit.pos)
+	}
+
+	n := cmpNode{field: name, kind: kind, op: op}
+	switch kind {
+	case String:
+		n.str = lit.text
+		if op == "~" || op == "!~" {
+			n.str = strings.ToLower(lit.text)
+		}
+	case Number:
+		v, err := parseNumber(lit.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q for field %q", lit.text, ft.text)
+		}
+		n.num = v
+	case Time:
+		t, err := parseTime(lit.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q for field %q", lit.text, ft.text)
+		}
+		n.tm = t
+	case Bool:
+		b, err := strconv.ParseBool(lit.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean %q for field %q", lit.text, ft.text)
+		}
+		n.b = b
+	}
+	return n, nil
+}
+
+func opAllowed(kind Kind, op string) bool {
+	switch op {
+	case "==", "!=":
+		return true
+	case "~", "!~":
+		return kind == String
+	default:
+		return kind == Number || kind == Time
+	}
+}
+
+// parseNumber accepts plain integers and k/m suffixes (10k, 1.5m).
+func parseNumber(s string) (int64, error) {
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(strings.ToLower(s), "k"):
+		mult, s = 1e3, s[:len(s)-1]
+	case strings.HasSuffix(strings.ToLower(s), "m"):
+		mult, s = 1e6, s[:len(s)-1]
+	}
+	if mult == 1 {
+		return strconv.ParseInt(s, 10, 64)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(f * mult), nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
@@ -0,0 +1,114 @@
+package expr
+
+import (
+	"testing"
+	"time"
+)
+
+var testSchema = Schema{
+	"caption":  String,
+	"taken_at": Time,
+	"type":     String,
+	"likes":    Number,
+	"pinned":   Bool,
+}
+
+func testFields(caption, typ string, taken time.Time, likes int64) Fields {
+	return func(name string) any {
+		switch name {
+		case "caption":
+			return caption
+		case "taken_at":
+			return taken
+		case "type":
+			return typ
+		case "likes":
+			return likes
+		case "pinned":
+			return false
+		}
+		return nil
+	}
+}
+
+func TestMatchCombinesComparisons(t *testing.T) {
+	t.Parallel()
+
+	e, err := Parse(`caption~"#Launch" && taken_at > 2024-01-01 && type == video`, testSchema)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	jan := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	if !e.Match(testFields("Big day #launch!", "video", jan, 0)) {
+		t.Fatal("expected match")
+	}
+	if e.Match(testFields("Big day #launch!", "photo", jan, 0)) {
+		t.Fatal("expected type mismatch")
+	}
+	if e.Match(testFields("Big day #launch!", "video", jan.AddDate(-1, 0, 0), 0)) {
+		t.Fatal("expected date mismatch")
+	}
+}
+
+func TestMatchStringEqualityIsExact(t *testing.T) {
+	t.Parallel()
+
+	jan := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		src  string
+		want bool
+	}{
+		{`caption == "Launch"`, true},
+		{`caption == "launch"`, false},
+		{`caption != "launch"`, true},
+		{`caption ~ "launch"`, true},
+	}
+	for _, tc := range cases {
+		e, err := Parse(tc.src, testSchema)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.src, err)
+		}
+		if got := e.Match(testFields("Launch", "video", jan, 0)); got != tc.want {
+			t.Fatalf("%s = %v, want %v", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestMatchPrecedenceAndNegation(t *testing.T) {
+	t.Parallel()
+
+	e, err := Parse(`!(likes < 10k) || type == photo && pinned == false`, testSchema)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	now := time.Now()
+	if !e.Match(testFields("", "video", now, 20000)) {
+		t.Fatal("expected likes branch to match")
+	}
+	if !e.Match(testFields("", "photo", now, 5)) {
+		t.Fatal("expected photo branch to match")
+	}
+	if e.Match(testFields("", "video", now, 5)) {
+		t.Fatal("expected no match")
+	}
+}
+
+func TestParseRejectsInvalidExpressions(t *testing.T) {
+	t.Parallel()
+
+	for _, src := range []string{
+		`views > 1`,
+		`caption > "x"`,
+		`taken_at > yesterday`,
+		`likes == `,
+		`type = video`,
+		`(type == video`,
+		`caption~"unterminated`,
+		`type == video type == photo`,
+	} {
+		if _, err := Parse(src, testSchema); err == nil {
+			t.Fatalf("expected error for %q", src)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case r == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case r == '&' || r == '|':
+			if i+1 >= len(rs) || rs[i+1] != r {
+				return nil, fmt.Errorf("expected %c%c at offset %d", r, r, i)
+			}
+			kind := tokAnd
+			if r == '|' {
+				kind = tokOr
+			}
+			toks = append(toks, token{kind, string([]rune{r, r}), i})
+			i += 2
+		case r == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+				}
+				sb.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			toks = append(toks, token{tokString, sb.String(), i})
+			i = j + 1
+		case r == '=' || r == '!' || r == '<' || r == '>' || r == '~':
+			op := string(r)
+			if i+1 < len(rs) && (rs[i+1] == '=' || (r == '!' && rs[i+1] == '~')) {
+				op += string(rs[i+1])
+			}
+			switch op {
+			case "!":
+				toks = append(toks, token{tokNot, op, i})
+			case "==", "!=", "~", "!~", "<", "<=", ">", ">=":
+				toks = append(toks, token{tokOp, op, i})
+			default:
+				return nil, fmt.Errorf("unknown operator %q at offset %d", op, i)
+			}
+			i += len(op)
+		default:
+			j := i
+			for j < len(rs) && isWordRune(rs[j]) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", r, i)
+			}
+			toks = append(toks, token{tokWord, string(rs[i:j]), i})
+			i = j
+		}
+	}
+	toks = append(toks, token{kind: tokEOF, pos: len(rs)})
+	return toks, nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:-+#@", r)
+}
@@ -0,0 +1,104 @@
+package instagram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Comment is a top-level comment or a threaded reply on a post.
+type Comment struct {
+	PK                string `json:"pk"`
+	Text              string `json:"text"`
+	CreatedAt         int64  `json:"created_at"`
+	LikeCount         int64  `json:"comment_like_count"`
+	ChildCommentCount int    `json:"child_comment_count"`
+	User              IGUser `json:"user"`
+}
+
+type commentsResponse struct {
+	Data struct {
+		Connection struct {
+			Edges []struct {
+				Node Comment `json:"node"`
+			} `json:"edges"`
+			PageInfo PageInfo `json:"page_info"`
+		} `json:"xdt_api__v1__media__media_id__comments__connection"`
+	} `json:"data"`
+	Status string `json:"status"`
+}
+
+type childCommentsResponse struct {
+	Data struct {
+		Connection struct {
+			Edges []struct {
+				Node Comment `json:"node"`
+			} `json:"edges"`
+			PageInfo PageInfo `json:"page_info"`
+		} `json:"xdt_api__v1__media__media_id__comments__parent_comment_id__child_comments__connection"`
+	} `json:"data"`
+	Status string `json:"status"`
+}
+
+// FetchCommentsPage returns one page of top-level comments on a post. code is the post
+// shortcode and is only used to build the referer.
+func (c *Client) FetchCommentsPage(ctx context.Context, mediaID, code, after string) ([]Comment, PageInfo, error) {
+	if mediaID == "" {
+		return nil, PageInfo{}, errors.New("media id is empty")
+	}
+
+	vars := map[string]any{
+		"media_id":   mediaID,
+		"sort_order": "popular",
+		"first":      50,
+		"__relay_internal__pv__PolarisIsLoggedInrelayprovider": true,
+	}
+	if after != "" {
+		vars["after"] = after
+	}
+
+	var out commentsResponse
+	if err := c.GraphQL(ctx, postReferer(code), "PolarisPostCommentsPaginationQuery", docComments, vars, &out); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	comments := make([]Comment, 0, len(out.Data.Connection.Edges))
+	for _, e := range out.Data.Connection.Edges {
+		comments = append(comments, e.Node)
+	}
+	return comments, out.Data.Connection.PageInfo, nil
+}
+
+// FetchCommentRepliesPage returns one page of replies to a top-level comment.
+func (c *Client) FetchCommentRepliesPage(ctx context.Context, mediaID, code, parentID, after string) ([]Comment, PageInfo, error) {
+	if mediaID == "" || parentID == "" {
+		return nil, PageInfo{}, errors.New("media id or comment id is empty")
+	}
+
+	vars := map[string]any{
+		"media_id":          mediaID,
+		"parent_comment_id": parentID,
+		"__relay_internal__pv__PolarisIsLoggedInrelayprovider": true,
+	}
+	if after != "" {
+		vars["after"] = after
+	}
+
+	var out childCommentsResponse
+	if err := c.GraphQL(ctx, postReferer(code), "PolarisPostChildCommentsPaginationQuery", docChildComments, vars, &out); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	comments := make([]Comment, 0, len(out.Data.Connection.Edges))
+	for _, e := range out.Data.Connection.Edges {
+		comments = append(comments, e.Node)
+	}
+	return comments, out.Data.Connection.PageInfo, nil
+}
+
+func postReferer(code string) string {
+	if code == "" {
+		return baseWWW + "/"
+	}
+	return fmt.Sprintf("%s/p/%s/", baseWWW, code)
+}
@@ -0,0 +1,23 @@
+package instagram
+
+import "testing"
+
+func TestCommentsResponseDecodesAuthorAndCounts(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"data":{"xdt_api__v1__media__media_id__comments__connection":{"edges":[{"node":{
+		"pk":"c1","text":"great shot","created_at":1700000000,"comment_like_count":3,"child_comment_count":2,
+		"user":{"pk":"9","username":"fan"}}}],"page_info":{"end_cursor":"","has_next_page":false}}},"status":"ok"}`)
+
+	var out commentsResponse
+	if err := decodeGraphQLResponse(body, &out); err != nil {
+		t.Fatalf("decodeGraphQLResponse: %v", err)
+	}
+	if len(out.Data.Connection.Edges) != 1 {
+		t.Fatalf("expected 1 comment, got %d", len(out.Data.Connection.Edges))
+	}
+	c := out.Data.Connection.Edges[0].Node
+	if c.PK != "c1" || c.User.Username != "fan" || c.LikeCount != 3 || c.ChildCommentCount != 2 || c.CreatedAt != 1700000000 {
+		t.Fatalf("unexpected comment: %+v", c)
+	}
+}
@@ -5,8 +5,13 @@ const (
 	asbdID                = "359341"
 	baseWWW               = "https://www.instagram.com"
 	gqlURL                = "https://www.instagram.com/graphql/query"
+	webProfileInfoURL     = "https://www.instagram.com/api/v1/users/web_profile_info/"
 	docPostsFirstPage     = "25345334665119661"
 	docPostsPagination    = "25225277230478352"
+	docTaggedPosts        = "7289408964443685"
+	docReelsTab           = "8526372674115715"
+	docComments           = "8845758582119845"
+	docChildComments      = "9169052063159735"
 	docHighlightsTray     = "9814547265267853"
 	docHighlightsPageConn = "24214267448250103"
 )
@@ -0,0 +1,484 @@
+package instagram
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DASHManifest is a parsed MPEG-DASH manifest (video_dash_manifest).
+type DASHManifest struct {
+	Duration time.Duration
+	Periods  []DASHPeriod
+}
+
+type DASHPeriod struct {
+	ID             string
+	Duration       time.Duration
+	AdaptationSets []DASHAdaptationSet
+}
+
+type DASHAdaptationSet struct {
+	ID              string
+	ContentType     string
+	MimeType        string
+	Codecs          string
+	Lang            string
+	Representations []DASHRepresentation
+}
+
+// DASHRepresentation is one encoding of a stream. Attributes inherited from the adaptation
+// set (mime type, codecs, dimensions, frame rate) are already resolved.
+type DASHRepresentation struct {
+	ID                string
+	ContentType       string
+	MimeType          string
+	Codecs            string
+	Width             int
+	Height            int
+	Bandwidth         int
+	FrameRate         float64
+	AudioSamplingRate int
+
+	// URL is the resolved BaseURL. Without SegmentList/SegmentTemplate addressing it is the
+	// complete file, which is downloaded in one request (SegmentBase byte ranges are not
+	// needed for that and are ignored).
+	URL string
+
+	// Init and Segments are set for SegmentList and SegmentTemplate addressing. The complete
+	// stream is Init followed by Segments, in order.
+	Init     *DASHSegment
+	Segments []DASHSegment
+}
+
+// DASHSegment is a part of a segmented stream. Range, when set, is an HTTP byte range
+// (e.g. "0-1023") within URL.
+type DASHSegment struct {
+	URL   string
+	Range string
+}
+
+// IsVideo reports whether the representation carries video.
+func (r DASHRepresentation) IsVideo() bool {
+	return r.ContentType == "video" || (r.ContentType == "" && strings.HasPrefix(r.MimeType, "video/"))
+}
+
+// IsAudio reports whether the representation carries audio.
+func (r DASHRepresentation) IsAudio() bool {
+	return r.ContentType == "audio" || (r.ContentType == "" && strings.HasPrefix(r.MimeType, "audio/"))
+}
+
+// Segmented reports whether the stream has to be assembled from several requests.
+func (r DASHRepresentation) Segmented() bool {
+	return r.Init != nil || len(r.Segments) > 0
+}
+
+// maxDASHSegments caps the segments of one representation, so that a manifest with a huge
+// repeat count or a tiny segment duration cannot exhaust memory.
+const maxDASHSegments = 10000
+
+// ParseDASH parses a DASH manifest. Relative URLs are resolved against the BaseURL of the
+// enclosing MPD, Period and AdaptationSet elements. Representations whose segments cannot
+// be listed are left out.
+func ParseDASH(manifest string) (*DASHManifest, error) {
+	var doc mpdXML
+	if err := xml.NewDecoder(bytes.NewBufferString(manifest)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid DASH manifest: %v", err)
+	}
+
+	out := &DASHManifest{}
+	if doc.MediaPresentationDuration != "" {
+		d, err := parseISODuration(doc.MediaPresentationDuration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mediaPresentationDuration: %v", err)
+		}
+		out.Duration = d
+	}
+
+	mpdBase := strings.TrimSpace(doc.BaseURL)
+	for i, p := range doc.Periods {
+		period := DASHPeriod{ID: p.ID}
+		if p.Duration != "" {
+			d, err := parseISODuration(p.Duration)
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration of period %d: %v", i+1, err)
+			}
+			period.Duration = d
+		}
+		if period.Duration == 0 && len(doc.Periods) == 1 {
+			period.Duration = out.Duration
+		}
+
+		periodBase := resolveURL(mpdBase, p.BaseURL)
+		for _, a := range p.AdaptationSets {
+			set := DASHAdaptationSet{
+				ID:          a.ID,
+				ContentType: strings.ToLower(strings.TrimSpace(a.ContentType)),
+				MimeType:    strings.ToLower(strings.TrimSpace(a.MimeType)),
+				Codecs:      a.Codecs,
+				Lang:        a.Lang,
+			}
+			setBase := resolveURL(periodBase, a.BaseURL)
+			for _, r := range a.Representations {
+				rep, err := newDASHRepresentation(period, p, a, r, set, setBase)
+				if err != nil {
+					continue
+				}
+				set.Representations = append(set.Representations, rep)
+			}
+			period.AdaptationSets = append(period.AdaptationSets, set)
+		}
+		out.Periods = append(out.Periods, period)
+	}
+	return out, nil
+}
+
+func newDASHRepresentation(period DASHPeriod, p periodXML, a adaptationSetXML, r representationXML, set DASHAdaptationSet, setBase string) (DASHRepresentation, error) {
+	rep := DASHRepresentation{
+		ID:          r.ID,
+		ContentType: set.ContentType,
+		MimeType:    firstNonEmpty(strings.ToLower(strings.TrimSpace(r.MimeType)), set.MimeType),
+		Codecs:      firstNonEmpty(r.Codecs, set.Codecs),
+		Width:       firstPositive(r.Width, a.Width),
+		Height:      firstPositive(r.Height, a.Height),
+		Bandwidth:   r.Bandwidth,
+		FrameRate:   parseFrameRate(firstNonEmpty(r.FrameRate, a.FrameRate)),
+	}
+	rep.AudioSamplingRate, _ = strconv.Atoi(firstNonEmpty(r.AudioSamplingRate, a.AudioSamplingRate))
+	base := resolveURL(setBase, r.BaseURL)
+	rep.URL = base
+
+	if sl := firstSegmentList(r.SegmentList, a.SegmentList, p.SegmentList); sl != nil {
+		if sl.Initialization != nil {
+			rep.Init = &DASHSegment{URL: resolveURL(base, sl.Initialization.SourceURL), Range: sl.Initialization.Range}
+		}
+		for _, su := range sl.SegmentURLs {
+			rep.Segments = append(rep.Segments, DASHSegment{URL: resolveURL(base, su.Media), Range: su.MediaRange})
+		}
+		return rep, nil
+	}
+
+	if st := mergeSegmentTemplates(p.SegmentTemplate, a.SegmentTemplate, r.SegmentTemplate); st != nil {
+		init, segs, err := expandSegmentTemplate(st, rep, period.Duration)
+		if err != nil {
+			return DASHRepresentation{}, fmt.Errorf("representation %q: %v", r.ID, err)
+		}
+		if init != "" {
+			rep.Init = &DASHSegment{URL: resolveURL(base, init)}
+		}
+		for _, s := range segs {
+			rep.Segments = append(rep.Segments, DASHSegment{URL: resolveURL(base, s)})
+		}
+	}
+	return rep, nil
+}
+
+// expandSegmentTemplate lists the initialization and media segment URLs described by a
+// SegmentTemplate, using its SegmentTimeline when present and the period duration otherwise.
+func expandSegmentTemplate(st *segmentTemplateXML, rep DASHRepresentation, periodDuration time.Duration) (string, []string, error) {
+	if st.Media == "" {
+		return "", nil, errors.New("SegmentTemplate without media attribute")
+	}
+	timescale := st.Timescale
+	if timescale <= 0 {
+		timescale = 1
+	}
+	number := int64(1)
+	if st.StartNumber != "" {
+		n, err := strconv.ParseInt(st.StartNumber, 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid startNumber %q", st.StartNumber)
+		}
+		number = n
+	}
+
+	init := ""
+	if st.Initialization != "" {
+		init = fillSegmentTemplate(st.Initialization, rep, 0, 0)
+	}
+
+	var segs []string
+	if st.Timeline != nil {
+		end := int64(-1)
+		if periodDuration > 0 {
+			end = int64(periodDuration.Seconds() * float64(timescale))
+		}
+		t := int64(0)
+		for _, s := range st.Timeline.S {
+			if s.T != "" {
+				v, err := strconv.ParseInt(s.T, 10, 64)
+				if err != nil {
+					return "", nil, fmt.Errorf("invalid SegmentTimeline t %q", s.T)
+				}
+				t = v
+			}
+			if s.D <= 0 {
+				return "", nil, errors.New("SegmentTimeline entry without duration")
+			}
+			repeat := int64(s.R)
+			if repeat < 0 {
+				// r="-1" repeats until the end of the period.
+				repeat = 0
+				if end > t {
+					repeat = (end-t+s.D-1)/s.D - 1
+				}
+			}
+			if repeat >= int64(maxDASHSegments-len(segs)) {
+				return "", nil, fmt.Errorf("more than %d segments", maxDASHSegments)
+			}
+			for i := int64(0); i <= repeat; i++ {
+				segs = append(segs, fillSegmentTemplate(st.Media, rep, number, t))
+				number++
+				t += s.D
+			}
+		}
+		return init, segs, nil
+	}
+
+	if st.Duration <= 0 {
+		return "", nil, errors.New("SegmentTemplate without duration or SegmentTimeline")
+	}
+	if periodDuration <= 0 {
+		return "", nil, errors.New("SegmentTemplate needs a period or presentation duration")
+	}
+	n := math.Ceil(periodDuration.Seconds() * float64(timescale) / float64(st.Duration))
+	if n > maxDASHSegments {
+		return "", nil, fmt.Errorf("more than %d segments", maxDASHSegments)
+	}
+	count := int64(n)
+	for i := int64(0); i < count; i++ {
+		segs = append(segs, fillSegmentTemplate(st.Media, rep, number+i, i*st.Duration))
+	}
+	return init, segs, nil
+}
+
+var templateIdentifier = regexp.MustCompile(`\$(RepresentationID|Number|Bandwidth|Time)(%0(\d+)d)?\$|\$\$`)
+
+// fillSegmentTemplate substitutes $RepresentationID$, $Number$, $Bandwidth$ and $Time$
+// (with optional %0Nd width) and $$ in a template.
+func fillSegmentTemplate(tmpl string, rep DASHRepresentation, number, t int64) string {
+	return templateIdentifier.ReplaceAllStringFunc(tmpl, func(m string) string {
+		if m == "$$" {
+			return "$"
+		}
+		sub := templateIdentifier.FindStringSubmatch(m)
+		width, _ := strconv.Atoi(sub[3])
+		var v int64
+		switch sub[1] {
+		case "RepresentationID":
+			return rep.ID
+		case "Number":
+			v = number
+		case "Bandwidth":
+			v = int64(rep.Bandwidth)
+		case "Time":
+			v = t
+		}
+		return fmt.Sprintf("%0*d", width, v)
+	})
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)Y)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration parses an xs:duration such as PT1M2.5S. Years and months are counted
+// as 365 and 30 days.
+func parseISODuration(s string) (time.Duration, error) {
+	m := isoDuration.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	units := []float64{365 * 24 * 3600, 30 * 24 * 3600, 24 * 3600, 3600, 60, 1}
+	secs := 0.0
+	for i, u := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		secs += v * u
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// parseFrameRate parses "30" or "30000/1001".
+func parseFrameRate(s string) float64 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, err1 := strconv.ParseFloat(num, 64)
+		d, err2 := strconv.ParseFloat(den, 64)
+		if err1 != nil || err2 != nil || d == 0 {
+			return 0
+		}
+		return n / d
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func resolveURL(base, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if base == "" {
+		return ref
+	}
+	if ref == "" {
+		return base
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstPositive(vals ...int) int {
+	for _, v := range vals {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
+
+func firstSegmentList(vals ...*segmentListXML) *segmentListXML {
+	for _, v := range vals {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// mergeSegmentTemplates applies the SegmentTemplate inheritance rules: attributes set on
+// a lower level (representation) override those of the levels above it.
+func mergeSegmentTemplates(levels ...*segmentTemplateXML) *segmentTemplateXML {
+	var out *segmentTemplateXML
+	for _, st := range levels {
+		if st == nil {
+			continue
+		}
+		if out == nil {
+			out = &segmentTemplateXML{}
+		}
+		if st.Media != "" {
+			out.Media = st.Media
+		}
+		if st.Initialization != "" {
+			out.Initialization = st.Initialization
+		}
+		if st.StartNumber != "" {
+			out.StartNumber = st.StartNumber
+		}
+		if st.Timescale > 0 {
+			out.Timescale = st.Timescale
+		}
+		if st.Duration > 0 {
+			out.Duration = st.Duration
+		}
+		if st.Timeline != nil {
+			out.Timeline = st.Timeline
+		}
+	}
+	return out
+}
+
+type mpdXML struct {
+	MediaPresentationDuration string      `xml:"mediaPresentationDuration,attr"`
+	BaseURL                   string      `xml:"BaseURL"`
+	Periods                   []periodXML `xml:"Period"`
+}
+
+type periodXML struct {
+	ID              string              `xml:"id,attr"`
+	Duration        string              `xml:"duration,attr"`
+	BaseURL         string              `xml:"BaseURL"`
+	SegmentList     *segmentListXML     `xml:"SegmentList"`
+	SegmentTemplate *segmentTemplateXML `xml:"SegmentTemplate"`
+	AdaptationSets  []adaptationSetXML  `xml:"AdaptationSet"`
+}
+
+type adaptationSetXML struct {
+	ID                string              `xml:"id,attr"`
+	ContentType       string              `xml:"contentType,attr"`
+	MimeType          string              `xml:"mimeType,attr"`
+	Codecs            string              `xml:"codecs,attr"`
+	Lang              string              `xml:"lang,attr"`
+	Width             int                 `xml:"width,attr"`
+	Height            int                 `xml:"height,attr"`
+	FrameRate         string              `xml:"frameRate,attr"`
+	AudioSamplingRate string              `xml:"audioSamplingRate,attr"`
+	BaseURL           string              `xml:"BaseURL"`
+	SegmentList       *segmentListXML     `xml:"SegmentList"`
+	SegmentTemplate   *segmentTemplateXML `xml:"SegmentTemplate"`
+	Representations   []representationXML `xml:"Representation"`
+}
+
+type representationXML struct {
+	ID                string              `xml:"id,attr"`
+	MimeType          string              `xml:"mimeType,attr"`
+	Codecs            string              `xml:"codecs,attr"`
+	Width             int                 `xml:"width,attr"`
+	Height            int                 `xml:"height,attr"`
+	Bandwidth         int                 `xml:"bandwidth,attr"`
+	FrameRate         string              `xml:"frameRate,attr"`
+	AudioSamplingRate string              `xml:"audioSamplingRate,attr"`
+	BaseURL           string              `xml:"BaseURL"`
+	SegmentList       *segmentListXML     `xml:"SegmentList"`
+	SegmentTemplate   *segmentTemplateXML `xml:"SegmentTemplate"`
+}
+
+type urlTypeXML struct {
+	SourceURL string `xml:"sourceURL,attr"`
+	Range     string `xml:"range,attr"`
+}
+
+type segmentListXML struct {
+	Initialization *urlTypeXML     `xml:"Initialization"`
+	SegmentURLs    []segmentURLXML `xml:"SegmentURL"`
+}
+
+type segmentURLXML struct {
+	Media      string `xml:"media,attr"`
+	MediaRange string `xml:"mediaRange,attr"`
+}
+
+type segmentTemplateXML struct {
+	Media          string              `xml:"media,attr"`
+	Initialization string              `xml:"initialization,attr"`
+	StartNumber    string              `xml:"startNumber,attr"`
+	Timescale      int64               `xml:"timescale,attr"`
+	Duration       int64               `xml:"duration,attr"`
+	Timeline       *segmentTimelineXML `xml:"SegmentTimeline"`
+}
+
+type segmentTimelineXML struct {
+	S []struct {
+		T string `xml:"t,attr"`
+		D int64  `xml:"d,attr"`
+		R int    `xml:"r,attr"`
+	} `xml:"S"`
+}
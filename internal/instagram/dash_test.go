@@ -0,0 +1,170 @@
+package instagram
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDASHSegmentBase(t *testing.T) {
+	manifest := `<?xml version="1.0"?>
+<MPD mediaPresentationDuration="PT12.5S"><Period>
+<AdaptationSet contentType="video" mimeType="video/mp4" frameRate="30000/1001">
+<Representation id="v1" codecs="avc1.64001f" width="720" height="1280" bandwidth="1500000">
+<BaseURL>https://cdn/v1.mp4?a=1&amp;b=2</BaseURL>
+<SegmentBase indexRange="830-1001"><Initialization range="0-829"/></SegmentBase>
+</Representation>
+</AdaptationSet>
+<AdaptationSet contentType="audio" mimeType="audio/mp4">
+<Representation id="a1" codecs="mp4a.40.5" bandwidth="64000" audioSamplingRate="44100"><BaseURL>https://cdn/a1.mp4</BaseURL></Representation>
+</AdaptationSet>
+</Period></MPD>`
+
+	doc, err := ParseDASH(manifest)
+	if err != nil {
+		t.Fatalf("ParseDASH: %v", err)
+	}
+	if doc.Duration != 12500*time.Millisecond || len(doc.Periods) != 1 || len(doc.Periods[0].AdaptationSets) != 2 {
+		t.Fatalf("unexpected manifest: %+v", doc)
+	}
+
+	v := doc.Periods[0].AdaptationSets[0].Representations[0]
+	if !v.IsVideo() || v.Segmented() || v.URL != "https://cdn/v1.mp4?a=1&b=2" {
+		t.Fatalf("unexpected video representation: %+v", v)
+	}
+	if v.Codecs != "avc1.64001f" || v.FrameRate < 29.9 || v.FrameRate > 30 {
+		t.Fatalf("unexpected video attributes: %+v", v)
+	}
+
+	a := doc.Periods[0].AdaptationSets[1].Representations[0]
+	if !a.IsAudio() || a.AudioSamplingRate != 44100 {
+		t.Fatalf("unexpected audio representation: %+v", a)
+	}
+}
+
+func TestParseDASHSegmentTemplateAndList(t *testing.T) {
+	manifest := `<MPD mediaPresentationDuration="PT10S"><BaseURL>https://cdn/base/</BaseURL><Period>
+<AdaptationSet mimeType="video/mp4">
+<SegmentTemplate timescale="1000" duration="4000" initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/seg-$Number%03d$.m4s"/>
+<Representation id="hd" width="1080" height="1920" bandwidth="3000000"/>
+<Representation id="tl" width="720" height="1280" bandwidth="1000000">
+<SegmentTemplate media="tl/$Time$.m4s"><SegmentTimeline><S t="0" d="5" r="1"/><S d="3"/></SegmentTimeline></SegmentTemplate>
+</Representation>
+<Representation id="sl" width="480" height="854" bandwidth="500000">
+<SegmentList><Initialization sourceURL="sl.mp4" range="0-99"/><SegmentURL media="sl.mp4" mediaRange="100-199"/><SegmentURL media="sl.mp4" mediaRange="200-299"/></SegmentList>
+</Representation>
+</AdaptationSet>
+</Period></MPD>`
+
+	doc, err := ParseDASH(manifest)
+	if err != nil {
+		t.Fatalf("ParseDASH: %v", err)
+	}
+	reps := doc.Periods[0].AdaptationSets[0].Representations
+
+	hd := reps[0]
+	if hd.Init == nil || hd.Init.URL != "https://cdn/base/hd/init.mp4" {
+		t.Fatalf("unexpected init: %+v", hd.Init)
+	}
+	if len(hd.Segments) != 3 || hd.Segments[2].URL != "https://cdn/base/hd/seg-003.m4s" {
+		t.Fatalf("unexpected template segments: %+v", hd.Segments)
+	}
+
+	tl := reps[1]
+	if len(tl.Segments) != 3 || tl.Segments[1].URL != "https://cdn/base/tl/5.m4s" || tl.Segments[2].URL != "https://cdn/base/tl/10.m4s" {
+		t.Fatalf("unexpected timeline segments: %+v", tl.Segments)
+	}
+
+	sl := reps[2]
+	if sl.Init == nil || sl.Init.Range != "0-99" || len(sl.Segments) != 2 || sl.Segments[1].Range != "200-299" {
+		t.Fatalf("unexpected segment list: %+v", sl)
+	}
+
+	v := SelectVideo(Media{VideoDashManifest: manifest}, Quality{})
+	if v.Height != 1920 || len(v.Segments) != 4 || v.Segments[0].URL != "https://cdn/base/hd/init.mp4" {
+		t.Fatalf("unexpected selected stream: %+v", v)
+	}
+	if u := SelectVideoURL(Media{VideoDashManifest: manifest}, Quality{}); u != "" {
+		t.Fatalf("segmented streams should not be returned as a single URL, got %q", u)
+	}
+}
+
+func TestParseDASHSkipsRepresentationsWithTooManySegments(t *testing.T) {
+	manifest := `<MPD mediaPresentationDuration="PT10H"><Period>
+<AdaptationSet mimeType="video/mp4">
+<Representation id="repeat" bandwidth="3000000"><SegmentTemplate media="r/$Number$.m4s"><SegmentTimeline><S d="1" r="2000000000"/></SegmentTimeline></SegmentTemplate></Representation>
+<Representation id="tiny" bandwidth="2000000"><SegmentTemplate timescale="1000" duration="1" media="t/$Number$.m4s"/></Representation>
+<Representation id="broken" bandwidth="1500000"><SegmentTemplate duration="4"/></Representation>
+<Representation id="ok" bandwidth="1000000"><BaseURL>https://cdn/ok.mp4</BaseURL></Representation>
+</AdaptationSet>
+</Period></MPD>`
+
+	doc, err := ParseDASH(manifest)
+	if err != nil {
+		t.Fatalf("ParseDASH: %v", err)
+	}
+	reps := doc.Periods[0].AdaptationSets[0].Representations
+	if len(reps) != 1 || reps[0].ID != "ok" {
+		t.Fatalf("unexpected representations: %+v", reps)
+	}
+}
+
+func TestSelectVideoJoinsPeriods(t *testing.T) {
+	manifest := `<MPD>
+<Period duration="PT4S"><AdaptationSet mimeType="video/mp4">
+<Representation id="v" height="720"><BaseURL>https://cdn/p1/</BaseURL><SegmentList><Initialization sourceURL="init.mp4"/><SegmentURL media="1.m4s"/></SegmentList></Representation>
+</AdaptationSet></Period>
+<Period duration="PT4S"><AdaptationSet mimeType="video/mp4">
+<Representation id="v" height="720"><BaseURL>https://cdn/p2/</BaseURL><SegmentList><Initialization sourceURL="init.mp4"/><SegmentURL media="1.m4s"/></SegmentList></Representation>
+</AdaptationSet></Period>
+</MPD>`
+
+	v := SelectVideo(Media{VideoDashManifest: manifest}, Quality{})
+	want := []string{"https://cdn/p1/init.mp4", "https://cdn/p1/1.m4s", "https://cdn/p2/1.m4s"}
+	if len(v.Segments) != len(want) {
+		t.Fatalf("unexpected segments: %+v", v.Segments)
+	}
+	for i, u := range want {
+		if v.Segments[i].URL != u {
+			t.Fatalf("segment %d = %q, want %q", i, v.Segments[i].URL, u)
+		}
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"PT1M2.5S":   62500 * time.Millisecond,
+		"PT1H":       time.Hour,
+		"P1DT0H0M1S": 24*time.Hour + time.Second,
+		"PT0.000S":   0,
+	}
+	for in, want := range cases {
+		got, err := parseISODuration(in)
+		if err != nil || got != want {
+			t.Fatalf("parseISODuration(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := parseISODuration("1M"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSelectAudioPicksHighestBitrate(t *testing.T) {
+	manifest := `<MPD><Period>
+<AdaptationSet contentType="video" mimeType="video/mp4"><Representation id="v" height="720" bandwidth="900000"><BaseURL>https://cdn/v.mp4</BaseURL></Representation></AdaptationSet>
+<AdaptationSet contentType="audio" mimeType="audio/mp4">
+<Representation id="a1" bandwidth="48000"><BaseURL>https://cdn/a-low.mp4</BaseURL></Representation>
+<Representation id="a2" bandwidth="128000" codecs="mp4a.40.2"><BaseURL>https://cdn/a-high.mp4</BaseURL></Representation>
+</AdaptationSet>
+</Period></MPD>`
+
+	a := SelectAudio(Media{VideoDashManifest: manifest})
+	if a.URL != "https://cdn/a-high.mp4" || a.Codecs != "mp4a.40.2" {
+		t.Fatalf("unexpected audio: %+v", a)
+	}
+	if v := SelectVideo(Media{VideoDashManifest: manifest}, Quality{}); v.URL != "https://cdn/v.mp4" {
+		t.Fatalf("audio must not be selected as video: %+v", v)
+	}
+	if !SelectAudio(Media{}).IsZero() {
+		t.Fatal("expected no audio without a manifest")
+	}
+}
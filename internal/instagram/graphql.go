@@ -11,21 +11,29 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Client is safe for concurrent use, so several downloads can share one session.
 type Client struct {
 	httpClient *http.Client
 	userAgent  string
-	lsd        string
-	fbDtsg     string
 	dsUserID   string
+
+	// tokensMu guards the session tokens; it is held while they are fetched so that
+	// concurrent requests wait for a single fetch.
+	tokensMu sync.Mutex
+	lsd      string
+	fbDtsg   string
 }
 
 type Options struct {
 	CookiesPath string
 	UserAgent   string
 	Timeout     time.Duration
+	// Transport sends the requests; nil means http.DefaultTransport.
+	Transport http.RoundTripper
 }
 
 func NewClient(opts Options) (*Client, error) {
@@ -45,8 +53,9 @@ func NewClient(opts Options) (*Client, error) {
 	}
 
 	c := &http.Client{
-		Timeout: opts.Timeout,
-		Jar:     jar,
+		Timeout:   opts.Timeout,
+		Jar:       jar,
+		Transport: opts.Transport,
 	}
 
 	cl := &Client{
@@ -58,6 +67,8 @@ func NewClient(opts Options) (*Client, error) {
 }
 
 func (c *Client) EnsureTokens(ctx context.Context) error {
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
 	if c.lsd != "" && c.fbDtsg != "" {
 		return nil
 	}
@@ -104,6 +115,9 @@ func (c *Client) GraphQL(ctx context.Context, referer, friendlyName, docID strin
 	if err := c.EnsureTokens(ctx); err != nil {
 		return err
 	}
+	c.tokensMu.Lock()
+	lsd, fbDtsg := c.lsd, c.fbDtsg
+	c.tokensMu.Unlock()
 
 	v, err := json.Marshal(variables)
 	if err != nil {
@@ -116,9 +130,9 @@ func (c *Client) GraphQL(ctx context.Context, referer, friendlyName, docID strin
 	form.Set("server_timestamps", "true")
 	form.Set("doc_id", docID)
 	form.Set("variables", string(v))
-	form.Set("lsd", c.lsd)
-	form.Set("fb_dtsg", c.fbDtsg)
-	form.Set("jazoest", jazoestFromDtsg(c.fbDtsg))
+	form.Set("lsd", lsd)
+	form.Set("fb_dtsg", fbDtsg)
+	form.Set("jazoest", jazoestFromDtsg(fbDtsg))
 	form.Set("__a", "1")
 	form.Set("__d", "www")
 	form.Set("__user", "0")
@@ -137,7 +151,7 @@ func (c *Client) GraphQL(ctx context.Context, referer, friendlyName, docID strin
 
 	c.applyCommonHeaders(req, referer)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("X-FB-LSD", c.lsd)
+	req.Header.Set("X-FB-LSD", lsd)
 	req.Header.Set("X-IG-App-ID", igAppID)
 	req.Header.Set("X-ASBD-ID", asbdID)
 
@@ -166,6 +180,54 @@ func (c *Client) GraphQL(ctx context.Context, referer, friendlyName, docID strin
 	return nil
 }
 
+// APIGet performs a GET request against Instagram's private web API and decodes the JSON response into out.
+// Unlike GraphQL it does not need the lsd/fb_dtsg tokens, only the session cookies.
+func (c *Client) APIGet(ctx context.Context, referer, endpoint string, query url.Values, out any) error {
+	if c.cookieValue("sessionid") == "" {
+		return errors.New("cookies.txt is missing sessionid (export cookies from a logged-in Instagram session; Cookie-Editor often outputs a #HttpOnly_... sessionid line)")
+	}
+
+	u := endpoint
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	if referer == "" {
+		referer = baseWWW + "/"
+	}
+
+	c.applyCommonHeaders(req, referer)
+	req.Header.Set("X-IG-App-ID", igAppID)
+	req.Header.Set("X-ASBD-ID", asbdID)
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+
+	if csrf := c.cookieValue("csrftoken"); csrf != "" {
+		req.Header.Set("X-CSRFToken", csrf)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Instagram returned %s", resp.Status)
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return decodeGraphQLResponse(b, out)
+}
+
 type graphQLErrorPayload struct {
 	Status     string `json:"status"`
 	Message    string `json:"message"`
@@ -11,8 +11,18 @@ type highlightsTrayResponse struct {
 		Highlights struct {
 			Edges []struct {
 				Node struct {
-					ID    string `json:"id"`
-					Title string `json:"title"`
+					ID         string `json:"id"`
+					Title      string `json:"title"`
+					CreatedAt  int64  `json:"created_at"`
+					MediaCount int    `json:"media_count"`
+					CoverMedia struct {
+						CroppedImageVersion struct {
+							URL string `json:"url"`
+						} `json:"cropped_image_version"`
+						FullImageVersion struct {
+							URL string `json:"url"`
+						} `json:"full_image_version"`
+					} `json:"cover_media"`
 				} `json:"node"`
 			} `json:"edges"`
 		} `json:"highlights"`
@@ -41,9 +51,17 @@ func (c *Client) FetchHighlightsTray(ctx context.Context, username, userID strin
 		if e.Node.ID == "" {
 			continue
 		}
+		cover := e.Node.CoverMedia.CroppedImageVersion.URL
+		if cover == "" {
+			cover = e.Node.CoverMedia.FullImageVersion.URL
+		}
 		hs = append(hs, Highlight{
-			ID:    e.Node.ID,
-			Title: e.Node.Title,
+			ID:         e.Node.ID,
+			Title:      e.Node.Title,
+			CoverURL:   cover,
+			CreatedAt:  e.Node.CreatedAt,
+			MediaCount: e.Node.MediaCount,
+			Position:   len(hs) + 1,
 		})
 	}
 	return hs, nil
@@ -1,12 +1,11 @@
 package instagram
 
 import (
-	"bytes"
-	"encoding/xml"
-	"errors"
+	"fmt"
 	"net/url"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -14,8 +13,15 @@ import (
 // The list is ordered by resolution (width*height, descending). For each candidate, a "JPEG-normalized"
 // URL is tried first (when applicable), followed by the original URL.
 func BestImageURLs(m Media) []string {
+	return SelectImageURLs(m, Quality{})
+}
+
+// SelectImageURLs is BestImageURLs restricted to candidates no wider than q.MaxImageWidth.
+// When every candidate is wider than the cap, the narrowest one is used.
+func SelectImageURLs(m Media, q Quality) []string {
 	type scored struct {
 		url   string
+		width int
 		score int
 		jpeg  bool
 	}
@@ -27,7 +33,7 @@ func BestImageURLs(m Media) []string {
 			continue
 		}
 		s := c.Width * c.Height
-		cands = append(cands, scored{url: u, score: s, jpeg: looksLikeJPEGURL(u)})
+		cands = append(cands, scored{url: u, width: c.Width, score: s, jpeg: looksLikeJPEGURL(u)})
 	}
 	if len(cands) == 0 {
 		best := strings.TrimSpace(BestImageURL(m))
@@ -37,6 +43,23 @@ func BestImageURLs(m Media) []string {
 		cands = append(cands, scored{url: best, score: 0, jpeg: looksLikeJPEGURL(best)})
 	}
 
+	if q.MaxImageWidth > 0 {
+		fit := cands[:0:0]
+		narrowest := cands[0]
+		for _, c := range cands {
+			if c.width <= q.MaxImageWidth {
+				fit = append(fit, c)
+			}
+			if c.width < narrowest.width {
+				narrowest = c
+			}
+		}
+		if len(fit) == 0 {
+			fit = append(fit, narrowest)
+		}
+		cands = fit
+	}
+
 	sort.SliceStable(cands, func(i, j int) bool {
 		if cands[i].score != cands[j].score {
 			return cands[i].score > cands[j].score
@@ -161,120 +184,304 @@ func BestImageURL(m Media) string {
 	return ""
 }
 
+// Quality constrains which video representation and image candidate are selected.
+// The zero value selects the best available quality.
+type Quality struct {
+	// Worst selects the lowest quality video instead of the highest.
+	Worst bool
+	// MaxHeight caps the video resolution in pixels (0 means no cap). Like "720p", it
+	// applies to the short side, so a 720x1280 portrait video fits a 720 cap.
+	MaxHeight int
+	// MaxBandwidth caps the video bitrate in bits per second (0 means no cap). Versions
+	// without an advertised bitrate are not constrained by it.
+	MaxBandwidth int
+	// MaxImageWidth caps the image width in pixels (0 means no cap).
+	MaxImageWidth int
+}
+
+// ParseVideoQuality parses a --video-quality value: "best", "worst", a resolution cap such as
+// "<=720p", a bitrate cap such as "bandwidth<=2M", or several of them separated by commas.
+func ParseVideoQuality(s string) (Quality, error) {
+	var q Quality
+	for _, tok := range strings.Split(s, ",") {
+		tok = strings.ToLower(strings.TrimSpace(tok))
+		switch {
+		case tok == "" || tok == "best":
+		case tok == "worst":
+			q.Worst = true
+		case strings.HasPrefix(tok, "bandwidth<="):
+			v, err := parseBitrate(strings.TrimPrefix(tok, "bandwidth<="))
+			if err != nil || v <= 0 {
+				return Quality{}, fmt.Errorf("invalid bandwidth in %q", tok)
+			}
+			q.MaxBandwidth = v
+		case strings.HasPrefix(tok, "<="):
+			v, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(tok, "<="), "p"))
+			if err != nil || v <= 0 {
+				return Quality{}, fmt.Errorf("invalid height in %q", tok)
+			}
+			q.MaxHeight = v
+		default:
+			return Quality{}, fmt.Errorf("unknown quality %q (expected best, worst, <=720p or bandwidth<=2M)", tok)
+		}
+	}
+	return q, nil
+}
+
+// parseBitrate parses a bitrate in bits per second with an optional k, M or G suffix.
+func parseBitrate(s string) (int, error) {
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1e3, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		mult, s = 1e6, strings.TrimSuffix(s, "m")
+	case strings.HasSuffix(s, "g"):
+		mult, s = 1e9, strings.TrimSuffix(s, "g")
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int(f * mult), nil
+}
+
 func BestVideoURL(m Media) string {
-	if dash := strings.TrimSpace(m.VideoDashManifest); dash != "" {
-		if u := bestFromDash(dash); u != "" {
-			return u
+	return SelectVideoURL(m, Quality{})
+}
+
+// SelectVideoURL picks the URL of the progressive (single file) video that best matches q,
+// preferring the DASH manifest representations and falling back to VideoVersions. Segmented
+// DASH streams are only returned by SelectVideo.
+func SelectVideoURL(m Media, q Quality) string {
+	var progressive []VideoSource
+	for _, v := range dashVariants(m.VideoDashManifest) {
+		if len(v.Segments) == 0 {
+			progressive = append(progressive, v)
 		}
 	}
+	if v, ok := pickVideoVariant(progressive, q); ok {
+		return v.URL
+	}
+	return selectVideoVersion(m, q).URL
+}
 
-	best := ""
-	bestScore := 0
+// VideoSource is a selected video stream. A progressive stream only has a URL; a segmented
+// DASH stream lists the segments that are concatenated into the file, initialization first.
+type VideoSource struct {
+	URL       string
+	Segments  []DASHSegment
+	Width     int
+	Height    int
+	Bandwidth int
+	Codecs    string
+	FrameRate float64
+}
+
+// IsZero reports whether no video stream was found.
+func (v VideoSource) IsZero() bool {
+	return v.URL == "" && len(v.Segments) == 0
+}
+
+// SelectVideo picks the stream that best matches q among every video representation of the
+// DASH manifest (progressive or segmented), falling back to VideoVersions.
+func SelectVideo(m Media, q Quality) VideoSource {
+	if v, ok := pickVideoVariant(dashVariants(m.VideoDashManifest), q); ok {
+		return v
+	}
+	return selectVideoVersion(m, q)
+}
+
+func selectVideoVersion(m Media, q Quality) VideoSource {
+	vs := make([]VideoSource, 0, len(m.VideoVersions))
 	for _, c := range m.VideoVersions {
 		if c.URL == "" {
 			continue
 		}
-		score := c.Width * c.Height
-		if score > bestScore {
-			bestScore = score
-			best = c.URL
-		}
+		vs = append(vs, VideoSource{URL: c.URL, Width: c.Width, Height: c.Height})
 	}
-	if best != "" {
-		return best
+	if v, ok := pickVideoVariant(vs, q); ok {
+		return v
 	}
 	if len(m.VideoVersions) > 0 {
-		return m.VideoVersions[0].URL
+		return VideoSource{URL: m.VideoVersions[0].URL}
 	}
-	return ""
+	return VideoSource{}
+}
+
+func (v VideoSource) fits(q Quality) bool {
+	if q.MaxHeight > 0 && v.shortSide() > q.MaxHeight {
+		return false
+	}
+	if q.MaxBandwidth > 0 && v.Bandwidth > q.MaxBandwidth {
+		return false
+	}
+	return true
+}
+
+// shortSide returns the smaller dimension of v, or its height when the width is unknown.
+func (v VideoSource) shortSide() int {
+	if v.Width > 0 {
+		return min(v.Width, v.Height)
+	}
+	return v.Height
+}
+
+// pickVideoVariant returns the highest (or, with q.Worst, lowest) variant within the caps of q.
+// When no variant fits the caps, the lowest one is returned so that something is still saved.
+func pickVideoVariant(vs []VideoSource, q Quality) (VideoSource, bool) {
+	if len(vs) == 0 {
+		return VideoSource{}, false
+	}
+	sorted := append([]VideoSource(nil), vs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Height != sorted[j].Height {
+			return sorted[i].Height > sorted[j].Height
+		}
+		if sorted[i].Width != sorted[j].Width {
+			return sorted[i].Width > sorted[j].Width
+		}
+		return sorted[i].Bandwidth > sorted[j].Bandwidth
+	})
+
+	fit := make([]VideoSource, 0, len(sorted))
+	for _, v := range sorted {
+		if v.fits(q) {
+			fit = append(fit, v)
+		}
+	}
+	if len(fit) == 0 {
+		return sorted[len(sorted)-1], true
+	}
+	if q.Worst {
+		return fit[len(fit)-1], true
+	}
+	return fit[0], true
 }
 
-type mpd struct {
-	Periods []period `xml:"Period"`
+// AudioSource is the audio track of a DASH manifest. Like VideoSource, it is either a single
+// URL or a list of segments.
+type AudioSource struct {
+	URL       string
+	Segments  []DASHSegment
+	Bandwidth int
+	Codecs    string
 }
 
-type period struct {
-	AdaptationSets []adaptationSet `xml:"AdaptationSet"`
+// IsZero reports whether no audio stream was found.
+func (a AudioSource) IsZero() bool {
+	return a.URL == "" && len(a.Segments) == 0
 }
 
-type adaptationSet struct {
-	MimeType        string           `xml:"mimeType,attr"`
-	ContentType     string           `xml:"contentType,attr"`
-	Representations []representation `xml:"Representation"`
+// SelectAudio picks the highest-bitrate MP4 audio representation of the DASH manifest.
+// Media without a manifest (or without a separate audio track) yield a zero AudioSource.
+func SelectAudio(m Media) AudioSource {
+	best := VideoSource{}
+	for _, v := range dashStreams(m.VideoDashManifest, DASHRepresentation.IsAudio) {
+		if best.IsZero() || v.Bandwidth > best.Bandwidth {
+			best = v
+		}
+	}
+	return AudioSource{URL: best.URL, Segments: best.Segments, Bandwidth: best.Bandwidth, Codecs: best.Codecs}
 }
 
-type representation struct {
-	Width     int    `xml:"width,attr"`
-	Height    int    `xml:"height,attr"`
-	Bandwidth int    `xml:"bandwidth,attr"`
-	BaseURL   string `xml:"BaseURL"`
+// dashVariants lists the MP4 video streams of a DASH manifest.
+func dashVariants(manifest string) []VideoSource {
+	return dashStreams(manifest, DASHRepresentation.IsVideo)
 }
 
-func bestFromDash(manifest string) string {
-	b := bytes.NewBufferString(manifest)
-	dec := xml.NewDecoder(b)
-	var doc mpd
-	if err := dec.Decode(&doc); err != nil {
-		return ""
+// dashStreams lists the MP4 streams of a DASH manifest whose representations satisfy keep.
+// With several periods, each stream is the matching representation (same id, else closest
+// height) of every period in order; only the first period's initialization segment is kept.
+func dashStreams(manifest string, keep func(DASHRepresentation) bool) []VideoSource {
+	if strings.TrimSpace(manifest) == "" {
+		return nil
+	}
+	doc, err := ParseDASH(manifest)
+	if err != nil || len(doc.Periods) == 0 {
+		return nil
 	}
 
-	var reps []representation
+	periods := make([][]DASHRepresentation, 0, len(doc.Periods))
 	for _, p := range doc.Periods {
+		var reps []DASHRepresentation
 		for _, a := range p.AdaptationSets {
-			ct := strings.ToLower(strings.TrimSpace(a.ContentType))
-			mt := strings.ToLower(strings.TrimSpace(a.MimeType))
-			if ct != "" && ct != "video" {
-				continue
-			}
-			if mt != "" && !strings.Contains(mt, "video") {
-				continue
+			for _, r := range a.Representations {
+				if keep(r) && isMP4Representation(r) {
+					reps = append(reps, r)
+				}
 			}
-			reps = append(reps, a.Representations...)
+		}
+		if len(reps) > 0 {
+			periods = append(periods, reps)
 		}
 	}
-
-	if len(reps) == 0 {
-		return ""
-	}
-
-	reps = filterMP4(reps)
-	if len(reps) == 0 {
-		return ""
+	if len(periods) == 0 {
+		return nil
 	}
 
-	sort.SliceStable(reps, func(i, j int) bool {
-		if reps[i].Height != reps[j].Height {
-			return reps[i].Height > reps[j].Height
+	out := make([]VideoSource, 0, len(periods[0]))
+	for _, first := range periods[0] {
+		v := VideoSource{
+			Width:     first.Width,
+			Height:    first.Height,
+			Bandwidth: first.Bandwidth,
+			Codecs:    first.Codecs,
+			FrameRate: first.FrameRate,
 		}
-		if reps[i].Width != reps[j].Width {
-			return reps[i].Width > reps[j].Width
+		if len(periods) == 1 && !first.Segmented() {
+			v.URL = first.URL
+			out = append(out, v)
+			continue
 		}
-		return reps[i].Bandwidth > reps[j].Bandwidth
-	})
-
-	u := strings.TrimSpace(reps[0].BaseURL)
-	if u == "" {
-		return ""
+		for i, reps := range periods {
+			r := first
+			if i > 0 {
+				r = matchRepresentation(reps, first)
+			}
+			if r.Init != nil && i == 0 {
+				v.Segments = append(v.Segments, *r.Init)
+			}
+			if r.Segmented() {
+				v.Segments = append(v.Segments, r.Segments...)
+			} else {
+				v.Segments = append(v.Segments, DASHSegment{URL: r.URL})
+			}
+		}
+		out = append(out, v)
 	}
-	return u
+	return out
 }
 
-func filterMP4(in []representation) []representation {
-	out := make([]representation, 0, len(in))
-	for _, r := range in {
-		u := strings.TrimSpace(r.BaseURL)
-		if u == "" {
-			continue
+func matchRepresentation(reps []DASHRepresentation, want DASHRepresentation) DASHRepresentation {
+	best := reps[0]
+	for _, r := range reps {
+		if want.ID != "" && r.ID == want.ID {
+			return r
 		}
-		lu := strings.ToLower(u)
-		if strings.Contains(lu, ".mp4") || strings.Contains(lu, "mime=video") {
-			out = append(out, r)
+		if absInt(r.Height-want.Height) < absInt(best.Height-want.Height) {
+			best = r
 		}
 	}
-	if len(out) == 0 {
-		return nil
+	return best
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
 	}
-	return out
+	return v
 }
 
-var _ = errors.New
+// isMP4Representation keeps MP4 streams that have something to download. Streams without a
+// mime type are accepted when their URL looks like an MP4 file.
+func isMP4Representation(r DASHRepresentation) bool {
+	if !r.Segmented() && r.URL == "" {
+		return false
+	}
+	if r.MimeType != "" {
+		return strings.Contains(r.MimeType, "mp4")
+	}
+	lu := strings.ToLower(r.URL)
+	return strings.Contains(lu, ".mp4") || strings.Contains(lu, "mime=video") || strings.Contains(lu, "mime=audio")
+}
@@ -19,3 +19,74 @@ func TestNormalizeImageURLToJPEG_AlreadyJPEG_Unchanged(t *testing.T) {
 		t.Fatalf("unexpected output: got %q want %q", out, in)
 	}
 }
+
+func TestParseVideoQuality(t *testing.T) {
+	q, err := ParseVideoQuality("<=720p, bandwidth<=1.5M")
+	if err != nil {
+		t.Fatalf("ParseVideoQuality: %v", err)
+	}
+	if q.MaxHeight != 720 || q.MaxBandwidth != 1500000 || q.Worst {
+		t.Fatalf("unexpected quality: %+v", q)
+	}
+	if q, err := ParseVideoQuality("worst"); err != nil || !q.Worst {
+		t.Fatalf("unexpected worst quality: %+v, %v", q, err)
+	}
+	for _, bad := range []string{"high", "<=p", "bandwidth<=fast"} {
+		if _, err := ParseVideoQuality(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestSelectVideoURLAppliesCapsToDashAndVersions(t *testing.T) {
+	dash := `<MPD><Period><AdaptationSet mimeType="video/mp4">
+<Representation width="1080" height="1920" bandwidth="3000000"><BaseURL>https://cdn/1080.mp4</BaseURL></Representation>
+<Representation width="720" height="1280" bandwidth="1500000"><BaseURL>https://cdn/720.mp4</BaseURL></Representation>
+<Representation width="480" height="854" bandwidth="700000"><BaseURL>https://cdn/480.mp4</BaseURL></Representation>
+</AdaptationSet></Period></MPD>`
+	m := Media{VideoDashManifest: dash}
+	hd, err := ParseVideoQuality("<=720p")
+	if err != nil {
+		t.Fatalf("ParseVideoQuality: %v", err)
+	}
+
+	cases := []struct {
+		q    Quality
+		want string
+	}{
+		{Quality{}, "https://cdn/1080.mp4"},
+		{Quality{Worst: true}, "https://cdn/480.mp4"},
+		{hd, "https://cdn/720.mp4"},
+		{Quality{MaxHeight: 1080}, "https://cdn/1080.mp4"},
+		{Quality{MaxBandwidth: 1000000}, "https://cdn/480.mp4"},
+		{Quality{MaxHeight: 100}, "https://cdn/480.mp4"},
+	}
+	for _, tc := range cases {
+		if got := SelectVideoURL(m, tc.q); got != tc.want {
+			t.Fatalf("SelectVideoURL(%+v) = %q, want %q", tc.q, got, tc.want)
+		}
+	}
+
+	m = Media{VideoVersions: []Candidate{
+		{URL: "https://cdn/a.mp4", Width: 720, Height: 1280},
+		{URL: "https://cdn/b.mp4", Width: 480, Height: 854},
+	}}
+	if got := SelectVideoURL(m, Quality{MaxHeight: 600, MaxBandwidth: 1}); got != "https://cdn/b.mp4" {
+		t.Fatalf("unexpected video version: %q", got)
+	}
+}
+
+func TestSelectImageURLsCapsWidth(t *testing.T) {
+	m := Media{ImageVersions2: ImageVersions2{Candidates: []Candidate{
+		{URL: "https://cdn/1440.jpg", Width: 1440, Height: 1440},
+		{URL: "https://cdn/640.jpg", Width: 640, Height: 640},
+		{URL: "https://cdn/320.jpg", Width: 320, Height: 320},
+	}}}
+
+	if got := SelectImageURLs(m, Quality{MaxImageWidth: 1080}); len(got) == 0 || got[0] != "https://cdn/640.jpg" {
+		t.Fatalf("unexpected capped urls: %v", got)
+	}
+	if got := SelectImageURLs(m, Quality{MaxImageWidth: 100}); len(got) != 1 || got[0] != "https://cdn/320.jpg" {
+		t.Fatalf("expected narrowest fallback, got %v", got)
+	}
+}
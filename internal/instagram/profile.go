@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strings"
 )
 
 var profileUserIDPatterns = []*regexp.Regexp{
@@ -48,10 +50,89 @@ func (c *Client) FetchProfile(ctx context.Context, username string) (Profile, er
 		return Profile{}, err
 	}
 
-	return Profile{
+	profile := Profile{
 		Username: username,
 		UserID:   parseProfileUserID(body),
-	}, nil
+	}
+
+	// Profile metadata is best-effort: the download pipeline only needs the user id.
+	if info, err := c.fetchWebProfileInfo(ctx, username); err == nil {
+		applyWebProfileInfo(&profile, info)
+	}
+	return profile, nil
+}
+
+type webProfileInfoResponse struct {
+	Data struct {
+		User *webProfileUser `json:"user"`
+	} `json:"data"`
+	Status string `json:"status"`
+}
+
+type webProfileUser struct {
+	ID              string `json:"id"`
+	Username        string `json:"username"`
+	FullName        string `json:"full_name"`
+	Biography       string `json:"biography"`
+	ExternalURL     string `json:"external_url"`
+	CategoryName    string `json:"category_name"`
+	IsVerified      bool   `json:"is_verified"`
+	IsPrivate       bool   `json:"is_private"`
+	ProfilePicURL   string `json:"profile_pic_url"`
+	ProfilePicURLHD string `json:"profile_pic_url_hd"`
+	BioLinks        []struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	} `json:"bio_links"`
+	EdgeFollowedBy struct {
+		Count int64 `json:"count"`
+	} `json:"edge_followed_by"`
+	EdgeFollow struct {
+		Count int64 `json:"count"`
+	} `json:"edge_follow"`
+	EdgeOwnerToTimelineMedia struct {
+		Count int64 `json:"count"`
+	} `json:"edge_owner_to_timeline_media"`
+}
+
+func (c *Client) fetchWebProfileInfo(ctx context.Context, username string) (*webProfileUser, error) {
+	referer := fmt.Sprintf("%s/%s/", baseWWW, username)
+	q := url.Values{}
+	q.Set("username", username)
+
+	var out webProfileInfoResponse
+	if err := c.APIGet(ctx, referer, webProfileInfoURL, q, &out); err != nil {
+		return nil, err
+	}
+	if out.Data.User == nil {
+		return nil, errors.New("profile info missing from response")
+	}
+	return out.Data.User, nil
+}
+
+func applyWebProfileInfo(p *Profile, u *webProfileUser) {
+	if p.UserID == "" {
+		p.UserID = u.ID
+	}
+	p.HasInfo = true
+	p.FullName = u.FullName
+	p.Biography = u.Biography
+	p.ExternalURL = strings.TrimSpace(u.ExternalURL)
+	p.Category = u.CategoryName
+	p.IsVerified = u.IsVerified
+	p.IsPrivate = u.IsPrivate
+	p.ProfilePicURL = u.ProfilePicURL
+	p.ProfilePicURLHD = u.ProfilePicURLHD
+	p.FollowerCount = u.EdgeFollowedBy.Count
+	p.FollowingCount = u.EdgeFollow.Count
+	p.PostCount = u.EdgeOwnerToTimelineMedia.Count
+
+	p.BioLinks = nil
+	for _, l := range u.BioLinks {
+		if link := strings.TrimSpace(l.URL); link != "" {
+			p.BioLinks = append(p.BioLinks, link)
+		}
+	}
 }
 
 func parseProfileUserID(body []byte) string {
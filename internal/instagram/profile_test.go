@@ -27,3 +27,30 @@ func TestParseProfileUserIDReturnsEmptyWhenMissing(t *testing.T) {
 		t.Fatalf("expected empty user id, got %q", got)
 	}
 }
+
+func TestApplyWebProfileInfoCopiesCountsAndLinks(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"data":{"user":{"id":"42","full_name":"NASA","biography":"Exploring the universe",
+		"external_url":" https://nasa.gov ","category_name":"Government Organization","is_verified":true,
+		"profile_pic_url_hd":"https://cdn/hd.jpg","bio_links":[{"title":"site","url":"https://nasa.gov"},{"url":""}],
+		"edge_followed_by":{"count":100},"edge_follow":{"count":7},"edge_owner_to_timeline_media":{"count":12}}},"status":"ok"}`)
+
+	var out webProfileInfoResponse
+	if err := decodeGraphQLResponse(body, &out); err != nil {
+		t.Fatalf("decodeGraphQLResponse: %v", err)
+	}
+
+	p := Profile{Username: "nasa"}
+	applyWebProfileInfo(&p, out.Data.User)
+
+	if !p.HasInfo || p.UserID != "42" || p.FullName != "NASA" || !p.IsVerified {
+		t.Fatalf("unexpected profile: %+v", p)
+	}
+	if p.FollowerCount != 100 || p.FollowingCount != 7 || p.PostCount != 12 {
+		t.Fatalf("unexpected counts: %+v", p)
+	}
+	if p.ExternalURL != "https://nasa.gov" || len(p.BioLinks) != 1 || p.BioLinks[0] != "https://nasa.gov" {
+		t.Fatalf("unexpected links: %q %q", p.ExternalURL, p.BioLinks)
+	}
+}
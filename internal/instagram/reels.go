@@ -0,0 +1,60 @@
+package instagram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type reelsResponse struct {
+	Data struct {
+		Connection struct {
+			Edges []struct {
+				Node struct {
+					Media Media `json:"media"`
+				} `json:"node"`
+			} `json:"edges"`
+			PageInfo PageInfo `json:"page_info"`
+		} `json:"xdt_api__v1__clips__user__connection_v2"`
+	} `json:"data"`
+	Status string `json:"status"`
+}
+
+// FetchReelsPage returns one page of the profile's Reels tab. It includes reels that are
+// hidden from the main grid and therefore never returned by FetchPostsPage.
+func (c *Client) FetchReelsPage(ctx context.Context, username, userID, after string) ([]Media, PageInfo, error) {
+	username = normalizeUsername(username)
+	if userID == "" {
+		return nil, PageInfo{}, errors.New("profile id is empty")
+	}
+	referer := fmt.Sprintf("%s/%s/reels/", baseWWW, username)
+
+	vars := map[string]any{
+		"after":  nil,
+		"before": nil,
+		"data": map[string]any{
+			"include_feed_video": true,
+			"page_size":          12,
+			"target_user_id":     userID,
+		},
+		"first": 12,
+		"last":  nil,
+	}
+	if after != "" {
+		vars["after"] = after
+	}
+
+	var out reelsResponse
+	if err := c.GraphQL(ctx, referer, "PolarisProfileReelsTabContentQuery_connection", docReelsTab, vars, &out); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	items := make([]Media, 0, len(out.Data.Connection.Edges))
+	for _, e := range out.Data.Connection.Edges {
+		if e.Node.Media.PK == "" && e.Node.Media.ID == "" {
+			continue
+		}
+		items = append(items, e.Node.Media)
+	}
+	return items, out.Data.Connection.PageInfo, nil
+}
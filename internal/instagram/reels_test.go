@@ -0,0 +1,43 @@
+package instagram
+
+import "testing"
+
+func TestReelsResponseDecodesPlayCountAndMusic(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"data":{"xdt_api__v1__clips__user__connection_v2":{"edges":[{"node":{"media":{
+		"pk":"1","code":"abc","media_type":2,"product_type":"clips","play_count":1234,
+		"clips_metadata":{"music_info":{"music_asset_info":{"title":"Song","display_artist":"Band"}}}}}}],
+		"page_info":{"end_cursor":"next","has_next_page":true}}},"status":"ok"}`)
+
+	var out reelsResponse
+	if err := decodeGraphQLResponse(body, &out); err != nil {
+		t.Fatalf("decodeGraphQLResponse: %v", err)
+	}
+	edges := out.Data.Connection.Edges
+	if len(edges) != 1 {
+		t.Fatalf("expected 1 reel, got %d", len(edges))
+	}
+
+	m := edges[0].Node.Media
+	if m.Plays() != 1234 {
+		t.Fatalf("unexpected play count: %d", m.Plays())
+	}
+	title, artist, original := m.Audio()
+	if title != "Song" || artist != "Band" || original {
+		t.Fatalf("unexpected audio: %q %q %v", title, artist, original)
+	}
+}
+
+func TestMediaAudioFallsBackToOriginalSound(t *testing.T) {
+	t.Parallel()
+
+	m := Media{ClipsMetadata: &ClipsMetadata{
+		OriginalSoundInfo: &OriginalSoundInfo{OriginalAudioTitle: "Original audio", IGArtist: IGUser{Username: "creator"}},
+	}}
+
+	title, artist, original := m.Audio()
+	if title != "Original audio" || artist != "creator" || !original {
+		t.Fatalf("unexpected audio: %q %q %v", title, artist, original)
+	}
+}
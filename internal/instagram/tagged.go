@@ -0,0 +1,48 @@
+package instagram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type taggedResponse struct {
+	Data struct {
+		Connection struct {
+			Edges []struct {
+				Node Media `json:"node"`
+			} `json:"edges"`
+			PageInfo PageInfo `json:"page_info"`
+		} `json:"xdt_api__v1__usertags__user_id__feed_connection"`
+	} `json:"data"`
+	Status string `json:"status"`
+}
+
+// FetchTaggedPage returns one page of posts in which the user is tagged by other accounts.
+// Each item's User field identifies the account that owns the post.
+func (c *Client) FetchTaggedPage(ctx context.Context, username, userID, after string) ([]Media, PageInfo, error) {
+	username = normalizeUsername(username)
+	if userID == "" {
+		return nil, PageInfo{}, errors.New("profile id is empty")
+	}
+	referer := fmt.Sprintf("%s/%s/tagged/", baseWWW, username)
+
+	vars := map[string]any{
+		"count":   12,
+		"user_id": userID,
+	}
+	if after != "" {
+		vars["after"] = after
+	}
+
+	var out taggedResponse
+	if err := c.GraphQL(ctx, referer, "PolarisProfileTaggedTabContentQuery", docTaggedPosts, vars, &out); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	items := make([]Media, 0, len(out.Data.Connection.Edges))
+	for _, e := range out.Data.Connection.Edges {
+		items = append(items, e.Node)
+	}
+	return items, out.Data.Connection.PageInfo, nil
+}
@@ -1,8 +1,26 @@
 package instagram
 
+import "encoding/json"
+
 type Profile struct {
 	Username string
 	UserID   string
+
+	// The fields below come from the web profile info endpoint. HasInfo reports whether
+	// that request succeeded; when it is false only Username and UserID are populated.
+	HasInfo         bool
+	FullName        string
+	Biography       string
+	ExternalURL     string
+	BioLinks        []string
+	FollowerCount   int64
+	FollowingCount  int64
+	PostCount       int64
+	Category        string
+	IsVerified      bool
+	IsPrivate       bool
+	ProfilePicURL   string
+	ProfilePicURLHD string
 }
 
 type Candidate struct {
@@ -33,6 +51,80 @@ type Media struct {
 	VideoVersions     []Candidate    `json:"video_versions"`
 	VideoDashManifest string         `json:"video_dash_manifest"`
 	CarouselMedia     []Media        `json:"carousel_media"`
+	Caption           *Caption       `json:"caption"`
+	LikeCount         int64          `json:"like_count"`
+	CommentCount      int64          `json:"comment_count"`
+	PlayCount         int64          `json:"play_count"`
+	IGPlayCount       int64          `json:"ig_play_count"`
+	ViewCount         int64          `json:"view_count"`
+	ClipsMetadata     *ClipsMetadata `json:"clips_metadata"`
+	// TimelinePinnedUserIDs is non-empty for posts pinned to the top of a profile grid.
+	TimelinePinnedUserIDs []json.RawMessage `json:"timeline_pinned_user_ids"`
+}
+
+type Caption struct {
+	Text      string `json:"text"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// CaptionText returns the post caption, or an empty string when the post has none.
+func (m Media) CaptionText() string {
+	if m.Caption == nil {
+		return ""
+	}
+	return m.Caption.Text
+}
+
+// IsPinned reports whether the post is pinned to the profile grid. Pinned posts are
+// returned first regardless of their date.
+func (m Media) IsPinned() bool {
+	return len(m.TimelinePinnedUserIDs) > 0
+}
+
+// ClipsMetadata holds the reel-specific fields, most notably the audio attribution.
+type ClipsMetadata struct {
+	MusicInfo *struct {
+		MusicAssetInfo MusicAssetInfo `json:"music_asset_info"`
+	} `json:"music_info"`
+	OriginalSoundInfo *OriginalSoundInfo `json:"original_sound_info"`
+}
+
+type MusicAssetInfo struct {
+	Title          string `json:"title"`
+	DisplayArtist  string `json:"display_artist"`
+	AudioClusterID string `json:"audio_cluster_id"`
+}
+
+type OriginalSoundInfo struct {
+	OriginalAudioTitle string `json:"original_audio_title"`
+	IGArtist           IGUser `json:"ig_artist"`
+}
+
+// Audio returns the title and artist of the audio used by a reel. Licensed music takes
+// precedence over original audio; both values are empty when no attribution is present.
+func (m Media) Audio() (title, artist string, original bool) {
+	if m.ClipsMetadata == nil {
+		return "", "", false
+	}
+	if mi := m.ClipsMetadata.MusicInfo; mi != nil && (mi.MusicAssetInfo.Title != "" || mi.MusicAssetInfo.DisplayArtist != "") {
+		return mi.MusicAssetInfo.Title, mi.MusicAssetInfo.DisplayArtist, false
+	}
+	if osi := m.ClipsMetadata.OriginalSoundInfo; osi != nil {
+		return osi.OriginalAudioTitle, osi.IGArtist.Username, true
+	}
+	return "", "", false
+}
+
+// Plays returns the best available play count for a video.
+func (m Media) Plays() int64 {
+	switch {
+	case m.PlayCount > 0:
+		return m.PlayCount
+	case m.IGPlayCount > 0:
+		return m.IGPlayCount
+	default:
+		return m.ViewCount
+	}
 }
 
 type PageInfo struct {
@@ -41,6 +133,11 @@ type PageInfo struct {
 }
 
 type Highlight struct {
-	ID    string
-	Title string
+	ID         string
+	Title      string
+	CoverURL   string
+	CreatedAt  int64
+	MediaCount int
+	// Position is the 1-based order of the highlight in the profile tray.
+	Position int
 }
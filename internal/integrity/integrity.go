@@ -0,0 +1,224 @@
+// Package integrity detects truncated or corrupt media files.
+package integrity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Checked reports whether files with this extension are validated by CheckFile.
+func Checked(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg", ".png", ".webp", ".mp4", ".m4a":
+		return true
+	}
+	return false
+}
+
+// CheckFile validates a file according to its extension. Other extensions are not checked.
+func CheckFile(path string) error {
+	return CheckFileAs(path, filepath.Ext(path))
+}
+
+// CheckFileAs validates path as a file with the given extension, which lets callers check a
+// temporary file before giving it its final name.
+func CheckFileAs(path, ext string) error {
+	if !Checked(ext) {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Check(f, ext)
+}
+
+// Check reads r to the end and validates it as a file with the given extension.
+func Check(r io.Reader, ext string) error {
+	v := NewVerifier(ext)
+	if _, err := io.Copy(v, r); err != nil {
+		return err
+	}
+	return v.Close()
+}
+
+// headLimit is how much of an image is kept to decode its header.
+const headLimit = 256 << 10
+
+// tailLen is how much of the end of an image is kept to find its end marker.
+const tailLen = 64
+
+// Verifier validates a file while it is written, so that it can be checked without being
+// read again. Close reports the result.
+//
+// Images must have a decodable header and must not be truncated: JPEG files end with an EOI
+// marker, PNG files with an IEND chunk, and the RIFF size of WebP files matches the file size.
+// MP4/M4A files must consist of complete top-level boxes and contain ftyp, moov and mdat.
+type Verifier struct {
+	mp4  bool
+	off  bool
+	size int64
+
+	// Images.
+	head []byte
+	tail []byte
+
+	// MP4: the partial header of the next box, the bytes left in the current box (-1 when it
+	// extends to the end of the file) and the top-level box types seen so far.
+	hdr   []byte
+	left  int64
+	boxes map[string]bool
+	err   error
+}
+
+// NewVerifier returns a Verifier for files with the given extension. Extensions that are
+// not Checked always pass.
+func NewVerifier(ext string) *Verifier {
+	ext = strings.ToLower(ext)
+	return &Verifier{
+		mp4:   ext == ".mp4" || ext == ".m4a",
+		off:   !Checked(ext),
+		boxes: map[string]bool{},
+	}
+}
+
+// Write never fails; errors are reported by Close.
+func (v *Verifier) Write(p []byte) (int, error) {
+	n := len(p)
+	v.size += int64(n)
+	switch {
+	case v.off:
+	case v.mp4:
+		v.walkBoxes(p)
+	default:
+		if len(v.head) < headLimit {
+			v.head = append(v.head, p[:min(len(p), headLimit-len(v.head))]...)
+		}
+		if len(p) >= tailLen {
+			v.tail = append(v.tail[:0], p[len(p)-tailLen:]...)
+		} else {
+			v.tail = append(v.tail, p...)
+			if len(v.tail) > tailLen {
+				v.tail = append(v.tail[:0], v.tail[len(v.tail)-tailLen:]...)
+			}
+		}
+	}
+	return n, nil
+}
+
+// walkBoxes follows the top-level box headers of an MP4 stream.
+func (v *Verifier) walkBoxes(p []byte) {
+	for len(p) > 0 && v.err == nil {
+		if v.left < 0 {
+			return
+		}
+		if v.left > 0 {
+			skip := min(v.left, int64(len(p)))
+			v.left -= skip
+			p = p[skip:]
+			continue
+		}
+
+		need := 8
+		if len(v.hdr) >= 4 && binary.BigEndian.Uint32(v.hdr[0:4]) == 1 {
+			need = 16
+		}
+		take := min(need-len(v.hdr), len(p))
+		v.hdr = append(v.hdr, p[:take]...)
+		p = p[take:]
+		if len(v.hdr) < need {
+			continue
+		}
+		if need == 8 && binary.BigEndian.Uint32(v.hdr[0:4]) == 1 {
+			// A 64-bit size follows the type.
+			continue
+		}
+
+		typ := string(v.hdr[4:8])
+		size := int64(binary.BigEndian.Uint32(v.hdr[0:4]))
+		if size == 1 {
+			size = int64(binary.BigEndian.Uint64(v.hdr[8:16]))
+		}
+		v.boxes[typ] = true
+		switch {
+		case size == 0:
+			v.left = -1
+		case size < int64(len(v.hdr)):
+			v.err = fmt.Errorf("box at offset %d: invalid size %d for %q", v.size-int64(len(p))-int64(len(v.hdr)), size, typ)
+		default:
+			v.left = size - int64(len(v.hdr))
+		}
+		v.hdr = v.hdr[:0]
+	}
+}
+
+// Close reports whether the written data is a valid file.
+func (v *Verifier) Close() error {
+	if v.off {
+		return nil
+	}
+	if v.size == 0 {
+		return errors.New("empty file")
+	}
+	if v.mp4 {
+		return v.checkMP4()
+	}
+	return v.checkImage()
+}
+
+func (v *Verifier) checkMP4() error {
+	if v.err != nil {
+		return fmt.Errorf("invalid MP4: %v", v.err)
+	}
+	if len(v.hdr) > 0 {
+		return errors.New("invalid MP4: truncated box header")
+	}
+	if v.left > 0 {
+		return fmt.Errorf("invalid MP4: last box is missing %d bytes", v.left)
+	}
+	for _, typ := range []string{"ftyp", "moov", "mdat"} {
+		if !v.boxes[typ] {
+			return fmt.Errorf("invalid MP4: missing %s box", typ)
+		}
+	}
+	return nil
+}
+
+func (v *Verifier) checkImage() error {
+	_, format, err := image.DecodeConfig(bytes.NewReader(v.head))
+	if err != nil {
+		return fmt.Errorf("invalid image: %v", err)
+	}
+
+	switch format {
+	case "jpeg":
+		// Some encoders pad the file after the EOI marker.
+		if !bytes.HasSuffix(bytes.TrimRight(v.tail, "\x00"), []byte{0xFF, 0xD9}) {
+			return errors.New("truncated JPEG: missing end of image marker")
+		}
+	case "png":
+		if !bytes.HasSuffix(v.tail, []byte("IEND\xAE\x42\x60\x82")) {
+			return errors.New("truncated PNG: missing IEND chunk")
+		}
+	case "webp":
+		if len(v.head) < 8 {
+			return errors.New("truncated WebP header")
+		}
+		if want := int64(binary.LittleEndian.Uint32(v.head[4:8])) + 8; want != v.size && want+1 != v.size {
+			return fmt.Errorf("truncated WebP: RIFF size %d, file size %d", want, v.size)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package integrity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func mp4Box(typ string, payload []byte) []byte {
+	out := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(out, uint32(8+len(payload)))
+	copy(out[4:], typ)
+	return append(out, payload...)
+}
+
+func TestCheckFile(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	var jpg, pngData bytes.Buffer
+	if err := jpeg.Encode(&jpg, img, nil); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	movie := bytes.Join([][]byte{mp4Box("ftyp", []byte("isom")), mp4Box("moov", nil), mp4Box("mdat", []byte("data"))}, nil)
+	noMoov := bytes.Join([][]byte{mp4Box("ftyp", []byte("isom")), mp4Box("mdat", []byte("data"))}, nil)
+
+	cases := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"ok.jpg", jpg.Bytes(), true},
+		{"short.jpg", jpg.Bytes()[:jpg.Len()-10], false},
+		{"ok.png", pngData.Bytes(), true},
+		{"short.png", pngData.Bytes()[:pngData.Len()-4], false},
+		{"ok.mp4", movie, true},
+		{"short.mp4", movie[:len(movie)-2], false},
+		{"nomoov.m4a", noMoov, false},
+		{"empty.jpg", nil, false},
+		{"text.jpg", []byte("<html>"), false},
+		{"notes.txt", []byte("anything"), true},
+	}
+
+	dir := t.TempDir()
+	for _, tc := range cases {
+		path := filepath.Join(dir, tc.name)
+		if err := os.WriteFile(path, tc.data, 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		err := CheckFile(path)
+		if tc.ok && err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !tc.ok && err == nil {
+			t.Fatalf("%s: expected error", tc.name)
+		}
+	}
+}
+
+func TestVerifierAcceptsAnyWriteSizes(t *testing.T) {
+	t.Parallel()
+
+	large := make([]byte, 16)
+	binary.BigEndian.PutUint32(large, 1)
+	copy(large[4:], "mdat")
+	binary.BigEndian.PutUint64(large[8:], 16+3)
+	large = append(large, "abc"...)
+	movie := bytes.Join([][]byte{mp4Box("ftyp", []byte("isom")), mp4Box("moov", nil), large}, nil)
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, img, nil); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+
+	cases := []struct {
+		ext  string
+		data []byte
+		ok   bool
+	}{
+		{".mp4", movie, true},
+		{".mp4", movie[:len(movie)-1], false},
+		{".mp4", movie[:len(movie)-5], false},
+		{".jpg", jpg.Bytes(), true},
+		{".jpg", jpg.Bytes()[:jpg.Len()-1], false},
+	}
+	for _, tc := range cases {
+		for _, chunk := range []int{1, 3, 7, len(tc.data)} {
+			v := NewVerifier(tc.ext)
+			for data := tc.data; len(data) > 0; {
+				n := min(chunk, len(data))
+				_, _ = v.Write(data[:n])
+				data = data[n:]
+			}
+			err := v.Close()
+			if tc.ok && err != nil {
+				t.Fatalf("%s (%d bytes, chunks of %d): unexpected error: %v", tc.ext, len(tc.data), chunk, err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("%s (%d bytes, chunks of %d): expected error", tc.ext, len(tc.data), chunk)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package mp4 reads the box structure of ISO base media (MP4/M4A) files and writes
+// iTunes-style metadata tags into them.
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Box is a box (atom) inside an MP4 file or inside another box's payload.
+type Box struct {
+	Type string
+	// Offset is the position of the box header relative to the start of the parsed data.
+	Offset int64
+	// Size is the total size of the box, header included.
+	Size int64
+	// HeaderSize is 8, or 16 for boxes with a 64-bit size.
+	HeaderSize int64
+}
+
+// PayloadOffset is the position of the box payload relative to the start of the parsed data.
+func (b Box) PayloadOffset() int64 {
+	return b.Offset + b.HeaderSize
+}
+
+// ReadBoxes lists the consecutive boxes in data. A box with size 0 extends to the end of data.
+func ReadBoxes(data []byte) ([]Box, error) {
+	return ReadBoxesAt(bytes.NewReader(data), int64(len(data)))
+}
+
+// ReadBoxesAt lists the consecutive boxes of a file of the given size, reading only their
+// headers. A box with size 0 extends to the end of the file.
+func ReadBoxesAt(r io.ReaderAt, size int64) ([]Box, error) {
+	var boxes []Box
+	hdr := make([]byte, 16)
+	for off := int64(0); off < size; {
+		n, err := r.ReadAt(hdr[:min(16, size-off)], off)
+		if err != nil && err != io.EOF {
+			return boxes, err
+		}
+		b, err := readBoxHeader(hdr[:n], size-off)
+		if err != nil {
+			return boxes, fmt.Errorf("box at offset %d: %v", off, err)
+		}
+		b.Offset = off
+		boxes = append(boxes, b)
+		off += b.Size
+	}
+	return boxes, nil
+}
+
+// readBoxHeader parses the header at the start of hdr for a box that may span at most
+// remaining bytes.
+func readBoxHeader(hdr []byte, remaining int64) (Box, error) {
+	if len(hdr) < 8 {
+		return Box{}, errors.New("truncated box header")
+	}
+	b := Box{
+		Type:       string(hdr[4:8]),
+		Size:       int64(binary.BigEndian.Uint32(hdr[0:4])),
+		HeaderSize: 8,
+	}
+	switch b.Size {
+	case 0:
+		b.Size = remaining
+	case 1:
+		if len(hdr) < 16 {
+			return Box{}, errors.New("truncated 64-bit box header")
+		}
+		b.Size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+		b.HeaderSize = 16
+	}
+	if b.Size < b.HeaderSize {
+		return Box{}, fmt.Errorf("invalid size %d for %q", b.Size, b.Type)
+	}
+	if b.Size > remaining {
+		return Box{}, fmt.Errorf("%q box of %d bytes exceeds the remaining %d bytes", b.Type, b.Size, remaining)
+	}
+	return b, nil
+}
+
+func find(boxes []Box, typ string) (Box, bool) {
+	for _, b := range boxes {
+		if b.Type == typ {
+			return b, true
+		}
+	}
+	return Box{}, false
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	out := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(out[0:4], uint32(size))
+	copy(out[4:8], typ)
+	for _, p := range payload {
+		out = append(out, p...)
+	}
+	return out
+}
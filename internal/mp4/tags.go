@@ -0,0 +1,272 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Tags are the iTunes metadata fields written by WithTags.
+type Tags struct {
+	Title  string
+	Artist string
+}
+
+// WithTags returns a copy of an MP4 file with its user data box (udta) replaced by one that
+// holds tags. Because the movie box grows, absolute offsets that point past it are shifted:
+// chunk offsets (stco/co64) and, in fragmented files, explicit base data offsets (tfhd) and
+// fragment offsets of the random access index (tfra).
+func WithTags(data []byte, tags Tags) ([]byte, error) {
+	top, err := ReadBoxes(data)
+	if err != nil {
+		return nil, err
+	}
+	moov, ok := find(top, "moov")
+	if !ok {
+		return nil, errors.New("no moov box")
+	}
+	moovEnd := moov.Offset + moov.Size
+	children, err := ReadBoxes(data[moov.PayloadOffset():moovEnd])
+	if err != nil {
+		return nil, fmt.Errorf("moov: %v", err)
+	}
+
+	payload := make([]byte, 0, moov.Size)
+	for _, c := range children {
+		if c.Type == "udta" {
+			continue
+		}
+		start := moov.PayloadOffset() + c.Offset
+		payload = append(payload, data[start:start+c.Size]...)
+	}
+	payload = append(payload, userData(tags)...)
+	newMoov := box("moov", payload)
+
+	if delta := int64(len(newMoov)) - moov.Size; delta != 0 {
+		if err := shiftChunkOffsets(newMoov[8:], moovEnd, delta); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]byte, 0, int64(len(data))-moov.Size+int64(len(newMoov)))
+	out = append(out, data[:moov.Offset]...)
+	out = append(out, newMoov...)
+	out = append(out, data[moovEnd:]...)
+	if delta := int64(len(newMoov)) - moov.Size; delta != 0 {
+		if err := shiftFragmentOffsets(out[moov.Offset+int64(len(newMoov)):], moovEnd, delta); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// shiftFragmentOffsets adds delta to the absolute offsets at or after threshold in the
+// top-level boxes that follow the movie box: tfhd base data offsets in moof/traf and moof
+// offsets in mfra/tfra.
+func shiftFragmentOffsets(data []byte, threshold, delta int64) error {
+	top, err := ReadBoxes(data)
+	if err != nil {
+		return err
+	}
+	shift := func(entry []byte) {
+		if v := int64(binary.BigEndian.Uint64(entry)); v >= threshold {
+			binary.BigEndian.PutUint64(entry, uint64(v+delta))
+		}
+	}
+	for _, b := range top {
+		if b.Type != "moof" && b.Type != "mfra" {
+			continue
+		}
+		body := data[b.PayloadOffset() : b.Offset+b.Size]
+		children, err := ReadBoxes(body)
+		if err != nil {
+			return fmt.Errorf("%s: %v", b.Type, err)
+		}
+		for _, c := range children {
+			cbody := body[c.PayloadOffset() : c.Offset+c.Size]
+			switch c.Type {
+			case "traf":
+				tfhd, err := ReadBoxes(cbody)
+				if err != nil {
+					return fmt.Errorf("traf: %v", err)
+				}
+				h, ok := find(tfhd, "tfhd")
+				if !ok {
+					continue
+				}
+				hbody := cbody[h.PayloadOffset() : h.Offset+h.Size]
+				if len(hbody) < 8 {
+					return errors.New("truncated tfhd box")
+				}
+				// Flag 0x000001: base-data-offset-present, a 64-bit offset after the track ID.
+				if binary.BigEndian.Uint32(hbody[0:4])&1 == 0 {
+					continue
+				}
+				if len(hbody) < 16 {
+					return errors.New("truncated tfhd box")
+				}
+				shift(hbody[8:16])
+			case "tfra":
+				if err := shiftRandomAccessOffsets(cbody, threshold, delta); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// shiftRandomAccessOffsets adds delta to the moof offsets of a tfra payload that are at or
+// after threshold.
+func shiftRandomAccessOffsets(body []byte, threshold, delta int64) error {
+	if len(body) < 16 {
+		return errors.New("truncated tfra box")
+	}
+	// Version 1 uses 64-bit times and offsets.
+	width := 4
+	if body[0] == 1 {
+		width = 8
+	}
+	sizes := binary.BigEndian.Uint32(body[8:12])
+	// traf_number, trun_number and sample_number take 1 to 4 bytes each.
+	numbers := int((sizes>>4)&3+1) + int((sizes>>2)&3+1) + int(sizes&3+1)
+	n := int(binary.BigEndian.Uint32(body[12:16]))
+	entry := 2*width + numbers
+	if n < 0 || (len(body)-16)/entry < n {
+		return errors.New("truncated tfra box")
+	}
+	for i := 0; i < n; i++ {
+		off := body[16+i*entry+width : 16+i*entry+2*width]
+		if width == 8 {
+			if v := int64(binary.BigEndian.Uint64(off)); v >= threshold {
+				binary.BigEndian.PutUint64(off, uint64(v+delta))
+			}
+			continue
+		}
+		v := int64(binary.BigEndian.Uint32(off))
+		if v >= threshold {
+			if v+delta > math.MaxUint32 {
+				return errors.New("fragment offset overflows tfra")
+			}
+			binary.BigEndian.PutUint32(off, uint32(v+delta))
+		}
+	}
+	return nil
+}
+
+// shiftChunkOffsets adds delta to every stco/co64 entry at or after threshold. It walks the
+// trak/mdia/minf/stbl containers of a moov payload in place.
+func shiftChunkOffsets(payload []byte, threshold, delta int64) error {
+	boxes, err := ReadBoxes(payload)
+	if err != nil {
+		return err
+	}
+	for _, b := range boxes {
+		body := payload[b.PayloadOffset() : b.Offset+b.Size]
+		switch b.Type {
+		case "trak", "mdia", "minf", "stbl":
+			if err := shiftChunkOffsets(body, threshold, delta); err != nil {
+				return err
+			}
+		case "stco", "co64":
+			width := 4
+			if b.Type == "co64" {
+				width = 8
+			}
+			if len(body) < 8 {
+				return fmt.Errorf("truncated %s box", b.Type)
+			}
+			n := int(binary.BigEndian.Uint32(body[4:8]))
+			if len(body) < 8+n*width {
+				return fmt.Errorf("truncated %s box", b.Type)
+			}
+			for i := 0; i < n; i++ {
+				entry := body[8+i*width : 8+(i+1)*width]
+				if width == 8 {
+					v := int64(binary.BigEndian.Uint64(entry))
+					if v >= threshold {
+						binary.BigEndian.PutUint64(entry, uint64(v+delta))
+					}
+					continue
+				}
+				v := int64(binary.BigEndian.Uint32(entry))
+				if v >= threshold {
+					if v+delta > math.MaxUint32 {
+						return errors.New("chunk offset overflows stco")
+					}
+					binary.BigEndian.PutUint32(entry, uint32(v+delta))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// userData builds udta/meta/ilst with ©nam and ©ART items.
+func userData(tags Tags) []byte {
+	var items []byte
+	if tags.Title != "" {
+		items = append(items, textItem("\xa9nam", tags.Title)...)
+	}
+	if tags.Artist != "" {
+		items = append(items, textItem("\xa9ART", tags.Artist)...)
+	}
+	fullBox := make([]byte, 4) // version and flags
+	hdlr := box("hdlr", fullBox, make([]byte, 4), []byte("mdirappl"), make([]byte, 8), []byte{0})
+	return box("udta", box("meta", fullBox, hdlr, box("ilst", items)))
+}
+
+func textItem(typ, value string) []byte {
+	// Type indicator 1 is UTF-8 text; the locale is left at 0.
+	return box(typ, box("data", []byte{0, 0, 0, 1}, make([]byte, 4), []byte(value)))
+}
+
+// ReadTags returns the ©nam and ©ART values of an MP4 file written by WithTags or another
+// iTunes-compatible tagger.
+func ReadTags(data []byte) (Tags, error) {
+	var tags Tags
+	path := []string{"moov", "udta", "meta", "ilst"}
+	body := data
+	for _, typ := range path {
+		boxes, err := ReadBoxes(body)
+		if err != nil {
+			return tags, err
+		}
+		b, ok := find(boxes, typ)
+		if !ok {
+			return tags, nil
+		}
+		body = body[b.PayloadOffset() : b.Offset+b.Size]
+		if typ == "meta" {
+			if len(body) < 4 {
+				return tags, errors.New("truncated meta box")
+			}
+			body = body[4:]
+		}
+	}
+
+	items, err := ReadBoxes(body)
+	if err != nil {
+		return tags, err
+	}
+	for _, it := range items {
+		inner, err := ReadBoxes(body[it.PayloadOffset() : it.Offset+it.Size])
+		if err != nil {
+			return tags, err
+		}
+		d, ok := find(inner, "data")
+		if !ok || d.Size < d.HeaderSize+8 {
+			continue
+		}
+		start := it.PayloadOffset() + d.PayloadOffset() + 8
+		value := string(body[start : it.PayloadOffset()+d.Offset+d.Size])
+		switch it.Type {
+		case "\xa9nam":
+			tags.Title = value
+		case "\xa9ART":
+			tags.Artist = value
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,141 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testFile builds ftyp + moov(trak/mdia/minf/stbl/stco) + mdat with the single chunk
+// offset pointing at the mdat payload.
+func testFile(t *testing.T) []byte {
+	t.Helper()
+
+	ftyp := box("ftyp", []byte("M4A \x00\x00\x00\x00"))
+	stco := func(off uint32) []byte {
+		body := make([]byte, 12)
+		binary.BigEndian.PutUint32(body[4:8], 1)
+		binary.BigEndian.PutUint32(body[8:12], off)
+		return box("stco", body)
+	}
+	moovLen := len(box("moov", box("trak", box("mdia", box("minf", box("stbl", stco(0)))))))
+	off := uint32(len(ftyp) + moovLen + 8)
+	moov := box("moov", box("trak", box("mdia", box("minf", box("stbl", stco(off))))))
+	return bytes.Join([][]byte{ftyp, moov, box("mdat", []byte("AUDIO"))}, nil)
+}
+
+func chunkOffset(t *testing.T, data []byte) uint32 {
+	t.Helper()
+
+	body := data
+	for _, typ := range []string{"moov", "trak", "mdia", "minf", "stbl", "stco"} {
+		boxes, err := ReadBoxes(body)
+		if err != nil {
+			t.Fatalf("ReadBoxes(%s): %v", typ, err)
+		}
+		b, ok := find(boxes, typ)
+		if !ok {
+			t.Fatalf("missing %s", typ)
+		}
+		body = body[b.PayloadOffset() : b.Offset+b.Size]
+	}
+	return binary.BigEndian.Uint32(body[8:12])
+}
+
+func TestWithTagsWritesIlstAndShiftsChunkOffsets(t *testing.T) {
+	t.Parallel()
+
+	in := testFile(t)
+	if got := string(in[chunkOffset(t, in):][:5]); got != "AUDIO" {
+		t.Fatalf("test file chunk offset points at %q", got)
+	}
+
+	out, err := WithTags(in, Tags{Title: "Song", Artist: "Band"})
+	if err != nil {
+		t.Fatalf("WithTags: %v", err)
+	}
+	if got := string(out[chunkOffset(t, out):][:5]); got != "AUDIO" {
+		t.Fatalf("chunk offset was not shifted, points at %q", got)
+	}
+
+	tags, err := ReadTags(out)
+	if err != nil {
+		t.Fatalf("ReadTags: %v", err)
+	}
+	if tags.Title != "Song" || tags.Artist != "Band" {
+		t.Fatalf("unexpected tags: %+v", tags)
+	}
+
+	// Tagging again replaces the previous udta instead of adding a second one.
+	again, err := WithTags(out, Tags{Title: "Other"})
+	if err != nil {
+		t.Fatalf("WithTags: %v", err)
+	}
+	if tags, _ := ReadTags(again); tags.Title != "Other" || tags.Artist != "" {
+		t.Fatalf("unexpected retagged values: %+v", tags)
+	}
+}
+
+func TestReadBoxesRejectsTruncatedData(t *testing.T) {
+	t.Parallel()
+
+	data := testFile(t)
+	if _, err := ReadBoxes(data[:len(data)-2]); err == nil {
+		t.Fatal("expected error for truncated mdat")
+	}
+	if _, err := WithTags(box("mdat", nil), Tags{Title: "x"}); err == nil {
+		t.Fatal("expected error without moov")
+	}
+}
+
+func TestWithTagsShiftsFragmentBaseOffsets(t *testing.T) {
+	t.Parallel()
+
+	// ftyp + moov + moof(traf/tfhd with an absolute base data offset) + mdat +
+	// mfra(tfra pointing at the moof).
+	ftyp := box("ftyp", []byte("M4A \x00\x00\x00\x00"))
+	moov := box("moov", box("mvex"))
+	tfhd := func(base uint64) []byte {
+		body := make([]byte, 16)
+		binary.BigEndian.PutUint32(body[0:4], 1)
+		binary.BigEndian.PutUint32(body[4:8], 1)
+		binary.BigEndian.PutUint64(body[8:16], base)
+		return box("tfhd", body)
+	}
+	tfra := func(moofOffset uint32) []byte {
+		body := make([]byte, 16+11)
+		binary.BigEndian.PutUint32(body[4:8], 1)
+		binary.BigEndian.PutUint32(body[12:16], 1)
+		binary.BigEndian.PutUint32(body[20:24], moofOffset)
+		return box("tfra", body)
+	}
+	moofAt := len(ftyp) + len(moov)
+	moofLen := len(box("moof", box("traf", tfhd(0))))
+	base := uint64(moofAt + moofLen + 8)
+	in := bytes.Join([][]byte{
+		ftyp, moov,
+		box("moof", box("traf", tfhd(base))),
+		box("mdat", []byte("AUDIO")),
+		box("mfra", tfra(uint32(moofAt))),
+	}, nil)
+
+	out, err := WithTags(in, Tags{Title: "Song"})
+	if err != nil {
+		t.Fatalf("WithTags: %v", err)
+	}
+	top, err := ReadBoxes(out)
+	if err != nil {
+		t.Fatalf("ReadBoxes: %v", err)
+	}
+	moof, _ := find(top, "moof")
+	mfra, _ := find(top, "mfra")
+	// moof(8) traf(8) tfhd(8) version/flags(4) track_ID(4)
+	gotBase := binary.BigEndian.Uint64(out[moof.Offset+32:])
+	if got := string(out[gotBase:][:5]); got != "AUDIO" {
+		t.Fatalf("base data offset was not shifted, points at %q", got)
+	}
+	// mfra(8) tfra(8) version/flags(4) track_ID(4) sizes(4) count(4) time(4)
+	if got := int64(binary.BigEndian.Uint32(out[mfra.Offset+36:])); got != moof.Offset {
+		t.Fatalf("tfra moof offset = %d, want %d", got, moof.Offset)
+	}
+}
@@ -0,0 +1,292 @@
+// Package notify sends the results of download runs to webhooks, chat services and email.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Trigger selects the runs a sink is notified of.
+type Trigger string
+
+const (
+	// Completion fires for every run.
+	Completion Trigger = "completion"
+	// Failure fires when a target failed or some of its files could not be saved.
+	Failure Trigger = "failure"
+	// NewContent fires when new files were saved.
+	NewContent Trigger = "new_content"
+)
+
+// Sink types.
+const (
+	TypeWebhook = "webhook"
+	TypeSlack   = "slack"
+	TypeDiscord = "discord"
+	TypeEmail   = "email"
+)
+
+// sendTimeout bounds each notification.
+const sendTimeout = 30 * time.Second
+
+// Config is the notification config file.
+type Config struct {
+	Sinks []Sink `json:"sinks"`
+}
+
+// Sink is one destination of notifications.
+type Sink struct {
+	// Type is webhook (the JSON Payload), slack, discord or email.
+	Type string `json:"type"`
+	// On lists the triggers of the sink; the default is failure only.
+	On []Trigger `json:"on,omitempty"`
+	// URL is the endpoint of webhook, slack and discord sinks.
+	URL string `json:"url,omitempty"`
+
+	// SMTP is the host:port of the mail server of email sinks. Username and Password are
+	// optional; they are only sent over TLS (or to localhost).
+	SMTP     string   `json:"smtp,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+// Load reads and validates a config file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read notification config: %v", err)
+	}
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid notification config %s: %v", path, err)
+	}
+	if len(cfg.Sinks) == 0 {
+		return nil, fmt.Errorf("invalid notification config %s: no sinks", path)
+	}
+	for i := range cfg.Sinks {
+		if err := cfg.Sinks[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid notification config %s: sink %d: %v", path, i+1, err)
+		}
+	}
+	return &cfg, nil
+}
+
+func (s *Sink) validate() error {
+	if len(s.On) == 0 {
+		s.On = []Trigger{Failure}
+	}
+	for _, t := range s.On {
+		if t != Completion && t != Failure && t != NewContent {
+			return fmt.Errorf("invalid trigger %q (expected completion, failure or new_content)", t)
+		}
+	}
+	switch s.Type {
+	case TypeWebhook, TypeSlack, TypeDiscord:
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid url %q", s.URL)
+		}
+	case TypeEmail:
+		if !strings.Contains(s.SMTP, ":") {
+			return fmt.Errorf("invalid smtp %q (expected host:port)", s.SMTP)
+		}
+		if s.From == "" || len(s.To) == 0 {
+			return errors.New("email needs from and to")
+		}
+	default:
+		return fmt.Errorf("invalid type %q (expected webhook, slack, discord or email)", s.Type)
+	}
+	return nil
+}
+
+// Report is the result of a run, or of a watch cycle over several targets.
+type Report struct {
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Targets    []TargetResult `json:"targets"`
+}
+
+// TargetResult is the result of downloading one target.
+type TargetResult struct {
+	Target  string        `json:"target"`
+	Saved   int           `json:"saved"`
+	Failed  int           `json:"failed"`
+	Skipped int           `json:"skipped"`
+	Error   string        `json:"error,omitempty"`
+	Stages  []StageResult `json:"stages,omitempty"`
+}
+
+// StageResult is the result of one stage of a target.
+type StageResult struct {
+	Stage   string `json:"stage"`
+	Saved   int    `json:"saved"`
+	Failed  int    `json:"failed"`
+	Skipped int    `json:"skipped"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (t TargetResult) failed() bool {
+	return t.Error != "" || t.Failed > 0
+}
+
+// Failed reports whether a target failed or some of its files could not be saved.
+func (r Report) Failed() bool {
+	return slices.ContainsFunc(r.Targets, TargetResult.failed)
+}
+
+// NewContent reports whether new files were saved.
+func (r Report) NewContent() bool {
+	return slices.ContainsFunc(r.Targets, func(t TargetResult) bool { return t.Saved > 0 })
+}
+
+// Summary returns a one-line description of the report.
+func (r Report) Summary() string {
+	var failed, names []string
+	saved := 0
+	for _, t := range r.Targets {
+		names = append(names, t.Target)
+		saved += t.Saved
+		if t.failed() {
+			failed = append(failed, t.Target)
+		}
+	}
+	switch {
+	case len(failed) > 0:
+		return fmt.Sprintf("idl: %s failed", strings.Join(failed, ", "))
+	case saved > 0:
+		return fmt.Sprintf("idl: %d new %s from %s", saved, plural(saved, "file"), strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("idl: %s finished, nothing new", strings.Join(names, ", "))
+}
+
+// Text returns the summary followed by one line per target and its errors.
+func (r Report) Text() string {
+	var b strings.Builder
+	b.WriteString(r.Summary())
+	b.WriteString("\n")
+	for _, t := range r.Targets {
+		fmt.Fprintf(&b, "\n%s: %d new, %d failed, %d skipped", t.Target, t.Saved, t.Failed, t.Skipped)
+		if t.Error != "" {
+			fmt.Fprintf(&b, "\n  error: %s", t.Error)
+		}
+		for _, s := range t.Stages {
+			if s.Error != "" && s.Error != t.Error {
+				fmt.Fprintf(&b, "\n  %s: %s", s.Stage, s.Error)
+			}
+		}
+	}
+	if !r.FinishedAt.IsZero() {
+		fmt.Fprintf(&b, "\n\nFinished at %s (took %s).\n", r.FinishedAt.Format(time.RFC1123Z), r.FinishedAt.Sub(r.StartedAt).Round(time.Second))
+	}
+	return b.String()
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+// Payload is the body of webhook sinks.
+type Payload struct {
+	// Event is the trigger that fired: failure, new_content or completion.
+	Event   Trigger `json:"event"`
+	Summary string  `json:"summary"`
+	Report
+}
+
+// Notifier sends reports to the sinks of a Config.
+type Notifier struct {
+	sinks  []Sink
+	client *http.Client
+}
+
+// New returns a Notifier for cfg.
+func New(cfg *Config) *Notifier {
+	return &Notifier{sinks: cfg.Sinks, client: &http.Client{Timeout: sendTimeout}}
+}
+
+// Notify sends r to every sink whose triggers match. It returns the errors of the sinks
+// that failed.
+func (n *Notifier) Notify(ctx context.Context, r Report) error {
+	var errs []error
+	for _, s := range n.sinks {
+		event, ok := trigger(s.On, r)
+		if !ok {
+			continue
+		}
+		if err := n.send(ctx, s, event, r); err != nil {
+			errs = append(errs, fmt.Errorf("%s notification failed: %v", s.Type, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// trigger returns the most specific of the triggers that fire for r.
+func trigger(on []Trigger, r Report) (Trigger, bool) {
+	switch {
+	case slices.Contains(on, Failure) && r.Failed():
+		return Failure, true
+	case slices.Contains(on, NewContent) && r.NewContent():
+		return NewContent, true
+	case slices.Contains(on, Completion):
+		return Completion, true
+	}
+	return "", false
+}
+
+func (n *Notifier) send(ctx context.Context, s Sink, event Trigger, r Report) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	switch s.Type {
+	case TypeSlack:
+		return n.post(ctx, s.URL, map[string]string{"text": r.Text()})
+	case TypeDiscord:
+		// Discord rejects messages longer than 2000 characters.
+		text := []rune(r.Text())
+		if len(text) > 2000 {
+			text = append(text[:1999], '…')
+		}
+		return n.post(ctx, s.URL, map[string]string{"content": string(text)})
+	case TypeEmail:
+		return sendMail(ctx, s, r)
+	}
+	return n.post(ctx, s.URL, Payload{Event: event, Summary: r.Summary(), Report: r})
+}
+
+func (n *Notifier) post(ctx context.Context, url string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, cfg string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.json")
+	if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func testReport(saved int, err string) Report {
+	start := time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC)
+	return Report{
+		StartedAt:  start,
+		FinishedAt: start.Add(90 * time.Second),
+		Targets: []TargetResult{
+			{Target: "nasa", Saved: saved, Skipped: 3},
+			{Target: "esa", Error: err, Stages: []StageResult{{Stage: "posts", Error: err}}},
+		},
+	}
+}
+
+func TestLoadValidates(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := Load(writeConfig(t, `{"sinks": [{"type": "slack", "url": "https://hooks.example.com/x"}]}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if on := cfg.Sinks[0].On; len(on) != 1 || on[0] != Failure {
+		t.Fatalf("default triggers: %v", on)
+	}
+
+	for _, bad := range []string{
+		`{"sinks": []}`,
+		`{"sinks": [{"type": "pager", "url": "https://x"}]}`,
+		`{"sinks": [{"type": "webhook", "url": "ftp://x"}]}`,
+		`{"sinks": [{"type": "webhook", "url": "https://x", "on": ["sometimes"]}]}`,
+		`{"sinks": [{"type": "email", "smtp": "mail.example.com", "from": "a@x", "to": ["b@x"]}]}`,
+		`{"sinks": [{"type": "email", "smtp": "mail.example.com:25", "from": "a@x"}]}`,
+		`{"sinks": [{"type": "webhook", "url": "https://x", "secret": "y"}]}`,
+	} {
+		if _, err := Load(writeConfig(t, bad)); err == nil {
+			t.Fatalf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestReportSummary(t *testing.T) {
+	t.Parallel()
+
+	if got := testReport(2, "").Summary(); got != "idl: 2 new files from nasa, esa" {
+		t.Fatalf("Summary = %q", got)
+	}
+	if got := testReport(0, "").Summary(); got != "idl: nasa, esa finished, nothing new" {
+		t.Fatalf("Summary = %q", got)
+	}
+	r := testReport(2, "cookies expired")
+	if got := r.Summary(); got != "idl: esa failed" {
+		t.Fatalf("Summary = %q", got)
+	}
+	if text := r.Text(); !strings.Contains(text, "nasa: 2 new, 0 failed, 3 skipped") || !strings.Contains(text, "error: cookies expired") {
+		t.Fatalf("unexpected text:\n%s", text)
+	}
+}
+
+func TestNotifyWebhooks(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	bodies := map[string][]map[string]any{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		mu.Lock()
+		bodies[r.URL.Path] = append(bodies[r.URL.Path], v)
+		mu.Unlock()
+	}))
+	t.Cleanup(ts.Close)
+
+	cfg, err := Load(writeConfig(t, `{"sinks": [
+		{"type": "webhook", "url": "`+ts.URL+`/hook", "on": ["completion", "failure"]},
+		{"type": "slack", "url": "`+ts.URL+`/slack", "on": ["new_content"]},
+		{"type": "discord", "url": "`+ts.URL+`/discord"}
+	]}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	n := New(cfg)
+	if err := n.Notify(context.Background(), testReport(0, "")); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if err := n.Notify(context.Background(), testReport(4, "cookies expired")); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	hooks := bodies["/hook"]
+	if len(hooks) != 2 || hooks[0]["event"] != "completion" || hooks[1]["event"] != "failure" {
+		t.Fatalf("unexpected webhook bodies: %v", hooks)
+	}
+	targets, _ := hooks[1]["targets"].([]any)
+	if len(targets) != 2 || targets[1].(map[string]any)["error"] != "cookies expired" {
+		t.Fatalf("unexpected webhook targets: %v", hooks[1]["targets"])
+	}
+	if slack := bodies["/slack"]; len(slack) != 1 || !strings.HasPrefix(slack[0]["text"].(string), "idl: esa failed") {
+		t.Fatalf("unexpected slack bodies: %v", slack)
+	}
+	if discord := bodies["/discord"]; len(discord) != 1 || !strings.Contains(discord[0]["content"].(string), "cookies expired") {
+		t.Fatalf("unexpected discord bodies: %v", discord)
+	}
+}
+
+// fakeSMTP accepts one message and returns its envelope and data.
+func fakeSMTP(t *testing.T) (addr string, got chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	got = make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		var lines []string
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "DATA":
+				reply("354 go ahead")
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l = strings.TrimRight(l, "\r\n"); l == "." {
+						break
+					}
+					lines = append(lines, l)
+				}
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				got <- lines
+				return
+			default:
+				lines = append(lines, line)
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), got
+}
+
+func TestNotifyEmail(t *testing.T) {
+	t.Parallel()
+	addr, got := fakeSMTP(t)
+
+	cfg, err := Load(writeConfig(t, `{"sinks": [
+		{"type": "email", "smtp": "`+addr+`", "from": "idl@example.com", "to": ["ops@example.com"], "on": ["failure"]}
+	]}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	n := New(cfg)
+	// No failure: nothing is sent.
+	if err := n.Notify(context.Background(), testReport(1, "")); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if err := n.Notify(context.Background(), testReport(1, "cookies expired")); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var lines []string
+	select {
+	case lines = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	msg := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<idl@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"Subject: idl: esa failed",
+		"error: cookies expired",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("message lacks %q:\n%s", want, msg)
+		}
+	}
+}
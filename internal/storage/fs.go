@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// tmpSuffix marks files that are still being written. They are never listed.
+const tmpSuffix = ".tmp"
+
+// FS stores files in a local directory. A file is written to <path>.tmp and renamed into
+// place on Commit, so readers never observe a partially written file.
+type FS struct {
+	root string
+}
+
+// NewFS returns a Storage rooted at dir. The directory is created on the first write.
+func NewFS(dir string) *FS {
+	return &FS{root: dir}
+}
+
+// Root returns the directory passed to NewFS.
+func (s *FS) Root() string {
+	return s.root
+}
+
+func (s *FS) path(key string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *FS) Location(key string) string {
+	p, err := s.path(key)
+	if err != nil {
+		return filepath.Join(s.root, filepath.FromSlash(key))
+	}
+	return p
+}
+
+func (s *FS) Create(ctx context.Context, key string) (Writer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+	tmp := p + tmpSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	return &fsWriter{f: f, tmp: tmp, path: p}, nil
+}
+
+func (s *FS) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (s *FS) Stat(ctx context.Context, key string) (FileInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	st, err := os.Stat(p)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if st.IsDir() {
+		return FileInfo{}, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+	}
+	key, _ = CleanKey(key)
+	return FileInfo{Key: key, Size: st.Size(), ModTime: st.ModTime()}, nil
+}
+
+func (s *FS) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.Stat(ctx, key)
+	if IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *FS) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	prefix = strings.ReplaceAll(prefix, "\\", "/")
+	// Walk the deepest directory that contains every match.
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i]
+	}
+	start := s.root
+	if dir != "" {
+		p, err := s.path(dir)
+		if err != nil {
+			return nil, err
+		}
+		start = p
+	}
+
+	var out []FileInfo
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == start && os.IsNotExist(err) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), tmpSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, FileInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+func (s *FS) Remove(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+type fsWriter struct {
+	f    *os.File
+	tmp  string
+	path string
+	done bool
+}
+
+func (w *fsWriter) Write(p []byte) (int, error) {
+	return w.f.Write(p)
+}
+
+func (w *fsWriter) Commit() error {
+	if w.done {
+		return fs.ErrClosed
+	}
+	w.done = true
+	if err := w.f.Close(); err != nil {
+		_ = os.Remove(w.tmp)
+		return err
+	}
+	if err := os.Rename(w.tmp, w.path); err != nil {
+		// On Windows, Rename fails if the destination exists.
+		_ = os.Remove(w.path)
+		if err := os.Rename(w.tmp, w.path); err != nil {
+			_ = os.Remove(w.tmp)
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *fsWriter) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	_ = w.f.Close()
+	if err := os.Remove(w.tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
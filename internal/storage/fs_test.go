@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFSCommitIsAtomic(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := NewFS(dir)
+	if err := WriteFile(ctx, s, "user/posts/a.jpg", []byte("old")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	w, err := s.Create(ctx, "user/posts/a.jpg")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := w.Write([]byte("new")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if data, _ := ReadFile(ctx, s, "user/posts/a.jpg"); string(data) != "old" {
+		t.Fatalf("uncommitted data is visible: %q", data)
+	}
+	if err := w.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if data, _ := ReadFile(ctx, s, "user/posts/a.jpg"); string(data) != "new" {
+		t.Fatalf("unexpected content after commit: %q", data)
+	}
+
+	w, err = s.Create(ctx, "user/posts/b.jpg")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	_, _ = w.Write([]byte("partial"))
+	if err := w.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	if ok, err := s.Exists(ctx, "user/posts/b.jpg"); ok || err != nil {
+		t.Fatalf("aborted file exists: ok=%v err=%v", ok, err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "user", "posts"))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("temporary files remain: %v", entries)
+	}
+}
+
+func TestFSStatAndList(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewFS(t.TempDir())
+	for _, key := range []string{"user/posts/a.jpg", "user/posts/b.mp4", "user/reels/c.mp4", "other/posts/d.jpg"} {
+		if err := WriteFile(ctx, s, key, []byte(key)); err != nil {
+			t.Fatalf("WriteFile(%s): %v", key, err)
+		}
+	}
+
+	info, err := s.Stat(ctx, "user/posts/b.mp4")
+	if err != nil || info.Key != "user/posts/b.mp4" || info.Size != int64(len("user/posts/b.mp4")) {
+		t.Fatalf("unexpected Stat: %+v err=%v", info, err)
+	}
+	if _, err := s.Stat(ctx, "user/posts/missing.jpg"); !IsNotExist(err) {
+		t.Fatalf("expected a not-exist error, got %v", err)
+	}
+	if _, err := s.Stat(ctx, "user/posts"); !IsNotExist(err) {
+		t.Fatalf("directories should not be files, got %v", err)
+	}
+
+	list, err := s.List(ctx, "user/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	got := []string{}
+	for _, f := range list {
+		got = append(got, f.Key)
+	}
+	want := []string{"user/posts/a.jpg", "user/posts/b.mp4", "user/reels/c.mp4"}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected List: %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected List: %v", got)
+		}
+	}
+
+	if list, err := s.List(ctx, "user/posts/b"); err != nil || len(list) != 1 {
+		t.Fatalf("unexpected List by name prefix: %v err=%v", list, err)
+	}
+	if list, err := s.List(ctx, "nobody/"); err != nil || len(list) != 0 {
+		t.Fatalf("unexpected List of a missing directory: %v err=%v", list, err)
+	}
+}
+
+func TestCleanKeyRejectsEscapes(t *testing.T) {
+	t.Parallel()
+
+	for _, key := range []string{"", "/etc/passwd", "..", "../x", "user/../../x"} {
+		if _, err := CleanKey(key); err == nil {
+			t.Fatalf("CleanKey(%q) should fail", key)
+		}
+	}
+	if got, err := CleanKey(`user\posts\./a.jpg`); err != nil || got != "user/posts/a.jpg" {
+		t.Fatalf("unexpected CleanKey: %q err=%v", got, err)
+	}
+}
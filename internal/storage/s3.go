@@ -0,0 +1,527 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPartSize is the size of multipart upload parts. S3 requires at least 5 MiB for
+// every part but the last.
+const DefaultPartSize = 8 << 20
+
+// S3Options configures an S3-compatible bucket.
+type S3Options struct {
+	Bucket string
+	// Prefix is prepended to every key, e.g. "archive" stores "user/a.jpg" as
+	// "archive/user/a.jpg".
+	Prefix string
+	// Endpoint is the base URL of an S3-compatible service such as http://localhost:9000.
+	// When empty, AWS S3 in Region is used.
+	Endpoint string
+	Region   string
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// PathStyle addresses the bucket as <endpoint>/<bucket>/<key> instead of
+	// <bucket>.<host>/<key>. Most self-hosted services (MinIO) need it.
+	PathStyle bool
+	// PartSize is the multipart upload part size (DefaultPartSize when 0). Files smaller than
+	// one part are uploaded with a single request.
+	PartSize int
+	Client   *http.Client
+}
+
+// S3 stores files as objects in an S3-compatible bucket. Files are streamed with multipart
+// uploads, and an object only becomes visible when its upload is completed, so Commit is
+// atomic.
+type S3 struct {
+	bucket   string
+	prefix   string
+	base     *url.URL
+	path     bool
+	partSize int
+	client   *http.Client
+	creds    credentials
+	now      func() time.Time
+}
+
+// ParseS3URL splits an s3://bucket/prefix location. ok is false for other locations.
+func ParseS3URL(location string) (bucket, prefix string, ok bool) {
+	rest, found := strings.CutPrefix(location, "s3://")
+	if !found {
+		return "", "", false
+	}
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	return bucket, strings.Trim(prefix, "/"), true
+}
+
+// S3OptionsFromEnv returns the options for a bucket using the standard AWS environment
+// variables: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION (or
+// AWS_DEFAULT_REGION) and AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL) for S3-compatible services.
+func S3OptionsFromEnv(bucket, prefix string) S3Options {
+	opts := S3Options{
+		Bucket:       bucket,
+		Prefix:       prefix,
+		Endpoint:     firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		Region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	opts.PathStyle = opts.Endpoint != ""
+	return opts
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// NewS3 returns a Storage for the bucket described by opts.
+func NewS3(opts S3Options) (*S3, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("missing bucket name")
+	}
+	if opts.AccessKey == "" || opts.SecretKey == "" {
+		return nil, errors.New("missing credentials (set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://s3." + opts.Region + ".amazonaws.com"
+	}
+	base, err := url.Parse(strings.TrimRight(opts.Endpoint, "/"))
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("invalid endpoint %q", opts.Endpoint)
+	}
+	if !opts.PathStyle {
+		base.Host = opts.Bucket + "." + base.Host
+	}
+	if opts.PartSize <= 0 {
+		opts.PartSize = DefaultPartSize
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{}
+	}
+	return &S3{
+		bucket:   opts.Bucket,
+		prefix:   strings.Trim(opts.Prefix, "/"),
+		base:     base,
+		path:     opts.PathStyle,
+		partSize: opts.PartSize,
+		client:   opts.Client,
+		creds: credentials{
+			accessKey:    opts.AccessKey,
+			secretKey:    opts.SecretKey,
+			sessionToken: opts.SessionToken,
+			region:       opts.Region,
+			service:      "s3",
+		},
+		now: time.Now,
+	}, nil
+}
+
+// objectKey maps a storage key to the key of the object in the bucket.
+func (s *S3) objectKey(key string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	if s.prefix == "" {
+		return key, nil
+	}
+	return s.prefix + "/" + key, nil
+}
+
+func (s *S3) Location(key string) string {
+	obj, err := s.objectKey(key)
+	if err != nil {
+		obj = key
+	}
+	return "s3://" + s.bucket + "/" + obj
+}
+
+// request sends a signed request for an object (or the bucket when obj is "") and returns
+// the response when its status is 2xx.
+func (s *S3) request(ctx context.Context, method, obj string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u := *s.base
+	p := u.Path
+	if s.path {
+		p += "/" + s.bucket
+	}
+	if obj != "" {
+		p += "/" + obj
+	} else if !s.path {
+		p += "/"
+	}
+	u.Path = p
+	u.RawPath = canonicalURI(&url.URL{Path: p})
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payloadHash := emptySHA256
+	if len(body) > 0 {
+		payloadHash = hexSHA256(body)
+	}
+	s.creds.sign(req, payloadHash, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, s.responseError(method, obj, resp)
+}
+
+// s3Error is the XML error document returned by S3.
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func (s *S3) responseError(method, obj string, resp *http.Response) error {
+	target := s.Location("")
+	if obj != "" {
+		target = "s3://" + s.bucket + "/" + obj
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return &fs.PathError{Op: strings.ToLower(method), Path: target, Err: fs.ErrNotExist}
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e s3Error
+	if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		return fmt.Errorf("%s %s: %s: %s", method, target, e.Code, e.Message)
+	}
+	return fmt.Errorf("%s %s: unexpected status: %s", method, target, resp.Status)
+}
+
+func (s *S3) Create(ctx context.Context, key string) (Writer, error) {
+	obj, err := s.objectKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Writer{ctx: ctx, s: s, obj: obj}, nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.objectKey(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.request(ctx, http.MethodGet, obj, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat uses a HEAD request, so checking for existing files does not transfer them.
+func (s *S3) Stat(ctx context.Context, key string) (FileInfo, error) {
+	obj, err := s.objectKey(key)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	resp, err := s.request(ctx, http.MethodHead, obj, nil, nil, nil)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	resp.Body.Close()
+	key, _ = CleanKey(key)
+	info := FileInfo{Key: key, Size: resp.ContentLength}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return info, nil
+}
+
+func (s *S3) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.Stat(ctx, key)
+	if IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type listResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	full := strings.ReplaceAll(prefix, "\\", "/")
+	if s.prefix != "" {
+		full = s.prefix + "/" + full
+	}
+
+	var out []FileInfo
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {full}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := s.request(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid list response: %v", err)
+		}
+		for _, c := range page.Contents {
+			key := c.Key
+			if s.prefix != "" {
+				key = strings.TrimPrefix(key, s.prefix+"/")
+			}
+			out = append(out, FileInfo{Key: key, Size: c.Size, ModTime: c.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+func (s *S3) Remove(ctx context.Context, key string) error {
+	obj, err := s.objectKey(key)
+	if err != nil {
+		return err
+	}
+	resp, err := s.request(ctx, http.MethodDelete, obj, nil, nil, nil)
+	if IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Tags    []tag    `xml:"TagSet>Tag"`
+}
+
+type tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// SetTags replaces the object tags of key.
+func (s *S3) SetTags(ctx context.Context, key string, tags map[string]string) error {
+	obj, err := s.objectKey(key)
+	if err != nil {
+		return err
+	}
+	var t tagging
+	for k, v := range tags {
+		t.Tags = append(t.Tags, tag{Key: k, Value: v})
+	}
+	sort.Slice(t.Tags, func(i, j int) bool { return t.Tags[i].Key < t.Tags[j].Key })
+	body, err := xml.Marshal(t)
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(body)
+	header := http.Header{
+		"Content-Type": {"application/xml"},
+		"Content-Md5":  {base64.StdEncoding.EncodeToString(sum[:])},
+	}
+	resp, err := s.request(ctx, http.MethodPut, obj, url.Values{"tagging": {""}}, body, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3Writer buffers one part at a time. Files that fit in a single part are uploaded with
+// PutObject on Commit; larger files use a multipart upload started with the first full part.
+type s3Writer struct {
+	ctx      context.Context
+	s        *S3
+	obj      string
+	buf      bytes.Buffer
+	uploadID string
+	etags    []string
+	err      error
+	done     bool
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.done {
+		return 0, fs.ErrClosed
+	}
+	w.buf.Write(p)
+	for w.buf.Len() >= w.s.partSize {
+		if err := w.uploadPart(w.buf.Next(w.s.partSize)); err != nil {
+			w.err = err
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+type initiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+func (w *s3Writer) uploadPart(part []byte) error {
+	if w.uploadID == "" {
+		resp, err := w.s.request(w.ctx, http.MethodPost, w.obj, url.Values{"uploads": {""}}, nil, nil)
+		if err != nil {
+			return err
+		}
+		var res initiateResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil || res.UploadID == "" {
+			return fmt.Errorf("invalid multipart upload response: %v", err)
+		}
+		w.uploadID = res.UploadID
+	}
+
+	q := url.Values{
+		"partNumber": {strconv.Itoa(len(w.etags) + 1)},
+		"uploadId":   {w.uploadID},
+	}
+	resp, err := w.s.request(w.ctx, http.MethodPut, w.obj, q, part, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	w.etags = append(w.etags, resp.Header.Get("ETag"))
+	return nil
+}
+
+type completeUpload struct {
+	XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+	Parts   []completePart `xml:"Part"`
+}
+
+type completePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (w *s3Writer) Commit() error {
+	if w.done {
+		return fs.ErrClosed
+	}
+	if w.err != nil {
+		_ = w.Abort()
+		return w.err
+	}
+	w.done = true
+
+	if w.uploadID == "" {
+		resp, err := w.s.request(w.ctx, http.MethodPut, w.obj, nil, w.buf.Bytes(), nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if w.buf.Len() > 0 {
+		if err := w.uploadPart(w.buf.Bytes()); err != nil {
+			w.abortUpload()
+			return err
+		}
+	}
+	var c completeUpload
+	for i, etag := range w.etags {
+		c.Parts = append(c.Parts, completePart{PartNumber: i + 1, ETag: etag})
+	}
+	body, err := xml.Marshal(c)
+	if err != nil {
+		w.abortUpload()
+		return err
+	}
+	resp, err := w.s.request(w.ctx, http.MethodPost, w.obj, url.Values{"uploadId": {w.uploadID}}, body,
+		http.Header{"Content-Type": {"application/xml"}})
+	if err != nil {
+		w.abortUpload()
+		return err
+	}
+	defer resp.Body.Close()
+	// CompleteMultipartUpload can fail after the 200 status has been sent; the error is then
+	// in the body.
+	data, _ := io.ReadAll(resp.Body)
+	var e s3Error
+	if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		w.abortUpload()
+		return fmt.Errorf("complete upload of %s: %s: %s", w.obj, e.Code, e.Message)
+	}
+	return nil
+}
+
+func (w *s3Writer) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	return w.abortUpload()
+}
+
+func (w *s3Writer) abortUpload() error {
+	if w.uploadID == "" {
+		return nil
+	}
+	// The upload must be aborted even when the download was cancelled.
+	ctx := context.WithoutCancel(w.ctx)
+	resp, err := w.s.request(ctx, http.MethodDelete, w.obj, url.Values{"uploadId": {w.uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package storage abstracts where downloaded files are kept.
+//
+// Keys are slash-separated paths relative to the output root, such as
+// "<user>/posts/20240304_050607_123.jpg".
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// Storage is an output backend. Implementations must be safe for concurrent use.
+type Storage interface {
+	// Create starts writing key. The data only becomes visible under key once Commit
+	// succeeds; until then an existing file with that key is left untouched.
+	Create(ctx context.Context, key string) (Writer, error)
+	// Open reads a committed file.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat describes a committed file. Missing files yield an error matching fs.ErrNotExist.
+	Stat(ctx context.Context, key string) (FileInfo, error)
+	// Exists reports whether key has been committed.
+	Exists(ctx context.Context, key string) (bool, error)
+	// List returns the committed files whose key starts with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]FileInfo, error)
+	// Remove deletes a file. Removing a missing file is not an error.
+	Remove(ctx context.Context, key string) error
+	// Location returns where key is stored, for display (a local path or a URL).
+	Location(key string) string
+}
+
+// Writer receives the content of a file being created. Exactly one of Commit and Abort
+// must be called.
+type Writer interface {
+	io.Writer
+	// Commit atomically publishes the written data under the key.
+	Commit() error
+	// Abort discards the written data.
+	Abort() error
+}
+
+// FileInfo describes a stored file.
+type FileInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Tagger is implemented by backends that can attach key/value tags to stored files.
+type Tagger interface {
+	SetTags(ctx context.Context, key string, tags map[string]string) error
+}
+
+// SetTags tags key when s implements Tagger and does nothing otherwise.
+func SetTags(ctx context.Context, s Storage, key string, tags map[string]string) error {
+	t, ok := s.(Tagger)
+	if !ok || len(tags) == 0 {
+		return nil
+	}
+	return t.SetTags(ctx, key, tags)
+}
+
+// AppendOnly is implemented by backends that cannot replace a file once it has been
+// written (see Tar). Callers should write such files once, when their content is final.
+type AppendOnly interface {
+	AppendOnly() bool
+}
+
+// IsAppendOnly reports whether s implements AppendOnly and returns true.
+func IsAppendOnly(s Storage) bool {
+	a, ok := s.(AppendOnly)
+	return ok && a.AppendOnly()
+}
+
+// Open returns the Storage for an output location: s3://bucket/prefix for an S3-compatible
+// bucket configured from the environment (see S3OptionsFromEnv), or a local directory.
+func Open(location string) (Storage, error) {
+	if bucket, prefix, ok := ParseS3URL(location); ok {
+		s, err := NewS3(S3OptionsFromEnv(bucket, prefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid output %s: %v", location, err)
+		}
+		return s, nil
+	}
+	return NewFS(location), nil
+}
+
+// IsRemote reports whether an output location is not a local directory.
+func IsRemote(location string) bool {
+	_, _, ok := ParseS3URL(location)
+	return ok
+}
+
+// CleanKey validates key and returns it in canonical form. Keys must be relative and must
+// not escape the output root.
+func CleanKey(key string) (string, error) {
+	key = strings.ReplaceAll(key, "\\", "/")
+	if key == "" || strings.HasPrefix(key, "/") {
+		return "", &fs.PathError{Op: "open", Path: key, Err: fs.ErrInvalid}
+	}
+	clean := path.Clean(key)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", &fs.PathError{Op: "open", Path: key, Err: fs.ErrInvalid}
+	}
+	return clean, nil
+}
+
+// WriteFile stores data under key.
+func WriteFile(ctx context.Context, s Storage, key string, data []byte) error {
+	w, err := s.Create(ctx, key)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	return w.Commit()
+}
+
+// ReadFile returns the content of key.
+func ReadFile(ctx context.Context, s Storage, key string) ([]byte, error) {
+	r, err := s.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// IsNotExist reports whether err means that a key does not exist.
+func IsNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errStreamed is returned when reading a file that has already been written to the stream.
+var errStreamed = errors.New("file already written to the archive stream")
+
+// Tar writes files into a tar stream instead of a directory tree. Each file is spooled to a
+// temporary file until it is written to the stream, so memory use does not grow with the
+// size of the files. It implements AppendOnly:
+//
+//   - A committed file is held back until another file is committed, so it can still be read
+//     or replaced (for example to add tags) without duplicating it in the stream. Earlier
+//     files can no longer be opened.
+//   - Hidden files (whose name starts with ".") are scratch files. They are kept until
+//     removed and never written to the stream.
+//
+// Close must be called to write the last file and the end-of-archive marker.
+type Tar struct {
+	name string
+	// dir holds the spooled files; "" is the default temporary directory.
+	dir string
+
+	mu      sync.Mutex
+	tw      *tar.Writer
+	gz      *gzip.Writer
+	pending *tarEntry
+	scratch map[string]*tarEntry
+	written map[string]FileInfo
+	err     error
+	closed  bool
+}
+
+type tarEntry struct {
+	key     string
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// discard removes the spooled file of e.
+func (e *tarEntry) discard() {
+	_ = os.Remove(e.path)
+}
+
+// NewTar returns a Tar writing to w, gzip-compressed when compress is set. name is used
+// by Location, for display.
+func NewTar(w io.Writer, name string, compress bool) *Tar {
+	t := &Tar{
+		name:    name,
+		scratch: map[string]*tarEntry{},
+		written: map[string]FileInfo{},
+	}
+	if compress {
+		t.gz = gzip.NewWriter(w)
+		w = t.gz
+	}
+	t.tw = tar.NewWriter(w)
+	return t
+}
+
+// AppendOnly reports that files cannot be rewritten once they are in the stream.
+func (t *Tar) AppendOnly() bool {
+	return true
+}
+
+func (t *Tar) Location(key string) string {
+	return t.name + ":" + key
+}
+
+func (t *Tar) Create(ctx context.Context, key string) (Writer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(t.dir, "idl-tar-*")
+	if err != nil {
+		return nil, err
+	}
+	return &tarWriter{t: t, key: key, f: f}, nil
+}
+
+func (t *Tar) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, err := t.entryLocked(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(e.path)
+}
+
+// entryLocked returns the readable entry for key: a scratch file or the pending file.
+func (t *Tar) entryLocked(key string) (*tarEntry, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := t.scratch[key]; ok {
+		return e, nil
+	}
+	if t.pending != nil && t.pending.key == key {
+		return t.pending, nil
+	}
+	if _, ok := t.written[key]; ok {
+		return nil, &fs.PathError{Op: "open", Path: key, Err: errStreamed}
+	}
+	return nil, &fs.PathError{Op: "open", Path: key, Err: fs.ErrNotExist}
+}
+
+func (t *Tar) Stat(ctx context.Context, key string) (FileInfo, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clean, err := CleanKey(key)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if info, ok := t.written[clean]; ok {
+		return info, nil
+	}
+	e, err := t.entryLocked(clean)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return e.info(), nil
+}
+
+func (t *Tar) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := t.Stat(ctx, key)
+	if IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// List returns the files committed so far, including those already in the stream.
+func (t *Tar) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prefix = strings.ReplaceAll(prefix, "\\", "/")
+	var out []FileInfo
+	add := func(info FileInfo) {
+		if strings.HasPrefix(info.Key, prefix) {
+			out = append(out, info)
+		}
+	}
+	for _, info := range t.written {
+		add(info)
+	}
+	for _, e := range t.scratch {
+		add(e.info())
+	}
+	if t.pending != nil {
+		add(t.pending.info())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// Remove discards a scratch file or the pending file. Files already in the stream are left
+// in it; removing them is an error.
+func (t *Tar) Remove(ctx context.Context, key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+	if e, ok := t.scratch[key]; ok {
+		e.discard()
+		delete(t.scratch, key)
+		return nil
+	}
+	if t.pending != nil && t.pending.key == key {
+		t.pending.discard()
+		t.pending = nil
+		return nil
+	}
+	if _, ok := t.written[key]; ok {
+		return &fs.PathError{Op: "remove", Path: key, Err: errStreamed}
+	}
+	return nil
+}
+
+// Close writes the pending file and finishes the stream. Scratch files are discarded. It
+// does not close the underlying writer.
+func (t *Tar) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return t.err
+	}
+	t.closed = true
+	t.flushLocked()
+	for _, e := range t.scratch {
+		e.discard()
+	}
+	t.scratch = nil
+	if t.err != nil {
+		return t.err
+	}
+	if err := t.tw.Close(); err != nil {
+		t.err = err
+		return err
+	}
+	if t.gz != nil {
+		if err := t.gz.Close(); err != nil {
+			t.err = err
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tar) commit(e *tarEntry) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		e.discard()
+		return fs.ErrClosed
+	}
+	if strings.HasPrefix(path.Base(e.key), ".") {
+		if old, ok := t.scratch[e.key]; ok {
+			old.discard()
+		}
+		t.scratch[e.key] = e
+		return t.err
+	}
+	if t.pending != nil {
+		if t.pending.key == e.key {
+			t.pending.discard()
+			t.pending = nil
+		} else {
+			t.flushLocked()
+		}
+	}
+	t.pending = e
+	return t.err
+}
+
+// flushLocked writes the pending file to the stream. After the first error the stream is
+// unusable, and every later commit reports that error.
+func (t *Tar) flushLocked() {
+	e := t.pending
+	t.pending = nil
+	if e == nil {
+		return
+	}
+	defer e.discard()
+	if t.err != nil {
+		return
+	}
+	f, err := os.Open(e.path)
+	if err != nil {
+		t.err = err
+		return
+	}
+	defer f.Close()
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     e.key,
+		Mode:     0o644,
+		Size:     e.size,
+		ModTime:  e.modTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		t.err = err
+		return
+	}
+	if _, err := io.Copy(t.tw, f); err != nil {
+		t.err = err
+		return
+	}
+	if err := t.tw.Flush(); err != nil {
+		t.err = err
+		return
+	}
+	t.written[e.key] = e.info()
+}
+
+func (e *tarEntry) info() FileInfo {
+	return FileInfo{Key: e.key, Size: e.size, ModTime: e.modTime}
+}
+
+// tarWriter spools a file to a temporary file until it is committed.
+type tarWriter struct {
+	t    *Tar
+	key  string
+	f    *os.File
+	size int64
+	done bool
+}
+
+func (w *tarWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *tarWriter) Commit() error {
+	if w.done {
+		return fs.ErrClosed
+	}
+	w.done = true
+	e := &tarEntry{key: w.key, path: w.f.Name(), size: w.size, modTime: time.Now()}
+	if err := w.f.Close(); err != nil {
+		e.discard()
+		return err
+	}
+	return w.t.commit(e)
+}
+
+func (w *tarWriter) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	_ = w.f.Close()
+	return os.Remove(w.f.Name())
+}
+
+// CreateTar opens a tar stream at dest for NewTar: standard output for "-", otherwise a
+// new file that is gzip-compressed when its name ends in .gz or .tgz. The returned close
+// function finishes the stream and closes the file.
+func CreateTar(dest string) (*Tar, func() error, error) {
+	if dest == "-" {
+		t := NewTar(os.Stdout, "stdout", false)
+		return t, t.Close, nil
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return nil, nil, err
+	}
+	compress := strings.HasSuffix(dest, ".gz") || strings.HasSuffix(dest, ".tgz")
+	t := NewTar(f, dest, compress)
+	closeAll := func() error {
+		err := t.Close()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	return t, closeAll, nil
+}
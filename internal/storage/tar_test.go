@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestTarStreamsCommittedFiles(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var buf bytes.Buffer
+	s := NewTar(&buf, "test.tar", false)
+	s.dir = t.TempDir()
+	if !IsAppendOnly(s) {
+		t.Fatalf("Tar must be append-only")
+	}
+
+	if err := WriteFile(ctx, s, "user/audio/a.m4a", []byte("raw")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	// The last committed file can be read back and replaced without duplicating it.
+	if data, err := ReadFile(ctx, s, "user/audio/a.m4a"); err != nil || string(data) != "raw" {
+		t.Fatalf("ReadFile pending: %q, %v", data, err)
+	}
+	if err := WriteFile(ctx, s, "user/audio/a.m4a", []byte("tagged")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	// Hidden files are scratch space and never reach the stream.
+	if err := WriteFile(ctx, s, "user/profile_pic/.incoming.jpg", []byte("tmp")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := WriteFile(ctx, s, "user/posts/b.jpg", []byte("jpeg")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if data, err := ReadFile(ctx, s, "user/profile_pic/.incoming.jpg"); err != nil || string(data) != "tmp" {
+		t.Fatalf("ReadFile scratch: %q, %v", data, err)
+	}
+	if err := s.Remove(ctx, "user/profile_pic/.incoming.jpg"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	if _, err := s.Open(ctx, "user/audio/a.m4a"); err == nil || IsNotExist(err) {
+		t.Fatalf("expected streamed file to be unreadable, got %v", err)
+	}
+	if ok, err := s.Exists(ctx, "user/audio/a.m4a"); !ok || err != nil {
+		t.Fatalf("Exists streamed: ok=%v err=%v", ok, err)
+	}
+	files, err := s.List(ctx, "user/")
+	if err != nil || len(files) != 2 || files[0].Key != "user/audio/a.m4a" || files[1].Key != "user/posts/b.jpg" {
+		t.Fatalf("List: %+v, %v", files, err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if spooled, _ := os.ReadDir(s.dir); len(spooled) != 0 {
+		t.Fatalf("%d spooled files left after Close", len(spooled))
+	}
+	got := map[string]string{}
+	var order []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(data)
+		order = append(order, hdr.Name)
+	}
+	if len(order) != 2 || got["user/audio/a.m4a"] != "tagged" || got["user/posts/b.jpg"] != "jpeg" {
+		t.Fatalf("unexpected archive: %v %v", order, got)
+	}
+}
@@ -32,3 +32,25 @@ func SanitizePathSegment(s string) string {
 func JoinClean(elem ...string) string {
 	return filepath.Clean(filepath.Join(elem...))
 }
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it into place,
+// so readers never observe a partially written file.
+func WriteFileAtomic(path string, data []byte) error {
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		// On Windows, Rename fails if path exists.
+		_ = os.Remove(path)
+		if err := os.Rename(tmp, path); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+	return nil
+}